@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vlad/craftie/internal/auth"
+	"github.com/vlad/craftie/internal/config"
+	craftiesheets "github.com/vlad/craftie/internal/sheets"
+	"google.golang.org/api/sheets/v4"
+)
+
+// loginTimeout is how long auth login waits for the browser sign in
+const loginTimeout = 5 * time.Minute
+
+// authLogin signs in with a Google account and stores the refresh token in the
+// keyring or credentials helper
+func authLogin(ctx context.Context, cmd *cli.Command) error {
+	cfg, err := auth.ClientConfig(cmd.String("client-file"), cmd.String("client-id"), cmd.String("client-secret"), sheets.SpreadsheetsScope)
+	if err != nil {
+		return err
+	}
+
+	// an invalid config fails here, not after signing in
+	store, err := authStore(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+
+	open := openBrowser
+	if cmd.Bool("no-browser") {
+		open = nil
+	}
+	token, err := auth.Login(ctx, cfg, auth.OpenBrowser(os.Stdout, open))
+	if err != nil {
+		return err
+	}
+
+	if err := auth.NewAuthorizedUser(cfg, token).Save(ctx, store); err != nil {
+		return err
+	}
+	fmt.Printf("Signed in, credentials stored in the %s\n", store)
+	return nil
+}
+
+// authSet validates a service account key, or other credentials, and stores it
+// in the keyring or credentials helper
+func authSet(ctx context.Context, cmd *cli.Command) error {
+	var data []byte
+	var err error
+	switch file := cmd.String("from-file"); {
+	case file != "" && cmd.Bool("stdin"):
+		return fmt.Errorf("pass either --from-file or --stdin, not both")
+	case file != "":
+		data, err = os.ReadFile(file)
+	case cmd.Bool("stdin"):
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		return fmt.Errorf("pass the credentials with --from-file <key.json> or --stdin")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read credentials: %w", err)
+	}
+
+	store, err := authStore(cmd)
+	if err != nil {
+		return err
+	}
+	identity, err := auth.Save(ctx, store, []byte(strings.TrimSpace(string(data))))
+	if err != nil {
+		return fmt.Errorf("credentials were not stored: %w", err)
+	}
+	fmt.Printf("Stored credentials of %s in the %s\n", identity, store)
+	return nil
+}
+
+// authStatus tells which credentials are used, where they come from and
+// whether they give an access token
+func authStatus(ctx context.Context, cmd *cli.Command) error {
+	cfg, err := authConfig(cmd)
+	if err != nil {
+		return err
+	}
+	creds, err := credentialsStatus(ctx, cfg.GoogleSheets)
+	if err != nil {
+		return err
+	}
+
+	token, err := creds.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get an access token: %w", err)
+	}
+	if token.Expiry.IsZero() {
+		fmt.Println("Token:    valid")
+	} else {
+		fmt.Printf("Token:    valid until %s (in %s)\n", token.Expiry.Format(time.TimeOnly), time.Until(token.Expiry).Round(time.Minute))
+	}
+	return nil
+}
+
+// authTest checks that the credentials can open and write to the configured spreadsheet
+func authTest(ctx context.Context, cmd *cli.Command) error {
+	cfg, err := authConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if cfg.GoogleSheets.SpreadsheetID == "" {
+		return fmt.Errorf("google_sheets.spreadsheet_id is not set")
+	}
+	if _, err := credentialsStatus(ctx, cfg.GoogleSheets); err != nil {
+		return err
+	}
+
+	srv, err := craftiesheets.NewSheetsClient(ctx, cfg.GoogleSheets)
+	if err != nil {
+		return err
+	}
+
+	sheetName, err := cfg.GoogleSheets.SheetTitle(time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	title, sheetFound, err := craftiesheets.CheckAccess(ctx, srv, cfg.GoogleSheets.SpreadsheetID, sheetName)
+	if title != "" {
+		fmt.Printf("✓ Opened spreadsheet %q\n", title)
+		if sheetFound {
+			fmt.Printf("✓ Sheet %q exists\n", sheetName)
+		} else {
+			fmt.Printf("! Sheet %q does not exist yet, it is created with the first session\n", sheetName)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("✓ Write access")
+	return nil
+}
+
+// authLogout removes the stored credentials
+func authLogout(ctx context.Context, cmd *cli.Command) error {
+	store, err := authStore(cmd)
+	if err != nil {
+		return err
+	}
+	err = store.Erase(ctx)
+	if errors.Is(err, auth.ErrNotStored) {
+		fmt.Printf("Not signed in, the %s holds no credentials\n", store)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Credentials removed from the %s\n", store)
+	return nil
+}
+
+// credentialsStatus prints where the credentials come from and whose they are
+func credentialsStatus(ctx context.Context, cfg config.GoogleSheetsConfig) (*auth.Credentials, error) {
+	creds, err := craftiesheets.GetCredentials(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("Source:  ", creds.Source)
+	fmt.Println("Identity:", creds.Identity)
+	return creds, nil
+}
+
+// authStore is where auth commands keep the credentials, the configured
+// credentials helper or the keyring
+func authStore(cmd *cli.Command) (auth.Store, error) {
+	cfg, err := authConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return craftiesheets.CredentialsStore(cfg.GoogleSheets)
+}
+
+// authConfig loads the config the way a session started here would see it
+func authConfig(cmd *cli.Command) (*config.Config, error) {
+	project, err := config.FindProjectFile(".")
+	if err != nil {
+		return nil, err
+	}
+	overlay := configOverlay(cmd)
+	overlay.Project = project
+
+	cfg, err := config.LoadConfig(cmd.String("config"), overlay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := setupLogging(cfg.Logging); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// openBrowser opens url with the desktop's default handler
+func openBrowser(url string) error {
+	var opener *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		opener = exec.Command("open", url)
+	case "windows":
+		opener = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		opener = exec.Command("xdg-open", url)
+	}
+	return opener.Start()
+}
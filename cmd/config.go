@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vlad/craftie/internal/config"
+	"github.com/vlad/craftie/internal/pkg"
+)
+
+func configPath(ctx context.Context, cmd *cli.Command) error {
+	fmt.Println(config.ResolvePath(cmd.String("config")))
+	return nil
+}
+
+// configInit asks about the sinks and writes a documented config file
+func configInit(ctx context.Context, cmd *cli.Command) error {
+	path := config.ResolvePath(cmd.String("config"))
+	if _, err := os.Stat(path); err == nil && !cmd.Bool("force") {
+		return fmt.Errorf("config file %s already exists (use --force to overwrite)", path)
+	}
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	cfg, err := config.ParseConfig(config.Template())
+	if err != nil {
+		return err
+	}
+
+	if p.confirm("Track sessions in a CSV file?", false) {
+		cfg.CSV.Enabled = true
+		cfg.CSV.FilePath = p.ask("CSV file path", "~/.craftie/sessions.csv")
+	}
+
+	if p.confirm("Track sessions in Google Sheets?", false) {
+		cfg.GoogleSheets.Enabled = true
+		for cfg.GoogleSheets.SpreadsheetID == "" {
+			cfg.GoogleSheets.SpreadsheetID = p.ask("Spreadsheet ID (found in the URL)", "")
+			if p.eof {
+				break
+			}
+		}
+		cfg.GoogleSheets.SheetName = p.ask("Sheet name", cfg.GoogleSheets.SheetName)
+		cfg.GoogleSheets.CredentialsHelper = p.ask("Credentials helper script (empty to use the keyring)", "")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		printValidationErrors(err)
+		return fmt.Errorf("config was not written")
+	}
+
+	if err := config.WriteConfigFile(path, config.Render(cfg)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Config written to %s\n", path)
+	return nil
+}
+
+// configValidate reports every problem in the config file
+func configValidate(ctx context.Context, cmd *cli.Command) error {
+	path := config.ResolvePath(cmd.String("config"))
+
+	cfg, err := config.ReadConfig(path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		printValidationErrors(err)
+		return fmt.Errorf("%s is invalid", path)
+	}
+
+	for _, warning := range cfg.Warnings() {
+		fmt.Println("!", warning)
+	}
+	fmt.Printf("%s is valid\n", path)
+	return nil
+}
+
+// configMigrate upgrades the config file to the current version, keeping
+// a backup of the old one
+func configMigrate(ctx context.Context, cmd *cli.Command) error {
+	path := config.ResolvePath(cmd.String("config"))
+
+	from, migrated, err := config.MigrateFile(path)
+	if err != nil {
+		printValidationErrors(err)
+		return fmt.Errorf("failed to migrate %s", path)
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if string(original) == string(migrated) {
+		fmt.Printf("%s is up to date (version %d)\n", path, config.CurrentVersion)
+		return nil
+	}
+
+	if cmd.Bool("dry-run") {
+		fmt.Print(pkg.UnifiedDiff(
+			fmt.Sprintf("%s (version %d)", path, from),
+			fmt.Sprintf("%s (version %d)", path, config.CurrentVersion),
+			original, migrated))
+		return nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := os.WriteFile(backup, original, 0644); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := config.WriteConfigFile(path, migrated); err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated %s from version %d to %d, the old file is at %s\n", path, from, config.CurrentVersion, backup)
+	return nil
+}
+
+func configGet(ctx context.Context, cmd *cli.Command) error {
+	cfg, err := config.ReadConfig(config.ResolvePath(cmd.String("config")))
+	if err != nil {
+		return err
+	}
+
+	key := cmd.Args().First()
+	if key == "" {
+		for _, f := range config.Fields() {
+			value, _ := cfg.Get(f.Path)
+			fmt.Printf("%s = %s\n", f.Path, value)
+		}
+		return nil
+	}
+
+	value, err := cfg.Get(key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// configShow prints the config file, or with --resolved the effective config
+// after the .craftie.yaml of the working directory, CRAFTIE_* variables and
+// flags are applied, with the source of each value
+func configShow(ctx context.Context, cmd *cli.Command) error {
+	path := config.ResolvePath(cmd.String("config"))
+
+	if !cmd.Bool("resolved") {
+		cfg, err := config.ReadConfig(path)
+		if err != nil {
+			printValidationErrors(err)
+			return fmt.Errorf("%s is invalid", path)
+		}
+		fmt.Print(string(config.Render(cfg)))
+		return nil
+	}
+
+	project, err := config.FindProjectFile(".")
+	if err != nil {
+		printValidationErrors(err)
+		return fmt.Errorf("failed to resolve config")
+	}
+	overlay := configOverlay(cmd)
+	overlay.Project = project
+
+	cfg, sources, err := config.Resolve(path, overlay)
+	if err != nil {
+		printValidationErrors(err)
+		return fmt.Errorf("failed to resolve config")
+	}
+
+	if project != nil {
+		fmt.Println("Project file:", project.Path)
+	}
+	if cfg.Profile != "" {
+		fmt.Println("Profile:", cfg.Profile)
+	}
+	if project != nil || cfg.Profile != "" {
+		fmt.Println()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, f := range config.Fields() {
+		value, _ := cfg.Get(f.Path)
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Path, value, sources.Origin(f.Path))
+	}
+	w.Flush()
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Println()
+		printValidationErrors(err)
+		return fmt.Errorf("the resolved config is invalid")
+	}
+	return nil
+}
+
+func configSet(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 2 {
+		return fmt.Errorf("usage: craftie config set <key.path> <value>")
+	}
+	key, value := cmd.Args().Get(0), cmd.Args().Get(1)
+
+	path := config.ResolvePath(cmd.String("config"))
+	if err := config.SetInFile(path, key, value); err != nil {
+		printValidationErrors(err)
+		return fmt.Errorf("failed to set %s", key)
+	}
+
+	fmt.Printf("%s = %s\n", key, value)
+	return nil
+}
+
+// configEdit opens a copy of the config in $EDITOR and only replaces the
+// original once the edited copy is valid
+func configEdit(ctx context.Context, cmd *cli.Command) error {
+	path := config.ResolvePath(cmd.String("config"))
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data = config.Template()
+	} else if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// the saved file keeps the mode of the one it replaces
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".craftie-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set the mode of the temporary file: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	tmp.Close()
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	if err := editUntilValid(p, tmp.Name(), runEditor); err != nil {
+		return fmt.Errorf("%w, %s was not modified", err, path)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Printf("%s saved\n", path)
+	return nil
+}
+
+// editUntilValid runs edit on path until it holds a valid config, asking
+// before each retry. Without answers, e.g. stdin closed, it gives up.
+func editUntilValid(p *prompter, path string, edit func(string) error) error {
+	for {
+		if err := edit(path); err != nil {
+			return err
+		}
+
+		edited, err := config.ReadConfig(path)
+		if err == nil {
+			err = edited.Validate()
+		}
+		if err == nil {
+			return nil
+		}
+
+		printValidationErrors(err)
+		if again := p.confirm("Edit again?", true); !again || p.eof {
+			return errors.New("changes discarded")
+		}
+	}
+}
+
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// $EDITOR may carry arguments, e.g. "code --wait"
+	args := append(strings.Fields(editor), path)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	return nil
+}
+
+// configOverrideFlags adds --profile and a global flag for every config key,
+// e.g. --csv-file-path
+func configOverrideFlags() []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:     "profile",
+			Usage:    "Config profile to log sessions under (overrides CRAFTIE_PROFILE and profile: in .craftie.yaml)",
+			Category: "Config overrides",
+		},
+	}
+	for _, f := range config.Fields() {
+		doc, _, _ := strings.Cut(f.Doc, "\n")
+		flags = append(flags, &cli.StringFlag{
+			Name:     config.FlagName(f.Path),
+			Usage:    fmt.Sprintf("%s (overrides %s and %s)", doc, f.Path, config.EnvName(f.Path)),
+			Category: "Config overrides",
+		})
+	}
+	return flags
+}
+
+// configOverlay returns the --profile and config flags of cmd
+func configOverlay(cmd *cli.Command) config.Overlay {
+	return config.Overlay{
+		Profile: cmd.String("profile"),
+		Flags:   configOverrides(cmd),
+	}
+}
+
+// configOverrides returns the config values set with the global flags
+func configOverrides(cmd *cli.Command) config.Overrides {
+	overrides := config.Overrides{}
+	for _, f := range config.Fields() {
+		if name := config.FlagName(f.Path); cmd.IsSet(name) {
+			overrides[f.Path] = cmd.String(name)
+		}
+	}
+	return overrides
+}
+
+// printValidationErrors prints one line per problem
+func printValidationErrors(err error) {
+	var errs pkg.ValidationErrors
+	if !errors.As(err, &errs) {
+		fmt.Println("✗", err)
+		return
+	}
+	for _, e := range errs {
+		fmt.Println("✗", e.Message)
+	}
+}
+
+// prompter asks questions on the terminal, an empty answer picks the default
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// eof is set once the input is exhausted, e.g. piped answers ran out
+	eof bool
+}
+
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	answer, err := p.in.ReadString('\n')
+	if err != nil {
+		p.eof = true
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def
+	}
+	return answer
+}
+
+func (p *prompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+
+	answer := strings.ToLower(p.ask(fmt.Sprintf("%s (%s)", question, hint), ""))
+	switch answer {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditUntilValid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "craftie.yaml")
+	invalid := func(path string) error {
+		return os.WriteFile(path, []byte("csv:\n  file-path: /tmp/craftie.csv\n"), 0o644)
+	}
+
+	t.Run("closed stdin gives up", func(t *testing.T) {
+		p := &prompter{in: bufio.NewReader(strings.NewReader("")), out: io.Discard}
+		edits := 0
+		err := editUntilValid(p, path, func(path string) error {
+			edits++
+			return invalid(path)
+		})
+		if err == nil || !strings.Contains(err.Error(), "discarded") {
+			t.Errorf("expected the changes discarded, got: %v", err)
+		}
+		if edits != 1 {
+			t.Errorf("expected 1 edit, got %d", edits)
+		}
+	})
+
+	t.Run("edits again until valid", func(t *testing.T) {
+		p := &prompter{in: bufio.NewReader(strings.NewReader("\n")), out: io.Discard}
+		edits := 0
+		err := editUntilValid(p, path, func(path string) error {
+			edits++
+			if edits == 1 {
+				return invalid(path)
+			}
+			return os.WriteFile(path, []byte("csv:\n  file_path: /tmp/craftie.csv\n"), 0o644)
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if edits != 2 {
+			t.Errorf("expected 2 edits, got %d", edits)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vlad/craftie/internal/control"
+)
+
+func addNote(ctx context.Context, cmd *cli.Command) error {
+	text := strings.TrimSpace(strings.Join(cmd.Args().Slice(), " "))
+	if text == "" {
+		return fmt.Errorf("note text is required")
+	}
+
+	return withClient(func(c *control.Client) error {
+		if err := c.Note(text); err != nil {
+			return fmt.Errorf("failed to add note: %w", err)
+		}
+		fmt.Println("Note added")
+		return nil
+	})
+}
+
+func switchTask(ctx context.Context, cmd *cli.Command) error {
+	task := cmd.String("task")
+
+	return withClient(func(c *control.Client) error {
+		if err := c.Switch(task); err != nil {
+			return fmt.Errorf("failed to switch task: %w", err)
+		}
+		fmt.Printf("Switched to task %q\n", task)
+		return nil
+	})
+}
+
+// withClient connects to the running session and runs fn against it
+func withClient(fn func(c *control.Client) error) error {
+	client, err := control.Dial(control.SocketPath())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return fn(client)
+}
+
+func showStatus(ctx context.Context, cmd *cli.Command) error {
+	return withClient(func(c *control.Client) error {
+		status, err := c.Status()
+		if err != nil {
+			return fmt.Errorf("failed to get status: %w", err)
+		}
+
+		fmt.Println("Project:", status.Project)
+		if status.Task != "" {
+			fmt.Println("Task:", status.Task)
+		}
+		if status.Notes != "" {
+			fmt.Println("Notes:", status.Notes)
+		}
+		if len(status.Tags) > 0 {
+			fmt.Println("Tags:", strings.Join(status.Tags, ", "))
+		}
+		if status.Rate != 0 {
+			fmt.Println("Rate:", status.Rate)
+		}
+		if status.Profile != "" {
+			fmt.Println("Profile:", status.Profile)
+		}
+		fmt.Println("Started:", status.StartTime.Format(time.DateTime))
+		fmt.Println("Duration:", time.Time{}.Add(status.Elapsed).Format(time.TimeOnly))
+		if status.Paused {
+			fmt.Println("On a break")
+		}
+		if status.PlannedEnd != nil {
+			fmt.Println("Ends at:", status.PlannedEnd.Format(time.TimeOnly))
+		}
+		for _, sink := range status.Sinks {
+			if sink.Error != "" {
+				fmt.Printf("%s: %s\n", sink.Name, sink.Error)
+			} else {
+				fmt.Printf("%s: synced at %s\n", sink.Name, sink.LastSync.Format(time.TimeOnly))
+			}
+		}
+		return nil
+	})
+}
+
+func stopSession(ctx context.Context, cmd *cli.Command) error {
+	return withClient(func(c *control.Client) error {
+		if err := c.Stop(); err != nil {
+			return fmt.Errorf("failed to stop session: %w", err)
+		}
+		fmt.Println("Session stopped")
+		return nil
+	})
+}
+
+func pauseSession(ctx context.Context, cmd *cli.Command) error {
+	return withClient(func(c *control.Client) error {
+		if err := c.Pause(); err != nil {
+			return fmt.Errorf("failed to pause session: %w", err)
+		}
+		fmt.Println("Session paused")
+		return nil
+	})
+}
+
+func resumeSession(ctx context.Context, cmd *cli.Command) error {
+	return withClient(func(c *control.Client) error {
+		if err := c.Resume(); err != nil {
+			return fmt.Errorf("failed to resume session: %w", err)
+		}
+		fmt.Println("Session resumed")
+		return nil
+	})
+}
+
+func extendSession(ctx context.Context, cmd *cli.Command) error {
+	duration := cmd.Args().First()
+	if duration == "" {
+		return fmt.Errorf("duration is required (e.g., 30m)")
+	}
+
+	return withClient(func(c *control.Client) error {
+		if err := c.Extend(duration); err != nil {
+			return fmt.Errorf("failed to extend session: %w", err)
+		}
+		fmt.Println("Session extended by", duration)
+		return nil
+	})
+}
+
+func syncSession(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Bool("pull") {
+		return pullSheets(ctx, cmd)
+	}
+	return withClient(func(c *control.Client) error {
+		if err := c.Sync(); err != nil {
+			return fmt.Errorf("failed to sync session: %w", err)
+		}
+		fmt.Println("Session synced")
+		return nil
+	})
+}
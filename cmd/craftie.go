@@ -4,15 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
 	"github.com/urfave/cli/v3"
-	"github.com/vlad/craftie/internal/config"
-	"github.com/vlad/craftie/internal/session"
-	"github.com/vlad/craftie/internal/sheets"
-	googlesheets "google.golang.org/api/sheets/v4"
+	"github.com/vlad/craftie/internal/sync"
 )
 
 func main() {
@@ -27,6 +21,8 @@ func run() int {
 		// TODO: read from git tree
 		Version:        "0.0.1-beta",
 		DefaultCommand: "start",
+		// Precedence of config values is flag > env > file > default
+		Flags: configOverrideFlags(),
 		Commands: []*cli.Command{
 			{
 				Name:    "start",
@@ -36,8 +32,8 @@ func run() int {
 					&cli.StringFlag{
 						Name:     "project",
 						Aliases:  []string{"p"},
-						Usage:    "Project name",
-						Required: true,
+						Usage:    "Project name (defaults to the one in .craftie.yaml)",
+						Required: false,
 					},
 					&cli.StringFlag{
 						Name:     "config",
@@ -63,9 +59,374 @@ func run() int {
 						Usage:    "Task description",
 						Required: false,
 					},
+					&cli.StringSliceFlag{
+						Name:     "tag",
+						Usage:    "Session tag, can be repeated",
+						Required: false,
+					},
+					&cli.FloatFlag{
+						Name:     "rate",
+						Usage:    "Hourly rate for the session",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "detach",
+						Aliases:  []string{"d"},
+						Usage:    "Run the session in the background daemon, so closing the terminal does not end it",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "tui",
+						Usage:    "Show a full-screen view of the session (falls back to plain output when not in a terminal)",
+						Required: false,
+					},
 				},
 				Action: startSession,
 			},
+			{
+				Name:      "note",
+				Usage:     "Adds a timestamped note to the running session",
+				ArgsUsage: "<text>",
+				Action:    addNote,
+			},
+			{
+				Name:  "switch",
+				Usage: "Closes the current segment of the running session and continues under a new task",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "task",
+						Aliases:  []string{"t"},
+						Usage:    "Task description",
+						Required: true,
+					},
+				},
+				Action: switchTask,
+			},
+			{
+				Name:   "status",
+				Usage:  "Shows the running session",
+				Action: showStatus,
+			},
+			{
+				Name:   "stop",
+				Usage:  "Stops the running session",
+				Action: stopSession,
+			},
+			{
+				Name:   "pause",
+				Usage:  "Starts a break in the running session",
+				Action: pauseSession,
+			},
+			{
+				Name:   "resume",
+				Usage:  "Ends the break in the running session",
+				Action: resumeSession,
+			},
+			{
+				Name:      "extend",
+				Usage:     "Pushes the end timer of the running session back",
+				ArgsUsage: "<duration>",
+				Action:    extendSession,
+			},
+			{
+				Name:  "daemon",
+				Usage: "Runs in the background, owning sessions, timers, syncing and notifications",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "config",
+						Aliases:  []string{"c"},
+						Usage:    "Path to config yaml file",
+						Required: false,
+					},
+				},
+				Action: runDaemon,
+				Commands: []*cli.Command{
+					{
+						Name:   "stop",
+						Usage:  "Stops the running daemon",
+						Action: stopDaemon,
+					},
+					{
+						Name:   "reload",
+						Usage:  "Makes the running daemon reload its configuration",
+						Action: reloadDaemon,
+					},
+					{
+						Name:  "systemd-unit",
+						Usage: "Prints a systemd user unit running the daemon",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "config",
+								Aliases:  []string{"c"},
+								Usage:    "Path to config yaml file",
+								Required: false,
+							},
+							&cli.BoolFlag{
+								Name:     "install",
+								Usage:    "Write the unit to the systemd user directory instead of printing it",
+								Required: false,
+							},
+						},
+						Action: systemdUnit,
+					},
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "Creates, checks and changes the config file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "config",
+						Aliases:  []string{"c"},
+						Usage:    "Path to config yaml file",
+						Required: false,
+					},
+				},
+				Commands: []*cli.Command{
+					{
+						Name:  "init",
+						Usage: "Asks about CSV and Google Sheets and writes a new config file",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:     "force",
+								Usage:    "Overwrite an existing config file",
+								Required: false,
+							},
+						},
+						Action: configInit,
+					},
+					{
+						Name:   "validate",
+						Usage:  "Reports every problem in the config file",
+						Action: configValidate,
+					},
+					{
+						Name:      "get",
+						Usage:     "Prints the value of a key, or of all keys",
+						ArgsUsage: "[key.path]",
+						Action:    configGet,
+					},
+					{
+						Name:  "show",
+						Usage: "Prints the config file, or the effective config with --resolved",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:     "resolved",
+								Usage:    "Apply CRAFTIE_* variables and flags and show where each value came from",
+								Required: false,
+							},
+						},
+						Action: configShow,
+					},
+					{
+						Name:      "set",
+						Usage:     "Changes the value of a key, keeping comments in the file",
+						ArgsUsage: "<key.path> <value>",
+						Action:    configSet,
+					},
+					{
+						Name:   "edit",
+						Usage:  "Opens the config file in $EDITOR and validates it before saving",
+						Action: configEdit,
+					},
+					{
+						Name:  "migrate",
+						Usage: "Upgrades the config file to the current version, keeping a backup",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:     "dry-run",
+								Usage:    "Show the changes as a diff without writing anything",
+								Required: false,
+							},
+						},
+						Action: configMigrate,
+					},
+					{
+						Name:   "path",
+						Usage:  "Prints the location of the config file",
+						Action: configPath,
+					},
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "Saves the running session to all sinks right away, or with --pull reads edits made in Google Sheets",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "config",
+						Aliases:  []string{"c"},
+						Usage:    "Path to config yaml file",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "pull",
+						Usage:    "Merge the sheet with the local history: apply cells edited in the sheet, add rows added by hand",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "policy",
+						Usage:    "Who wins when a cell changed in the sheet and locally: sheet, local or prompt",
+						Value:    string(sync.PolicyPrompt),
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "dry-run",
+						Usage:    "Report what --pull would change without changing anything",
+						Required: false,
+					},
+				},
+				Action: syncSession,
+			},
+			{
+				Name:  "export",
+				Usage: "Writes the finished sessions of the history a sink does not have yet, e.g. after enabling Google Sheets",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "config",
+						Aliases:  []string{"c"},
+						Usage:    "Path to config yaml file",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "to",
+						Usage:    "Sink to export to: sheets or csv",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "from",
+						Usage:    "Only sessions started on or after this day (yyyy-mm-dd)",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "until",
+						Usage:    "Only sessions started on or before this day (yyyy-mm-dd), called --until as --to names the sink",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "dry-run",
+						Usage:    "List the sessions that would be exported without writing them",
+						Required: false,
+					},
+				},
+				Action: exportSessions,
+			},
+			{
+				Name:  "import",
+				Usage: "Adds sessions recorded elsewhere to the history",
+				Commands: []*cli.Command{
+					{
+						Name:      "csv",
+						Usage:     "Reads the sessions of a CSV file written by the CSV sink, duplicates are skipped",
+						ArgsUsage: "<file>",
+						Action:    importCsv,
+					},
+				},
+			},
+			{
+				Name:  "auth",
+				Usage: "Manages the Google credentials used for Sheets",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "config",
+						Aliases:  []string{"c"},
+						Usage:    "Path to config yaml file",
+						Required: false,
+					},
+				},
+				Commands: []*cli.Command{
+					{
+						Name:  "login",
+						Usage: "Signs in with a Google account in the browser and stores the credentials",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "client-file",
+								Usage:    "OAuth client secret JSON of a desktop app, downloaded from the Google Cloud console",
+								Required: false,
+							},
+							&cli.StringFlag{
+								Name:     "client-id",
+								Usage:    "OAuth client ID, when no --client-file is given",
+								Required: false,
+							},
+							&cli.StringFlag{
+								Name:     "client-secret",
+								Usage:    "OAuth client secret, when no --client-file is given",
+								Required: false,
+							},
+							&cli.BoolFlag{
+								Name:     "no-browser",
+								Usage:    "Only print the sign in link",
+								Required: false,
+							},
+						},
+						Action: authLogin,
+					},
+					{
+						Name:  "set",
+						Usage: "Checks a service account key and stores it in the keyring or credentials helper",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "from-file",
+								Usage:    "Path to the service account key JSON",
+								Required: false,
+							},
+							&cli.BoolFlag{
+								Name:     "stdin",
+								Usage:    "Read the key from standard input",
+								Required: false,
+							},
+						},
+						Action: authSet,
+					},
+					{
+						Name:   "status",
+						Usage:  "Shows which credentials are used and when the access token expires",
+						Action: authStatus,
+					},
+					{
+						Name:   "test",
+						Usage:  "Opens the configured spreadsheet and checks write access",
+						Action: authTest,
+					},
+					{
+						Name:   "logout",
+						Usage:  "Removes the credentials from the keyring or credentials helper",
+						Action: authLogout,
+					},
+				},
+			},
+			{
+				Name:  "sheets",
+				Usage: "Manages the Google Sheets spreadsheet sessions are logged to",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "config",
+						Aliases:  []string{"c"},
+						Usage:    "Path to config yaml file",
+						Required: false,
+					},
+				},
+				Commands: []*cli.Command{
+					{
+						Name:  "migrate",
+						Usage: "Adds the columns missing from the sheet's header row",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:     "yes",
+								Aliases:  []string{"y"},
+								Usage:    "Add the columns without asking",
+								Required: false,
+							},
+						},
+						Action: sheetsMigrate,
+					},
+					{
+						Name:   "summary",
+						Usage:  "Creates or refreshes the summary tab (google_sheets.summary)",
+						Action: sheetsSummary,
+					},
+				},
+			},
 		},
 	}
 
@@ -76,147 +437,3 @@ func run() int {
 
 	return 0
 }
-
-func startSession(ctx context.Context, cmd *cli.Command) error {
-	// take flag values
-	projectName := cmd.String("project")
-	notes := cmd.String("notes")
-	configPath := cmd.String("config")
-	endTimeStr := cmd.String("endtime")
-	task := cmd.String("task")
-
-	cfg, err := config.LoadConfig(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
-
-	fmt.Println("🚀 Starting session for project:", projectName)
-	fmt.Println("Configuration loaded")
-
-	var sheetsClient *googlesheets.Service
-	if cfg.GoogleSheets.Enabled {
-		var err error
-		sheetsClient, err = sheets.NewSheetsClient(ctx, cfg.GoogleSheets.CredentialsHelper)
-		if err != nil {
-			return fmt.Errorf("failed to create Google Sheets client: %w", err)
-		}
-		fmt.Println("Google Sheets client created")
-	}
-
-	session := session.Session{
-		StartTime:   time.Now(),
-		Notes:       notes,
-		ProjectName: projectName,
-		Task:        task,
-	}
-
-	// Set up end timer if provided
-	timerChan, err := session.SetEndTimer(endTimeStr)
-	if err != nil {
-		return err
-	}
-
-	syncChan := time.Tick(config.SessionSyncTime)
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	fmt.Printf("Started session for project \"%s\" have fun \n", projectName)
-
-	saveParams := saveSessionParams{
-		cfg:     cfg,
-		session: &session,
-		sheetsParams: sheets.GoogleSheetsParams{
-			Srv:     sheetsClient,
-			Cfg:     cfg.GoogleSheets,
-			Session: &session,
-		},
-	}
-	state := &syncState{}
-
-	// Initial save
-	saveSession(ctx, saveParams, state)
-
-loop:
-	for {
-		select {
-		case <-sigChan:
-			fmt.Println("Session interrupted")
-			break loop
-		case <-timerChan:
-			fmt.Println("Session time reached!")
-			break loop
-		case <-syncChan:
-			fmt.Printf("Syncing session (duration: %s)\n", time.Time{}.Add(session.CurrentDuration()).Format(time.TimeOnly))
-			saveSession(ctx, saveParams, state)
-		}
-	}
-
-	session.Stop()
-
-	fmt.Println("Session lasted ", time.Time{}.Add(session.CurrentDuration()).Format(time.TimeOnly))
-	if session.Task != "" {
-		fmt.Println("Task:", session.Task)
-	}
-
-	// Final sync to save end time
-	saveSession(ctx, saveParams, state)
-
-	return nil
-}
-
-type syncState struct {
-	sheets *sheets.SyncState
-	csv    *sheets.CsvSyncState
-}
-
-type saveSessionParams struct {
-	cfg          *config.Config
-	session      *session.Session
-	sheetsParams sheets.GoogleSheetsParams
-}
-
-func saveSession(ctx context.Context, p saveSessionParams, state *syncState) {
-	if p.cfg.CSV.Enabled {
-		saveCsv(p, state)
-	}
-	if p.cfg.GoogleSheets.Enabled {
-		saveGoogleSheets(ctx, p, state)
-	}
-}
-
-func saveCsv(p saveSessionParams, state *syncState) {
-	if state.csv != nil {
-		if err := sheets.SyncCsvRow(state.csv, p.session); err != nil {
-			fmt.Printf("Warning: failed to sync to CSV: %v\n", err)
-		}
-		return
-	}
-
-	csvState, err := sheets.InitCsvRow(p.cfg.CSV.FilePath, p.session)
-	if err != nil {
-		fmt.Printf("Warning: failed to init CSV row: %v\n", err)
-		return
-	}
-	state.csv = csvState
-	fmt.Printf("Session row created in CSV: %s\n", p.cfg.CSV.FilePath)
-}
-
-func saveGoogleSheets(ctx context.Context, p saveSessionParams, state *syncState) {
-	// sheets already initialized
-	if state.sheets != nil {
-		if err := sheets.SyncGoogleSheetsRow(ctx, p.sheetsParams, state.sheets); err != nil {
-			fmt.Printf("Warning: failed to sync to Google Sheets: %v\n", err)
-		}
-		return
-	}
-
-	// first time; need to init
-	sheetsState, err := sheets.InitRow(ctx, p.sheetsParams)
-	if err != nil {
-		fmt.Printf("Warning: failed to init Google Sheets row: %v\n", err)
-		return
-	}
-	state.sheets = sheetsState
-	fmt.Printf("Session row created in Google Sheets (row %d)\n", sheetsState.RowNumber)
-}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vlad/craftie/internal/config"
+	"github.com/vlad/craftie/internal/control"
+	"github.com/vlad/craftie/internal/daemon"
+)
+
+// runDaemon owns sessions in the background until SIGINT/SIGTERM.
+// Sessions are started with `craftie start --detach` over the control socket.
+func runDaemon(ctx context.Context, cmd *cli.Command) error {
+	configPath := cmd.String("config")
+	overlay := configOverlay(cmd)
+
+	cfg, err := config.LoadConfig(configPath, overlay)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := setupLogging(cfg.Logging); err != nil {
+		return err
+	}
+
+	pidfile := daemon.PidfilePath()
+	if err := daemon.WritePidfile(pidfile); err != nil {
+		return err
+	}
+	defer daemon.RemovePidfile(pidfile)
+
+	controlServer, err := control.Listen(control.SocketPath())
+	if err != nil {
+		return err
+	}
+	defer controlServer.Close()
+
+	fmt.Printf("Daemon running (pid %d), listening on %s\n", os.Getpid(), control.SocketPath())
+
+	r := newRunner(ctx, cfg, configPath, overlay, os.Stdout)
+	r.daemon = true
+	r.run(nil, controlServer)
+
+	fmt.Println("Daemon stopped")
+	return nil
+}
+
+// stopDaemon asks the daemon to stop over the control socket, so the running
+// session is finished first. A daemon without a socket is sent SIGTERM.
+func stopDaemon(ctx context.Context, cmd *cli.Command) error {
+	if err := daemonRequest((*control.Client).StopDaemon, syscall.SIGTERM); err != nil {
+		return err
+	}
+	fmt.Println("Daemon is stopping")
+	return nil
+}
+
+// reloadDaemon asks the daemon to reload over the control socket, or with SIGHUP
+func reloadDaemon(ctx context.Context, cmd *cli.Command) error {
+	if err := daemonRequest((*control.Client).Reload, syscall.SIGHUP); err != nil {
+		return err
+	}
+	fmt.Println("Daemon is reloading its configuration")
+	return nil
+}
+
+// daemonRequest calls request on the control socket, falling back to sending
+// sig to the pid in the pidfile when nothing listens there (Unix only)
+func daemonRequest(request func(*control.Client) error, sig syscall.Signal) error {
+	client, err := control.Dial(control.SocketPath())
+	if err != nil {
+		return daemon.Signal(daemon.PidfilePath(), sig)
+	}
+	defer client.Close()
+	return request(client)
+}
+
+func systemdUnit(ctx context.Context, cmd *cli.Command) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find craftie executable: %w", err)
+	}
+	unit := daemon.SystemdUnit(executable, cmd.String("config"))
+
+	if !cmd.Bool("install") {
+		fmt.Print(unit)
+		return nil
+	}
+
+	unitPath := daemon.SystemdUnitPath()
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return fmt.Errorf("failed to create systemd user directory: %w", err)
+	}
+	if err := os.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("failed to write systemd unit: %w", err)
+	}
+
+	fmt.Printf("Systemd unit written to %s\n", unitPath)
+	fmt.Println("Enable it with: systemctl --user daemon-reload && systemctl --user enable --now craftie")
+	return nil
+}
+
+// daemonLogPath is the configured log file, or the default one in the state dir
+func daemonLogPath(cfg *config.Config) string {
+	if cfg.Logging.OutputFile != "" {
+		return cfg.Logging.OutputFile
+	}
+	return daemon.LogPath()
+}
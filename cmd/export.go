@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/sheets"
+	"github.com/vlad/craftie/internal/sync"
+	"github.com/vlad/craftie/internal/tui"
+)
+
+// exportSessions replays the sessions of the history into a sink, skipping
+// those it already has, e.g. after enabling Google Sheets
+func exportSessions(ctx context.Context, cmd *cli.Command) error {
+	opts := sync.ExportOptions{DryRun: cmd.Bool("dry-run")}
+	var err error
+	if opts.From, err = parseDay(cmd.String("from")); err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	if opts.Until, err = parseDay(cmd.String("until")); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+	if !opts.Until.IsZero() {
+		// the last day is included
+		opts.Until = opts.Until.AddDate(0, 0, 1)
+	}
+
+	cfg, err := authConfig(cmd)
+	if err != nil {
+		return err
+	}
+	opts.Profile = cfg.Profile
+
+	var sink sync.Sink
+	var sheetsSink *sync.SheetsSink
+	var name string
+	switch to := cmd.String("to"); to {
+	case "sheets":
+		p, err := sheetsParams(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		sheetsSink = &sync.SheetsSink{Params: p}
+		sink, name = sheetsSink, "Google Sheets"
+	case "csv":
+		if cfg.CSV.FilePath == "" {
+			return fmt.Errorf("csv.file_path is not set")
+		}
+		sink, name = &sync.CsvSink{FilePath: cfg.CSV.FilePath}, cfg.CSV.FilePath
+	default:
+		return fmt.Errorf("invalid --to %q (use sheets or csv)", to)
+	}
+
+	path := history.DefaultPath()
+	h, err := history.Load(path)
+	if err != nil {
+		return err
+	}
+
+	var progress *tui.Progress
+	if !opts.DryRun && tui.IsTerminal(os.Stdout) {
+		opts.Progress = func(done, total int) {
+			if progress == nil {
+				progress = tui.NewProgress(os.Stdout, "Exporting", total)
+			}
+			progress.Update(done, total)
+		}
+	}
+	result, exportErr := sync.Export(ctx, sink, h, opts)
+	if progress != nil {
+		progress.Done()
+	}
+	if result == nil {
+		return exportErr
+	}
+
+	if opts.DryRun {
+		fmt.Printf("Would export %d sessions to %s\n", len(result.Exported), name)
+		for _, entry := range result.Exported {
+			fmt.Printf("  %s  %s\n", entry.Start.Format("2006-01-02 15:04"), describeEntry(entry))
+		}
+	} else {
+		fmt.Printf("Exported %d sessions to %s\n", len(result.Exported), name)
+	}
+	if len(result.Existing) > 0 {
+		fmt.Printf("%d sessions were already there\n", len(result.Existing))
+	}
+	if len(result.Running) > 0 {
+		fmt.Printf("%d sessions are still running and were left out\n", len(result.Running))
+	}
+
+	// rows written to the sheet are the base sync --pull finds edits by
+	if sheetsSink != nil && !opts.DryRun && len(result.Exported) > 0 {
+		err := history.Update(path, func(h *history.History) error {
+			for _, entry := range result.Exported {
+				entry.Spreadsheet = sheetsSink.Params.Cfg.SpreadsheetID
+				entry.Sheet = sheets.RowText(entry.Session(), sheetsSink.Location)
+				h.Put(entry)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Warning: failed to save the history: %v\n", err)
+		}
+	}
+	return exportErr
+}
+
+// parseDay reads a yyyy-mm-dd date in the local timezone, empty is no date
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	day, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (use yyyy-mm-dd)", s)
+	}
+	return day, nil
+}
+
+func describeEntry(e history.Entry) string {
+	s := e.Project
+	if e.Task != "" {
+		s += " (" + e.Task + ")"
+	}
+	return fmt.Sprintf("%s, %s", s, sheets.FormatHours(e.Duration))
+}
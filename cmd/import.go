@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vlad/craftie/internal/control"
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/sync"
+)
+
+// importCsv adds the sessions of a CSV file written by the CSV sink to the
+// history, e.g. to export them to Google Sheets afterwards
+func importCsv(ctx context.Context, cmd *cli.Command) error {
+	file := cmd.Args().First()
+	if file == "" || cmd.Args().Len() > 1 {
+		return fmt.Errorf("usage: craftie import csv <file>")
+	}
+
+	running := runningSession()
+	var result *sync.ImportResult
+	err := history.Update(history.DefaultPath(), func(h *history.History) error {
+		var err error
+		result, err = sync.ImportCsv(file, h, running)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range result.Errors {
+		fmt.Printf("%s:%d: %s\n", file, issue.Line, issue.Reason)
+	}
+	for _, issue := range result.Duplicates {
+		fmt.Printf("%s:%d: skipped, %s\n", file, issue.Line, issue.Reason)
+	}
+	for _, line := range result.Running {
+		fmt.Printf("%s:%d: skipped, the session is running and is added to the history when it ends\n", file, line)
+	}
+	for _, line := range result.InProgress {
+		fmt.Printf("%s:%d: the session was in progress, it ends after its last written duration\n", file, line)
+	}
+	fmt.Printf("Imported %d sessions", len(result.Imported))
+	if len(result.Running) > 0 {
+		fmt.Printf(", skipped the running session")
+	}
+	if len(result.Duplicates) > 0 {
+		fmt.Printf(", skipped %d duplicates", len(result.Duplicates))
+	}
+	fmt.Println()
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d rows could not be read", len(result.Errors))
+	}
+	return nil
+}
+
+// runningSession asks the control socket for the running session, nil when
+// none runs
+func runningSession() *sync.Running {
+	client, err := control.Dial(control.SocketPath())
+	if err != nil {
+		return nil
+	}
+	defer client.Close()
+
+	status, err := client.Status()
+	if err != nil {
+		return nil
+	}
+	return &sync.Running{Project: status.Project, Start: status.StartTime}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/vlad/craftie/internal/config"
+)
+
+// logFile is the file opened by the last setupLogging, closed by the next one
+var logFile *os.File
+
+// logLevels maps logging.level to slog levels, trace and the levels above
+// error have no slog equivalent
+var logLevels = map[string]slog.Level{
+	"trace": slog.LevelDebug,
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+	"fatal": slog.LevelError,
+	"panic": slog.LevelError,
+}
+
+// setupLogging sends log records at logging.level and above to
+// logging.output_file, or to stderr when it is not set
+func setupLogging(cfg config.LoggingConfig) error {
+	var out io.Writer = os.Stderr
+	var file *os.File
+	if cfg.OutputFile != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.OutputFile), 0o755); err != nil {
+			return fmt.Errorf("failed to create log directory: %w", err)
+		}
+		var err error
+		file, err = os.OpenFile(cfg.OutputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = file
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: logLevels[cfg.Level]})))
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = file
+	return nil
+}
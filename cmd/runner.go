@@ -0,0 +1,674 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/vlad/craftie/internal/config"
+	"github.com/vlad/craftie/internal/control"
+	"github.com/vlad/craftie/internal/notify"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets"
+	"github.com/vlad/craftie/internal/tui"
+)
+
+var errNoSession = errors.New("no session is running")
+
+// errNotDaemon answers daemon requests sent to a `craftie start` in the foreground
+var errNotDaemon = errors.New("no daemon is running, the session runs in the foreground of `craftie start`")
+
+// runner owns the running session and applies requests coming from
+// the terminal UI and the control socket. In daemon mode it outlives
+// sessions and waits for the next one to be started.
+type runner struct {
+	ctx        context.Context
+	cfg        *config.Config
+	configPath string
+	// overlay holds the --profile and config flags of this process
+	overlay config.Overlay
+	// sessionOverlay adds the .craftie.yaml and profile of the running session
+	sessionOverlay config.Overlay
+	sheetsClient   sheets.Client
+	out            io.Writer
+	daemon         bool
+
+	// params is only meaningful while params.session is set
+	params    saveSessionParams
+	state     *syncState
+	timerChan <-chan time.Time
+	stopping  bool
+	// exiting ends run after the request that set it, see Shutdown
+	exiting  bool
+	reminder *time.Ticker
+	// syncTicker fires every sync interval of the running session's config
+	syncTicker *time.Ticker
+	// projectChanged signals edits of the running session's .craftie.yaml,
+	// stopProjectWatch ends the watch with the session
+	projectChanged   <-chan struct{}
+	stopProjectWatch context.CancelFunc
+}
+
+func newRunner(ctx context.Context, cfg *config.Config, configPath string, overlay config.Overlay, out io.Writer) *runner {
+	return &runner{
+		ctx:        ctx,
+		cfg:        cfg,
+		configPath: configPath,
+		overlay:    overlay,
+		out:        out,
+		state:      &syncState{},
+		syncTicker: time.NewTicker(cfg.SyncTime()),
+	}
+}
+
+// begin starts a new session and saves it to all sinks
+func (r *runner) begin(args control.StartArgs) error {
+	if r.params.session != nil {
+		return fmt.Errorf("a session is already running for project %q", r.params.session.ProjectName)
+	}
+
+	// the client already applied it, a daemon has to read it from the
+	// session's directory for the config
+	project, err := config.FindProjectFile(args.Dir)
+	if err != nil {
+		return err
+	}
+	applyProjectDefaults(&args, project)
+	if args.Project == "" {
+		return fmt.Errorf("project is required (pass --project or add a %s)", config.ProjectFileName)
+	}
+
+	overlay := r.overlay
+	overlay.Project = project
+	if args.Profile != "" || args.NoProfile {
+		overlay.Profile, overlay.NoProfile = args.Profile, args.NoProfile
+	}
+	cfg, err := r.sessionConfig(r.cfg, overlay)
+	if err != nil {
+		return err
+	}
+	if args.Rate == 0 && cfg.Profile != "" {
+		args.Rate = cfg.Profiles[cfg.Profile].Rate
+	}
+
+	if cfg.GoogleSheets.Enabled && r.sheetsClient == nil {
+		sheetsClient, err := sheets.NewSheetsClient(r.ctx, cfg.GoogleSheets)
+		if err != nil {
+			return fmt.Errorf("failed to create Google Sheets client: %w", err)
+		}
+		r.sheetsClient = sheetsClient
+		fmt.Fprintln(r.out, "Google Sheets client created")
+	}
+
+	session := &session.Session{
+		ID:          session.NewID(),
+		StartTime:   time.Now(),
+		Notes:       args.Notes,
+		ProjectName: args.Project,
+		Task:        args.Task,
+		Tags:        args.Tags,
+		Rate:        args.Rate,
+		Profile:     cfg.Profile,
+	}
+
+	// Set up end timer if provided
+	timerChan, err := session.SetEndTimer(args.EndTime)
+	if err != nil {
+		return err
+	}
+
+	r.params = saveSessionParams{
+		cfg:     cfg,
+		session: session,
+		out:     r.out,
+		sheetsParams: sheets.GoogleSheetsParams{
+			Client:  r.sheetsClient,
+			Cfg:     cfg.GoogleSheets,
+			Session: session,
+			// one writer for all segments, a row that failed to sync is
+			// written with the next sync
+			Writer: sheets.NewWriter(r.sheetsClient, cfg.GoogleSheets.SpreadsheetID),
+		},
+	}
+	r.sessionOverlay = overlay
+	r.state = &syncState{}
+	r.timerChan = timerChan
+	r.stopping = false
+	r.syncTicker.Reset(cfg.SyncTime())
+	if project != nil {
+		ctx, cancel := context.WithCancel(r.ctx)
+		r.projectChanged = config.Watch(ctx, project.Path, config.WatchInterval)
+		r.stopProjectWatch = cancel
+	}
+
+	fmt.Fprintf(r.out, "Started session for project \"%s\" have fun \n", args.Project)
+	if project != nil {
+		fmt.Fprintln(r.out, "Using", project.Path)
+	}
+	if cfg.Profile != "" {
+		fmt.Fprintf(r.out, "Logging under profile \"%s\"\n", cfg.Profile)
+	}
+
+	// Initial save
+	r.save()
+	return nil
+}
+
+// sessionConfig resolves the config of a session, sessions outside a project
+// and without a profile of their own use the config of the process, base, as is
+func (r *runner) sessionConfig(base *config.Config, overlay config.Overlay) (*config.Config, error) {
+	if overlay.Project == nil && overlay.Profile == r.overlay.Profile && overlay.NoProfile == r.overlay.NoProfile {
+		return base, nil
+	}
+
+	cfg, _, err := config.Resolve(config.ResolvePath(r.configPath), overlay)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil && overlay.Project != nil {
+		return nil, fmt.Errorf("%s: %w", overlay.Project.Path, err)
+	}
+	return cfg, err
+}
+
+// applyProjectDefaults fills in what was not given on the command line
+func applyProjectDefaults(args *control.StartArgs, project *config.ProjectFile) {
+	if project == nil {
+		return
+	}
+	if args.Project == "" {
+		args.Project = project.Project
+	}
+	if args.Task == "" {
+		args.Task = project.Task
+	}
+	if len(args.Tags) == 0 {
+		args.Tags = project.Tags
+	}
+	if args.Rate == 0 {
+		args.Rate = project.Rate
+	}
+}
+
+// finish stops the running session and saves its end time
+func (r *runner) finish() {
+	session := r.params.session
+	if session == nil {
+		return
+	}
+	session.Stop()
+
+	fmt.Fprintln(r.out, "Session lasted ", time.Time{}.Add(session.CurrentDuration()).Format(time.TimeOnly))
+	if session.Task != "" {
+		fmt.Fprintln(r.out, "Task:", session.Task)
+	}
+
+	// Final sync to save end time
+	r.save()
+
+	r.params.session = nil
+	r.sessionOverlay = config.Overlay{}
+	r.timerChan = nil
+	r.stopping = false
+	r.syncTicker.Reset(r.cfg.SyncTime())
+	if r.stopProjectWatch != nil {
+		r.stopProjectWatch()
+		r.stopProjectWatch, r.projectChanged = nil, nil
+	}
+}
+
+// reload re-reads and validates the config file, and the project file of
+// the running session, and applies them to the running session: sinks are
+// added, removed or pointed at their new location. An invalid config is
+// reported and the previous one kept.
+func (r *runner) reload() {
+	cfg, err := config.LoadConfig(r.configPath, r.overlay)
+	if err != nil {
+		fmt.Fprintf(r.out, "Warning: keeping previous config: %v\n", err)
+		return
+	}
+
+	old := r.cfg
+	sessionCfg := cfg
+	overlay := r.sessionOverlay
+	if r.params.session != nil {
+		old = r.params.cfg
+		if overlay.Project != nil {
+			overlay.Project, err = config.LoadProjectFile(overlay.Project.Path)
+		}
+		if err == nil {
+			sessionCfg, err = r.sessionConfig(cfg, overlay)
+		}
+		if err != nil {
+			fmt.Fprintf(r.out, "Warning: keeping previous config: %v\n", err)
+			return
+		}
+	}
+
+	sheetsClient := r.sheetsClient
+	sheetsChanged := !reflect.DeepEqual(sessionCfg.GoogleSheets, old.GoogleSheets)
+	if credentialsChanged(sessionCfg.GoogleSheets, old.GoogleSheets) || !sessionCfg.GoogleSheets.Enabled {
+		sheetsClient = nil
+	}
+	if sessionCfg.GoogleSheets.Enabled && sheetsClient == nil && r.params.session != nil {
+		sheetsClient, err = sheets.NewSheetsClient(r.ctx, sessionCfg.GoogleSheets)
+		if err != nil {
+			fmt.Fprintf(r.out, "Warning: keeping previous config: failed to create Google Sheets client: %v\n", err)
+			return
+		}
+	}
+
+	if cfg.Logging != r.cfg.Logging {
+		if err := setupLogging(cfg.Logging); err != nil {
+			fmt.Fprintf(r.out, "Warning: keeping previous logging config: %v\n", err)
+		}
+	}
+
+	r.cfg = cfg
+	r.sessionOverlay = overlay
+	r.sheetsClient = sheetsClient
+	r.resetReminder()
+	fmt.Fprintln(r.out, "Configuration reloaded")
+
+	if r.params.session == nil {
+		r.syncTicker.Reset(cfg.SyncTime())
+		return
+	}
+	r.syncTicker.Reset(sessionCfg.SyncTime())
+
+	cfg = sessionCfg
+	// the rows in the previous locations are brought up to date one last time
+	if cfg.CSV != old.CSV && old.CSV.Enabled && r.state.csv != nil {
+		if err := sheets.SyncCsvRow(r.state.csv, r.params.session); err != nil {
+			fmt.Fprintf(r.out, "Warning: failed to sync to the previous CSV file: %v\n", err)
+		}
+	}
+	if sheetsChanged && old.GoogleSheets.Enabled && r.state.sheets != nil {
+		if err := sheets.SyncGoogleSheetsRow(r.ctx, r.params.sheetsParams, r.state.sheets); err != nil {
+			fmt.Fprintf(r.out, "Warning: failed to sync to the previous Google Sheets sheet: %v\n", err)
+		}
+	}
+
+	r.params.cfg = cfg
+	r.params.sheetsParams.Cfg = cfg.GoogleSheets
+	r.params.sheetsParams.Client = sheetsClient
+	if sheetsChanged {
+		r.params.sheetsParams.Writer = sheets.NewWriter(sheetsClient, cfg.GoogleSheets.SpreadsheetID)
+	}
+
+	// A sink whose location changed gets a fresh row on the next save
+	if cfg.CSV != old.CSV {
+		r.state.csv = nil
+		r.state.csvResult = syncResult{}
+		fmt.Fprintln(r.out, describeSinkChange("CSV", old.CSV.Enabled, cfg.CSV.Enabled))
+	}
+	if sheetsChanged {
+		r.state.sheets = nil
+		r.state.sheetsResult = syncResult{}
+		fmt.Fprintln(r.out, describeSinkChange("Google Sheets", old.GoogleSheets.Enabled, cfg.GoogleSheets.Enabled))
+	}
+
+	if cfg.CSV != old.CSV || sheetsChanged {
+		r.save()
+	}
+}
+
+func describeSinkChange(name string, wasEnabled, enabled bool) string {
+	switch {
+	case !wasEnabled && enabled:
+		return name + " sink enabled"
+	case wasEnabled && !enabled:
+		return name + " sink disabled"
+	default:
+		return name + " sink reconfigured"
+	}
+}
+
+// resetReminder restarts the notification reminder ticker with the current config
+func (r *runner) resetReminder() {
+	if r.reminder != nil {
+		r.reminder.Stop()
+		r.reminder = nil
+	}
+	if r.daemon && r.cfg.Notifications.Enabled && r.cfg.Notifications.ReminderInterval > 0 {
+		r.reminder = time.NewTicker(r.cfg.Notifications.ReminderInterval)
+	}
+}
+
+// run is the session loop. It returns when the process should exit:
+// on SIGINT/SIGTERM, or in foreground mode once the session has ended.
+func (r *runner) run(ui *tui.UI, controlServer *control.Server) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	defer r.syncTicker.Stop()
+
+	r.resetReminder()
+	configChanged := config.Watch(r.ctx, config.ResolvePath(r.configPath), config.WatchInterval)
+
+	var actions <-chan tui.Action
+	var renderChan <-chan time.Time
+	if ui != nil {
+		actions = ui.Actions()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		renderChan = ticker.C
+	}
+
+	render := func() {
+		if ui != nil && r.params.session != nil {
+			ui.Render(uiState(r.status()))
+		}
+	}
+	render()
+
+	for {
+		exit := false
+
+		select {
+		case sig := <-sigChan:
+			// SIGHUP reloads the daemon, in the foreground it means the terminal is gone
+			if sig == syscall.SIGHUP && r.daemon {
+				r.reload()
+				continue
+			}
+			if r.params.session != nil {
+				fmt.Fprintln(r.out, "Session interrupted")
+				r.stopping = true
+			}
+			exit = true
+		case <-r.timerChan:
+			fmt.Fprintln(r.out, "Session time reached!")
+			r.notify("Session time reached!", fmt.Sprintf("%s: %s", r.params.session.ProjectName,
+				time.Time{}.Add(r.params.session.CurrentDuration()).Format(time.TimeOnly)))
+			r.stopping = true
+		case <-r.syncTicker.C:
+			if r.params.session != nil {
+				fmt.Fprintf(r.out, "Syncing session (duration: %s)\n", time.Time{}.Add(r.params.session.CurrentDuration()).Format(time.TimeOnly))
+				r.save()
+			}
+		case <-configChanged:
+			r.reload()
+		case <-r.projectChanged:
+			r.reload()
+		case <-r.reminderChan():
+			if r.params.session != nil && !r.params.session.Paused() {
+				r.notify("Still crafting?", fmt.Sprintf("%s: %s", r.params.session.ProjectName,
+					time.Time{}.Add(r.params.session.CurrentDuration()).Format(time.TimeOnly)))
+			}
+		case call := <-controlServer.Calls():
+			call.Run(r)
+			exit = r.exiting
+		case action := <-actions:
+			switch action.Kind {
+			case tui.ActionStop:
+				r.Stop()
+			case tui.ActionTogglePause:
+				if r.params.session.Paused() {
+					r.Resume()
+				} else {
+					r.Pause()
+				}
+			case tui.ActionNote:
+				r.Note(action.Text)
+			case tui.ActionSwitchTask:
+				r.SwitchTask(action.Text)
+			}
+		case <-renderChan:
+		}
+
+		if r.stopping {
+			if ui != nil {
+				ui.Close()
+				r.setOutput(os.Stdout)
+			}
+			r.finish()
+			if !r.daemon {
+				return
+			}
+		}
+		if exit {
+			return
+		}
+		render()
+	}
+}
+
+func (r *runner) reminderChan() <-chan time.Time {
+	if r.reminder == nil {
+		return nil
+	}
+	return r.reminder.C
+}
+
+// setOutput redirects progress messages, e.g. into the terminal UI
+func (r *runner) setOutput(out io.Writer) {
+	r.out = out
+	r.params.out = out
+}
+
+func (r *runner) save() {
+	saveSession(r.ctx, r.params, r.state)
+}
+
+// notify shows a desktop notification in daemon mode, where nobody watches the output
+func (r *runner) notify(title, message string) {
+	if !r.daemon || !r.cfg.Notifications.Enabled {
+		return
+	}
+	if err := notify.Send(title, message, r.cfg.Notifications.SoundEnabled); err != nil {
+		fmt.Fprintf(r.out, "Warning: %v\n", err)
+	}
+}
+
+// status describes the running session and the last sync of each sink
+func (r *runner) status() control.Status {
+	s := r.params.session
+	status := control.Status{
+		Project:    s.ProjectName,
+		Task:       s.Task,
+		Notes:      s.Notes,
+		Tags:       s.Tags,
+		Rate:       s.Rate,
+		Profile:    s.Profile,
+		StartTime:  s.StartTime,
+		Elapsed:    s.CurrentDuration(),
+		Paused:     s.Paused(),
+		BreakTime:  s.BreakDuration(),
+		PlannedEnd: s.PlannedEnd(),
+	}
+
+	sink := func(name string, result syncResult) control.SinkStatus {
+		sinkStatus := control.SinkStatus{Name: name, LastSync: result.at}
+		if result.err != nil {
+			sinkStatus.Error = result.err.Error()
+		}
+		return sinkStatus
+	}
+	if r.params.cfg.CSV.Enabled {
+		status.Sinks = append(status.Sinks, sink("CSV", r.state.csvResult))
+	}
+	if r.params.cfg.GoogleSheets.Enabled {
+		status.Sinks = append(status.Sinks, sink("Google Sheets", r.state.sheetsResult))
+	}
+
+	return status
+}
+
+// Start begins a new session, only possible in daemon mode while idle
+func (r *runner) Start(args control.StartArgs) error {
+	return r.begin(args)
+}
+
+func (r *runner) Status() (control.Status, error) {
+	if r.params.session == nil {
+		return control.Status{}, errNoSession
+	}
+	return r.status(), nil
+}
+
+// Stop makes the session loop finish the session after the current request
+func (r *runner) Stop() error {
+	if r.params.session == nil {
+		return errNoSession
+	}
+	fmt.Fprintln(r.out, "Session stopped")
+	r.stopping = true
+	return nil
+}
+
+// Shutdown ends the running session, with a final sync, and the daemon
+func (r *runner) Shutdown() error {
+	if !r.daemon {
+		return errNotDaemon
+	}
+	if r.params.session != nil {
+		fmt.Fprintln(r.out, "Session interrupted")
+		r.stopping = true
+	}
+	r.exiting = true
+	return nil
+}
+
+// Reload re-reads the configuration, like SIGHUP
+func (r *runner) Reload() error {
+	if !r.daemon {
+		return errNotDaemon
+	}
+	r.reload()
+	return nil
+}
+
+func (r *runner) Pause() error {
+	if r.params.session == nil {
+		return errNoSession
+	}
+	if r.params.session.Paused() {
+		return fmt.Errorf("session is already paused")
+	}
+	r.params.session.Pause()
+	fmt.Fprintln(r.out, "Session paused")
+	r.save()
+	return nil
+}
+
+func (r *runner) Resume() error {
+	if r.params.session == nil {
+		return errNoSession
+	}
+	if !r.params.session.Paused() {
+		return fmt.Errorf("session is not paused")
+	}
+	r.params.session.Resume()
+	fmt.Fprintln(r.out, "Session resumed")
+	r.save()
+	return nil
+}
+
+// Note appends a timestamped note to the running session
+func (r *runner) Note(text string) error {
+	if r.params.session == nil {
+		return errNoSession
+	}
+	if text == "" {
+		return fmt.Errorf("note must not be empty")
+	}
+	r.params.session.AddNote(text)
+	fmt.Fprintln(r.out, "Note added")
+	r.save()
+	return nil
+}
+
+// SwitchTask closes the current segment and opens a new one under the same project
+func (r *runner) SwitchTask(task string) error {
+	if r.params.session == nil {
+		return errNoSession
+	}
+	if task == "" {
+		return fmt.Errorf("task must not be empty")
+	}
+
+	next := r.params.session.NextSegment(task)
+	// Final sync of the closed segment
+	r.save()
+
+	r.params.session = next
+	r.params.sheetsParams.Session = next
+	r.state = &syncState{}
+
+	fmt.Fprintf(r.out, "Switched to task %q\n", task)
+	r.save()
+	return nil
+}
+
+// Extend pushes the end timer back, or starts one if the session has none
+func (r *runner) Extend(duration time.Duration) error {
+	if r.params.session == nil {
+		return errNoSession
+	}
+	if duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	r.timerChan = r.params.session.ExtendEndTimer(duration)
+	fmt.Fprintf(r.out, "Session will end at %s\n", r.params.session.PlannedEnd().Format(time.TimeOnly))
+	return nil
+}
+
+// Sync saves the session to all sinks right away
+func (r *runner) Sync() error {
+	if r.params.session == nil {
+		return errNoSession
+	}
+	r.save()
+	return errors.Join(r.state.csvResult.err, r.state.sheetsResult.err)
+}
+
+// uiState converts the session status into what the terminal UI shows
+func uiState(status control.Status) tui.State {
+	s := tui.State{
+		Project:   status.Project,
+		Task:      status.Task,
+		Notes:     status.Notes,
+		Elapsed:   status.Elapsed,
+		Paused:    status.Paused,
+		BreakTime: status.BreakTime,
+	}
+
+	if status.PlannedEnd != nil {
+		left := max(time.Until(*status.PlannedEnd), 0)
+		s.TimeLeft = &left
+	}
+
+	for _, sink := range status.Sinks {
+		sinkStatus := tui.SinkStatus{Name: sink.Name, LastSync: sink.LastSync}
+		if sink.Error != "" {
+			sinkStatus.Err = errors.New(sink.Error)
+		}
+		s.Sinks = append(s.Sinks, sinkStatus)
+	}
+
+	return s
+}
+
+// credentialsChanged tells whether the Sheets client has to be created again,
+// the quota settings are part of the client too
+func credentialsChanged(a, b config.GoogleSheetsConfig) bool {
+	return !slices.Equal(a.CredentialsSources, b.CredentialsSources) ||
+		a.CredentialsFile != b.CredentialsFile ||
+		a.AccessTokenCommand != b.AccessTokenCommand ||
+		a.CredentialsHelper != b.CredentialsHelper ||
+		a.CredentialsHelperFormat != b.CredentialsHelperFormat ||
+		a.CredentialsHelperTimeout != b.CredentialsHelperTimeout ||
+		a.CredentialsCache != b.CredentialsCache ||
+		a.CredentialsCacheTTL != b.CredentialsCacheTTL ||
+		a.RequestsPerMinute != b.RequestsPerMinute ||
+		a.MaxRetries != b.MaxRetries
+}
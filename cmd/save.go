@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vlad/craftie/internal/config"
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets"
+)
+
+type syncState struct {
+	sheets       *sheets.SyncState
+	csv          *sheets.CsvSyncState
+	sheetsResult syncResult
+	csvResult    syncResult
+}
+
+// syncResult is the outcome of the last sync attempt to a sink
+type syncResult struct {
+	at  time.Time
+	err error
+}
+
+type saveSessionParams struct {
+	cfg          *config.Config
+	session      *session.Session
+	sheetsParams sheets.GoogleSheetsParams
+	out          io.Writer
+}
+
+func saveSession(ctx context.Context, p saveSessionParams, state *syncState) {
+	if p.cfg.CSV.Enabled {
+		saveCsv(p, state)
+	}
+	if p.cfg.GoogleSheets.Enabled {
+		saveGoogleSheets(ctx, p, state)
+	}
+	saveHistory(p, state)
+}
+
+// saveHistory records the session in the history, with the row just written
+// to Google Sheets as the base `sync --pull` finds edits in the sheet by
+func saveHistory(p saveSessionParams, state *syncState) {
+	entry := history.FromSession(p.session)
+	err := history.Update(history.DefaultPath(), func(h *history.History) error {
+		if old, ok := h.Get(entry.ID); ok {
+			entry.Spreadsheet, entry.Sheet = old.Spreadsheet, old.Sheet
+		}
+		if p.cfg.GoogleSheets.Enabled && state.sheets != nil && state.sheetsResult.err == nil {
+			entry.Spreadsheet = p.sheetsParams.Cfg.SpreadsheetID
+			loc := state.sheets.Location
+			if loc == nil {
+				loc = time.Local
+			}
+			entry.Sheet = sheets.RowText(p.session, loc)
+		}
+		h.Put(entry)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(p.out, "Warning: failed to save the session to the history: %v\n", err)
+	}
+}
+
+func saveCsv(p saveSessionParams, state *syncState) {
+	if state.csv != nil {
+		err := sheets.SyncCsvRow(state.csv, p.session)
+		state.csvResult = syncResult{at: time.Now(), err: err}
+		if err != nil {
+			fmt.Fprintf(p.out, "Warning: failed to sync to CSV: %v\n", err)
+		}
+		return
+	}
+
+	csvState, err := sheets.InitCsvRow(p.cfg.CSV.FilePath, p.session)
+	state.csvResult = syncResult{at: time.Now(), err: err}
+	if err != nil {
+		fmt.Fprintf(p.out, "Warning: failed to init CSV row: %v\n", err)
+		return
+	}
+	state.csv = csvState
+	fmt.Fprintf(p.out, "Session row created in CSV: %s\n", p.cfg.CSV.FilePath)
+}
+
+func saveGoogleSheets(ctx context.Context, p saveSessionParams, state *syncState) {
+	// sheets already initialized
+	if state.sheets != nil {
+		err := sheets.SyncGoogleSheetsRow(ctx, p.sheetsParams, state.sheets)
+		state.sheetsResult = syncResult{at: time.Now(), err: err}
+		if err != nil {
+			fmt.Fprintf(p.out, "Warning: failed to sync to Google Sheets: %v\n", err)
+			return
+		}
+		refreshSummary(ctx, p)
+		return
+	}
+
+	// first time; need to init
+	sheetsState, err := sheets.InitRow(ctx, p.sheetsParams)
+	state.sheetsResult = syncResult{at: time.Now(), err: err}
+	if err != nil {
+		fmt.Fprintf(p.out, "Warning: failed to init Google Sheets row: %v\n", err)
+		return
+	}
+	state.sheets = sheetsState
+	fmt.Fprintf(p.out, "Session row created in Google Sheets (row %d)\n", sheetsState.RowNumber)
+	refreshSummary(ctx, p)
+}
+
+// refreshSummary rewrites the summary tab once the session has ended
+func refreshSummary(ctx context.Context, p saveSessionParams) {
+	if p.session.EndTime() == nil || !p.sheetsParams.Cfg.Summary.Enabled {
+		return
+	}
+	if err := sheets.RefreshSummary(ctx, p.sheetsParams); err != nil {
+		fmt.Fprintf(p.out, "Warning: failed to refresh the Google Sheets summary: %v\n", err)
+	}
+}
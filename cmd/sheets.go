@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vlad/craftie/internal/config"
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/sheets"
+	"github.com/vlad/craftie/internal/sync"
+	"github.com/vlad/craftie/internal/tui"
+)
+
+// connectSheets loads the config and connects to Google Sheets
+func connectSheets(ctx context.Context, cmd *cli.Command) (sheets.GoogleSheetsParams, error) {
+	cfg, err := authConfig(cmd)
+	if err != nil {
+		return sheets.GoogleSheetsParams{}, err
+	}
+	return sheetsParams(ctx, cfg)
+}
+
+// sheetsParams connects to the Google Sheets spreadsheet of a config
+func sheetsParams(ctx context.Context, cfg *config.Config) (sheets.GoogleSheetsParams, error) {
+	if cfg.GoogleSheets.SpreadsheetID == "" {
+		return sheets.GoogleSheetsParams{}, fmt.Errorf("google_sheets.spreadsheet_id is not set")
+	}
+
+	client, err := sheets.NewSheetsClient(ctx, cfg.GoogleSheets)
+	if err != nil {
+		return sheets.GoogleSheetsParams{}, err
+	}
+	return sheets.GoogleSheetsParams{Client: client, Cfg: cfg.GoogleSheets}, nil
+}
+
+// sheetsMigrate offers to add the columns craftie writes but the configured
+// sheet has no header for. Existing columns are never moved.
+func sheetsMigrate(ctx context.Context, cmd *cli.Command) error {
+	p, err := connectSheets(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	name, err := p.SheetName()
+	if err != nil {
+		return err
+	}
+	layout, err := sheets.ReadLayout(ctx, p)
+	if err != nil {
+		return err
+	}
+	missing := layout.Missing()
+	if len(missing) == 0 {
+		fmt.Printf("Sheet %q has every column\n", name)
+		return nil
+	}
+
+	fmt.Printf("Sheet %q has no %s column\n", name, strings.Join(missing, ", "))
+	prompt := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	if !cmd.Bool("yes") && !prompt.confirm("Add them after the last column?", true) {
+		return fmt.Errorf("sheet was not changed")
+	}
+
+	added, err := sheets.MigrateHeaders(ctx, p)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %s\n", strings.Join(added, ", "))
+	return nil
+}
+
+// sheetsSummary rewrites the summary tab now, e.g. after its tables changed
+func sheetsSummary(ctx context.Context, cmd *cli.Command) error {
+	p, err := connectSheets(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := sheets.RefreshSummary(ctx, p); err != nil {
+		return err
+	}
+	fmt.Printf("Summary written to sheet %q\n", p.Cfg.Summary.SheetName)
+	return nil
+}
+
+// pullSheets merges the session tabs with the history and reports what
+// changed, see sync.Pull
+func pullSheets(ctx context.Context, cmd *cli.Command) error {
+	policy := sync.Policy(cmd.String("policy"))
+	if !slices.Contains(sync.Policies, policy) {
+		return fmt.Errorf("invalid policy %q (use sheet, local or prompt)", policy)
+	}
+	p, err := connectSheets(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	path := history.DefaultPath()
+	h, err := history.Load(path)
+	if err != nil {
+		return err
+	}
+
+	opts := sync.PullOptions{Policy: policy, DryRun: cmd.Bool("dry-run")}
+	if policy == sync.PolicyPrompt && tui.IsTerminal(os.Stdin) {
+		prompt := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+		opts.Resolve = func(c sync.Conflict) (bool, error) {
+			fmt.Printf("%s row %d (%s): %s changed in the sheet and locally\n", c.Sheet, c.Row, c.Project, c.Field)
+			fmt.Printf("  sheet: %q\n  local: %q\n", c.SheetValue, c.Local)
+			// an empty answer, also once the input ran out, keeps the sheet's
+			for {
+				switch prompt.ask("Keep which? (sheet/local)", "sheet") {
+				case "sheet", "s":
+					return true, nil
+				case "local", "l":
+					return false, nil
+				}
+			}
+		}
+	}
+
+	result, err := sync.Pull(ctx, p, h, opts)
+	if err != nil {
+		return err
+	}
+	printPullReport(result.Changes)
+	if opts.DryRun {
+		fmt.Println("Dry run, nothing was changed")
+		return nil
+	}
+
+	return history.Update(path, func(h *history.History) error {
+		for _, entry := range result.Entries {
+			h.Put(entry)
+		}
+		return nil
+	})
+}
+
+func printPullReport(changes []sync.Change) {
+	if len(changes) == 0 {
+		fmt.Println("The sheet and the history match")
+		return
+	}
+	for _, c := range changes {
+		where := fmt.Sprintf("%s row %d", c.Sheet, c.Row)
+		if c.Sheet == "" {
+			where = "session " + c.SessionID
+		}
+		switch c.Kind {
+		case sync.Added:
+			fmt.Printf("+ %s: added %s\n", where, c.Project)
+		case sync.Pulled:
+			fmt.Printf("< %s: %s %q -> %q\n", where, c.Field, c.From, c.To)
+		case sync.Pushed:
+			fmt.Printf("> %s: %s %q -> %q in the sheet\n", where, c.Field, c.From, c.To)
+		case sync.Skipped:
+			fmt.Printf("! %s: skipped %s, %s\n", where, c.Project, c.Reason)
+		case sync.Missing:
+			fmt.Printf("- %s (%s): %s\n", where, c.Project, c.Reason)
+		}
+	}
+}
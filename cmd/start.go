@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vlad/craftie/internal/config"
+	"github.com/vlad/craftie/internal/control"
+	"github.com/vlad/craftie/internal/daemon"
+	"github.com/vlad/craftie/internal/tui"
+)
+
+// daemonStartTimeout is how long `start --detach` waits for a spawned daemon
+const daemonStartTimeout = 5 * time.Second
+
+func startSession(ctx context.Context, cmd *cli.Command) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	// take flag values
+	args := control.StartArgs{
+		Project: cmd.String("project"),
+		Notes:   cmd.String("notes"),
+		EndTime: cmd.String("endtime"),
+		Task:    cmd.String("task"),
+		Tags:    cmd.StringSlice("tag"),
+		Rate:    cmd.Float("rate"),
+		Dir:     dir,
+	}
+	configPath := cmd.String("config")
+	overlay := configOverlay(cmd)
+
+	// Defaults and config from the .craftie.yaml. The config is checked with
+	// it here, a daemon looks it up again from args.Dir.
+	project, err := config.FindProjectFile(dir)
+	if err != nil {
+		return err
+	}
+	applyProjectDefaults(&args, project)
+	if args.Project == "" {
+		return fmt.Errorf("project is required (pass --project or add a %s)", config.ProjectFileName)
+	}
+	overlay.Project = project
+
+	// CRAFTIE_PROFILE of this shell, not of the daemon: no profile here is
+	// sent as no profile
+	args.Profile = config.ProfileName(cmd.String("profile"), project)
+	args.NoProfile = args.Profile == ""
+
+	if cmd.Bool("detach") {
+		return startDetached(configPath, overlay, args)
+	}
+
+	cfg, err := config.LoadConfig(configPath, overlay)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := setupLogging(cfg.Logging); err != nil {
+		return err
+	}
+
+	fmt.Println("🚀 Starting session for project:", args.Project)
+	fmt.Println("Configuration loaded")
+
+	controlServer, err := control.Listen(control.SocketPath())
+	if err != nil {
+		return err
+	}
+	defer controlServer.Close()
+
+	r := newRunner(ctx, cfg, configPath, overlay, os.Stdout)
+	if err := r.begin(args); err != nil {
+		return err
+	}
+
+	var ui *tui.UI
+	if cmd.Bool("tui") && tui.IsTerminal(os.Stdin) && tui.IsTerminal(os.Stdout) {
+		ui, err = tui.Start(os.Stdin, os.Stdout)
+		if err != nil {
+			return fmt.Errorf("failed to start terminal UI: %w", err)
+		}
+		defer ui.Close()
+		r.setOutput(ui)
+	}
+
+	r.run(ui, controlServer)
+
+	return nil
+}
+
+// startDetached hands the session to the daemon, spawning one if none is running
+func startDetached(configPath string, overlay config.Overlay, args control.StartArgs) error {
+	socketPath := control.SocketPath()
+
+	client, err := control.Dial(socketPath)
+	if err != nil {
+		// Validate the config before handing it to a process nobody watches
+		cfg, err := config.LoadConfig(configPath, overlay)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		var daemonArgs []string
+		if configPath != "" {
+			daemonArgs = append(daemonArgs, "--config", configPath)
+		}
+		// The daemon inherits CRAFTIE_* variables, flags are passed on
+		for path, value := range overlay.Flags {
+			daemonArgs = append(daemonArgs, "--"+config.FlagName(path)+"="+value)
+		}
+
+		logPath := daemonLogPath(cfg)
+		pid, err := daemon.Spawn(daemonArgs, logPath)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Daemon started (pid %d), logging to %s\n", pid, logPath)
+
+		client, err = waitForDaemon(socketPath, logPath)
+		if err != nil {
+			return err
+		}
+	} else if len(overlay.Flags) > 0 {
+		fmt.Println("Warning: the daemon is already running with its own config, config flags are ignored")
+	}
+	defer client.Close()
+
+	if err := client.Start(args); err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+
+	fmt.Printf("Started session for project \"%s\" in the background\n", args.Project)
+	return nil
+}
+
+func waitForDaemon(socketPath, logPath string) (*control.Client, error) {
+	deadline := time.Now().Add(daemonStartTimeout)
+	for {
+		client, err := control.Dial(socketPath)
+		if err == nil {
+			return client, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("daemon did not come up, check %s: %w", logPath, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
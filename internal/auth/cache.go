@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Credentials cache kinds, see NewCache
+const (
+	CacheNone    = "none"
+	CacheMemory  = "memory"
+	CacheKeyring = "keyring"
+)
+
+// Cache keeps credentials from a slow helper for a while. It is best effort,
+// failing to cache only means the helper runs again.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// NewCache returns the cache of the given kind, nil for CacheNone
+func NewCache(kind string) Cache {
+	switch kind {
+	case CacheMemory:
+		return memory
+	case CacheKeyring:
+		return keyringCache{}
+	default:
+		return nil
+	}
+}
+
+// CacheKey identifies the credentials a helper returns for a request
+func CacheKey(helper *Helper, req Request) string {
+	sum := sha256.Sum256([]byte(helper.String() + "\n" + req.Host + "\n" + req.Scope))
+	return hex.EncodeToString(sum[:8])
+}
+
+// cachedCredentials are credentials and when they stop being used
+type cachedCredentials struct {
+	Expires     time.Time `json:"expires"`
+	Credentials []byte    `json:"credentials"`
+}
+
+// memory is shared by the whole process, so a reloaded config keeps the cache
+var memory = &memoryCache{entries: map[string]cachedCredentials{}}
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedCredentials
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.Expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.Credentials, true
+}
+
+func (c *memoryCache) Set(key string, data []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cachedCredentials{Expires: time.Now().Add(ttl), Credentials: data}
+}
+
+func (c *memoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// keyringCache survives restarts, each start does not run the helper again
+type keyringCache struct{}
+
+func (keyringCache) user(key string) string {
+	return "helper-cache-" + key
+}
+
+func (c keyringCache) Get(key string) ([]byte, bool) {
+	data, err := keyring.Get(KeyringService, c.user(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry cachedCredentials
+	if json.Unmarshal([]byte(data), &entry) != nil || time.Now().After(entry.Expires) {
+		c.Delete(key)
+		return nil, false
+	}
+	return entry.Credentials, true
+}
+
+func (c keyringCache) Set(key string, data []byte, ttl time.Duration) {
+	entry, err := json.Marshal(cachedCredentials{Expires: time.Now().Add(ttl), Credentials: data})
+	if err != nil {
+		return
+	}
+	keyring.Set(KeyringService, c.user(key), string(entry))
+}
+
+func (c keyringCache) Delete(key string) {
+	keyring.Delete(KeyringService, c.user(key))
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	cloudauth "cloud.google.com/go/auth"
+	"cloud.google.com/go/auth/credentials"
+	"cloud.google.com/go/auth/oauth2adapt"
+	"golang.org/x/oauth2/google"
+)
+
+// Credential types besides AuthorizedUserType, named as in the JSON files
+const (
+	ServiceAccountType                = "service_account"
+	ImpersonatedServiceAccountType    = "impersonated_service_account"
+	ExternalAccountType               = "external_account"
+	ExternalAccountAuthorizedUserType = "external_account_authorized_user"
+	// AccessTokenType is a bare access token handed to craftie
+	AccessTokenType = "access_token"
+	// ComputeType are the credentials of the metadata server on Google Cloud
+	ComputeType = "compute"
+)
+
+// Identity tells whose credentials are used
+type Identity struct {
+	Type string
+	// Name is the service account email, the OAuth client a user signed in
+	// with or where an access token came from
+	Name string
+}
+
+func (i *Identity) String() string {
+	switch i.Type {
+	case AuthorizedUserType:
+		return fmt.Sprintf("Google account signed in with OAuth client %s", i.Name)
+	case ServiceAccountType:
+		return fmt.Sprintf("service account %s", i.Name)
+	case ImpersonatedServiceAccountType:
+		return fmt.Sprintf("service account %s (impersonated)", i.Name)
+	case ExternalAccountType, ExternalAccountAuthorizedUserType:
+		return fmt.Sprintf("external account %s", i.Name)
+	case AccessTokenType:
+		return fmt.Sprintf("access token from %s", i.Name)
+	case ComputeType:
+		return "Google Cloud metadata server"
+	default:
+		return fmt.Sprintf("%s %s", i.Type, i.Name)
+	}
+}
+
+// ParseCredentials checks that data are usable service account, signed in
+// user or impersonated service account credentials and tells whose they are.
+// External accounts, which may run commands or fetch URLs to get a token, are
+// only used as application default credentials.
+func ParseCredentials(data []byte) (*Identity, error) {
+	var kind struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &kind); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+
+	switch kind.Type {
+	case AuthorizedUserType:
+		user, err := ParseAuthorizedUser(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Identity{Type: AuthorizedUserType, Name: user.ClientID}, nil
+	case ServiceAccountType:
+		jwt, err := google.JWTConfigFromJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse credentials: %w", err)
+		}
+		if jwt.Email == "" {
+			return nil, errors.New("service account credentials are missing client_email")
+		}
+		if err := checkPrivateKey(jwt.PrivateKey); err != nil {
+			return nil, err
+		}
+		return &Identity{Type: ServiceAccountType, Name: jwt.Email}, nil
+	case ImpersonatedServiceAccountType:
+		var impersonated struct {
+			ImpersonationURL string          `json:"service_account_impersonation_url"`
+			Source           json.RawMessage `json:"source_credentials"`
+		}
+		if err := json.Unmarshal(data, &impersonated); err != nil {
+			return nil, fmt.Errorf("failed to parse credentials: %w", err)
+		}
+		email, ok := impersonatedEmail(impersonated.ImpersonationURL)
+		if !ok {
+			return nil, errors.New("impersonated service account credentials are missing service_account_impersonation_url")
+		}
+		if len(impersonated.Source) == 0 {
+			return nil, errors.New("impersonated service account credentials are missing source_credentials")
+		}
+		if _, err := ParseCredentials(impersonated.Source); err != nil {
+			return nil, fmt.Errorf("source_credentials: %w", err)
+		}
+		return &Identity{Type: ImpersonatedServiceAccountType, Name: email}, nil
+	case ExternalAccountType, ExternalAccountAuthorizedUserType:
+		return nil, fmt.Errorf("credentials of type %q are only used as application default credentials (the adc source)", kind.Type)
+	case "":
+		return nil, errors.New("credentials have no type, expected a service account key or craftie auth login credentials")
+	default:
+		return nil, fmt.Errorf("credentials of type %q are not supported, expected %s, %s or %s", kind.Type, ServiceAccountType, AuthorizedUserType, ImpersonatedServiceAccountType)
+	}
+}
+
+// checkPrivateKey makes sure a service account key holds an RSA private key
+func checkPrivateKey(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("service account credentials are missing private_key")
+	}
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return errors.New("private_key of the service account is not PEM encoded")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return nil
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return fmt.Errorf("failed to parse private_key of the service account: %w", err)
+	}
+	return nil
+}
+
+// impersonatedEmail takes the service account out of an impersonation URL,
+// .../serviceAccounts/name@project.iam.gserviceaccount.com:generateAccessToken
+func impersonatedEmail(url string) (string, bool) {
+	_, account, ok := strings.Cut(url, "/serviceAccounts/")
+	if !ok {
+		return "", false
+	}
+	account, _, _ = strings.Cut(account, ":")
+	return account, account != ""
+}
+
+// describe tells whose credentials data are without checking them, for
+// credentials cloud.google.com/go/auth has already loaded
+func describe(data []byte) *Identity {
+	if identity, err := ParseCredentials(data); err == nil {
+		return identity
+	}
+	var fields struct {
+		Type             string `json:"type"`
+		ImpersonationURL string `json:"service_account_impersonation_url"`
+		Audience         string `json:"audience"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil || fields.Type == "" {
+		return &Identity{Type: ComputeType}
+	}
+	name := fields.Audience
+	if email, ok := impersonatedEmail(fields.ImpersonationURL); ok {
+		name = email
+	}
+	return &Identity{Type: fields.Type, Name: name}
+}
+
+// NewCredentials turns credentials JSON accepted by ParseCredentials into
+// credentials that hand out access tokens. save receives the refresh token of
+// a signed in user when the server rotates it, it may be nil.
+func NewCredentials(ctx context.Context, data []byte, save func(*AuthorizedUser) error, scopes ...string) (*cloudauth.Credentials, *Identity, error) {
+	identity, err := ParseCredentials(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if identity.Type == AuthorizedUserType {
+		// refreshed here rather than by cloud.google.com/go/auth, which
+		// does not hand out rotated refresh tokens
+		user, err := ParseAuthorizedUser(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cloudauth.NewCredentials(&cloudauth.CredentialsOptions{
+			TokenProvider: oauth2adapt.TokenProviderFromTokenSource(user.TokenSource(ctx, save, scopes...)),
+			JSON:          data,
+		}), identity, nil
+	}
+
+	// only the type checked above is loaded
+	creds, err := credentials.NewCredentialsFromJSON(credentials.CredType(identity.Type), data, &credentials.DetectOptions{
+		Scopes: scopes,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+	return creds, identity, nil
+}
@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Helper actions, named after the ones of git credential helpers
+const (
+	ActionGet   = "get"
+	ActionStore = "store"
+	ActionErase = "erase"
+)
+
+// Helper formats of the request written to the helper's stdin
+const (
+	FormatKeyValue = "keyvalue"
+	FormatJSON     = "json"
+)
+
+// Request describes the credentials craftie asks a helper for
+type Request struct {
+	Protocol string `json:"protocol"`
+	Host     string `json:"host"`
+	Scope    string `json:"scope"`
+	// Credentials are passed to store, empty otherwise
+	Credentials string `json:"credentials,omitempty"`
+}
+
+// Helper is an external command that keeps the credentials, e.g. a wrapper
+// around a password manager. Like a git credential helper it is run as
+// `<command> [args...] get|store|erase` with the request on stdin. For get it
+// prints the credentials JSON, or key=value lines with credentials=<json>.
+// Store and erase must be confirmed with an ok=true line, or {"ok": true} in
+// the JSON format, so a helper that only knows get does not pass for one that
+// kept the credentials.
+type Helper struct {
+	// Command is the program and its arguments
+	Command []string
+	// Format is FormatKeyValue or FormatJSON
+	Format string
+	// Timeout stops a helper that hangs, 0 waits forever
+	Timeout time.Duration
+}
+
+// NewHelper parses the helper command line, quotes group words as in a shell
+func NewHelper(command, format string, timeout time.Duration) (*Helper, error) {
+	words, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials helper %q: %w", command, err)
+	}
+	if len(words) == 0 {
+		return nil, errors.New("credentials helper is empty")
+	}
+	if format == "" {
+		format = FormatKeyValue
+	}
+	return &Helper{Command: words, Format: format, Timeout: timeout}, nil
+}
+
+// String is the command line of the helper
+func (h *Helper) String() string {
+	return strings.Join(h.Command, " ")
+}
+
+// Get asks the helper for credentials
+func (h *Helper) Get(ctx context.Context, req Request) ([]byte, error) {
+	output, err := h.run(ctx, ActionGet, req)
+	if err != nil {
+		return nil, err
+	}
+	return parseHelperOutput(output)
+}
+
+// Store hands credentials to the helper to keep
+func (h *Helper) Store(ctx context.Context, req Request, credentials []byte) error {
+	req.Credentials = string(credentials)
+	output, err := h.run(ctx, ActionStore, req)
+	if err != nil {
+		return err
+	}
+	return parseHelperAck(ActionStore, output)
+}
+
+// Erase tells the helper to forget the credentials
+func (h *Helper) Erase(ctx context.Context, req Request) error {
+	output, err := h.run(ctx, ActionErase, req)
+	if err != nil {
+		return err
+	}
+	return parseHelperAck(ActionErase, output)
+}
+
+func (h *Helper) run(ctx context.Context, action string, req Request) ([]byte, error) {
+	program := h.Command[0]
+	if strings.ContainsRune(program, os.PathSeparator) {
+		info, err := os.Stat(program)
+		if err != nil {
+			return nil, fmt.Errorf("credentials helper not found: %w", err)
+		}
+		// Check if it's executable (Unix permissions)
+		if info.Mode()&0111 == 0 {
+			return nil, fmt.Errorf("credentials helper is not executable: %s (run: chmod +x %s)", program, program)
+		}
+	}
+
+	input, err := req.encode(h.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	args := append(slices.Clone(h.Command[1:]), action)
+	cmd := exec.CommandContext(ctx, program, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	// a helper that leaves children holding stdout open must not block us
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("credentials helper %s timed out after %s", action, h.Timeout)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("credentials helper %s failed: %s", action, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("failed to execute credentials helper: %w", err)
+	}
+	return output, nil
+}
+
+// encode writes the request as key=value lines ending with a blank line,
+// as git does, or as a JSON object
+func (r Request) encode(format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		data, err := json.Marshal(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode helper request: %w", err)
+		}
+		return append(data, '\n'), nil
+	case FormatKeyValue:
+		var b strings.Builder
+		fmt.Fprintf(&b, "protocol=%s\nhost=%s\nscope=%s\n", r.Protocol, r.Host, r.Scope)
+		if r.Credentials != "" {
+			// values are single lines, the credentials JSON is compacted
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, []byte(r.Credentials)); err != nil {
+				return nil, fmt.Errorf("failed to encode helper request: %w", err)
+			}
+			fmt.Fprintf(&b, "credentials=%s\n", compact.String())
+		}
+		b.WriteString("\n")
+		return []byte(b.String()), nil
+	default:
+		return nil, fmt.Errorf("unknown credentials helper format %q", format)
+	}
+}
+
+// parseHelperOutput accepts the credentials JSON itself, a JSON object with a
+// credentials member or key=value lines with credentials=<json>
+func parseHelperOutput(output []byte) ([]byte, error) {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return nil, errors.New("credentials helper returned no credentials")
+	}
+
+	if output[0] == '{' {
+		var wrapped struct {
+			Type        string          `json:"type"`
+			Credentials json.RawMessage `json:"credentials"`
+		}
+		if err := json.Unmarshal(output, &wrapped); err != nil {
+			return nil, fmt.Errorf("credentials helper returned invalid JSON: %w", err)
+		}
+		if wrapped.Type != "" || len(wrapped.Credentials) == 0 {
+			return output, nil
+		}
+		// credentials may be an object or a JSON encoded string
+		var encoded string
+		if json.Unmarshal(wrapped.Credentials, &encoded) == nil {
+			return []byte(encoded), nil
+		}
+		return wrapped.Credentials, nil
+	}
+
+	for line := range strings.Lines(string(output)) {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && key == "credentials" {
+			return []byte(value), nil
+		}
+	}
+	return nil, errors.New("credentials helper output has no credentials= line")
+}
+
+// splitCommand splits a command line into words. Single and double quotes
+// group words and a backslash escapes the next character outside single quotes.
+func splitCommand(command string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && quote != '\'':
+			if i+1 == len(runes) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseHelperAck checks that the helper confirmed action with an ok=true line
+// or a JSON object with "ok": true
+func parseHelperAck(action string, output []byte) error {
+	output = bytes.TrimSpace(output)
+	if len(output) > 0 && output[0] == '{' {
+		var ack struct {
+			OK bool `json:"ok"`
+		}
+		if json.Unmarshal(output, &ack) == nil && ack.OK {
+			return nil
+		}
+	} else {
+		for line := range strings.Lines(string(output)) {
+			key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+			if ok && key == "ok" && value == "true" {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("credentials helper did not confirm %s with an ok=true line, it may not support %s", action, action)
+}
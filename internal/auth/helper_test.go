@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"helper", []string{"helper"}},
+		{"  op read  op://vault/craftie ", []string{"op", "read", "op://vault/craftie"}},
+		{`pass show "google/craftie sheets"`, []string{"pass", "show", "google/craftie sheets"}},
+		{`helper 'it''s' a\ b`, []string{"helper", "its", "a b"}},
+		{`helper "say \"hi\""`, []string{"helper", `say "hi"`}},
+		{`helper ""`, []string{"helper", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	for _, command := range []string{`helper "open`, `helper 'open`, `helper \`} {
+		if _, err := splitCommand(command); err == nil {
+			t.Errorf("expected error for %q, got nil", command)
+		}
+	}
+}
+
+func TestParseHelperOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"credentials json", ` {"type": "service_account"}` + "\n", `{"type": "service_account"}`},
+		{"wrapped object", `{"credentials": {"type": "authorized_user"}}`, `{"type": "authorized_user"}`},
+		{"wrapped string", `{"credentials": "{\"type\": \"authorized_user\"}"}`, `{"type": "authorized_user"}`},
+		{"key=value", "protocol=https\ncredentials={\"type\":\"service_account\"}\n\n", `{"type":"service_account"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHelperOutput([]byte(tt.output))
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	for _, output := range []string{"", "\n", "{broken", "host=example.com\n"} {
+		if _, err := parseHelperOutput([]byte(output)); err == nil {
+			t.Errorf("expected error for %q, got nil", output)
+		}
+	}
+}
+
+func TestHelperStore(t *testing.T) {
+	// The helper keeps the credentials in a file next to it
+	dir := t.TempDir()
+	helperPath := filepath.Join(dir, "helper.sh")
+	helperContent := `#!/bin/bash
+file="$(dirname "$0")/stored"
+case "$1" in
+get) cat "$file" ;;
+store) sed -n 's/^credentials=//p' > "$file" && echo ok=true ;;
+erase) rm -f "$file" && echo ok=true ;;
+esac`
+	if err := os.WriteFile(helperPath, []byte(helperContent), 0755); err != nil {
+		t.Fatalf("failed to create test helper: %v", err)
+	}
+
+	helper, err := NewHelper(helperPath, FormatKeyValue, 5*time.Second)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ctx := context.Background()
+	req := Request{Protocol: "https", Host: "sheets.googleapis.com", Scope: "sheets"}
+	cache := &memoryCache{entries: map[string]cachedCredentials{}}
+	store := &HelperStore{Helper: helper, Request: req, Cache: cache, TTL: time.Minute}
+
+	credentials := `{"type": "service_account",
+  "client_email": "craftie@project.iam.gserviceaccount.com"}`
+	if err := store.Set(ctx, []byte(credentials)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// the helper got the credentials compacted onto one line
+	stored, err := helper.Get(ctx, req)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !strings.HasPrefix(string(stored), `{"type":"service_account","client_email"`) {
+		t.Errorf("unexpected stored credentials %s", stored)
+	}
+	if _, ok := cache.Get(CacheKey(helper, req)); !ok {
+		t.Error("expected stored credentials to be cached")
+	}
+
+	if err := store.Erase(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, ok := cache.Get(CacheKey(helper, req)); ok {
+		t.Error("expected erase to clear the cache")
+	}
+	if _, err := store.Get(ctx); err == nil {
+		t.Error("expected no credentials after erase")
+	}
+}
+
+func TestHelperStoreUnconfirmed(t *testing.T) {
+	// a helper that only knows get, whatever it is asked
+	helperPath := filepath.Join(t.TempDir(), "helper.sh")
+	helperContent := `#!/bin/bash
+echo '{"type": "service_account", "client_email": "old@project.iam.gserviceaccount.com"}'`
+	if err := os.WriteFile(helperPath, []byte(helperContent), 0755); err != nil {
+		t.Fatalf("failed to create test helper: %v", err)
+	}
+
+	helper, err := NewHelper(helperPath, FormatJSON, 5*time.Second)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ctx := context.Background()
+	req := Request{Protocol: "https", Host: "sheets.googleapis.com", Scope: "sheets"}
+	cache := &memoryCache{entries: map[string]cachedCredentials{}}
+	store := &HelperStore{Helper: helper, Request: req, Cache: cache, TTL: time.Minute}
+
+	if err := store.Set(ctx, []byte(`{"type": "service_account"}`)); err == nil || !strings.Contains(err.Error(), "did not confirm store") {
+		t.Errorf("expected store to be unconfirmed, got: %v", err)
+	}
+	if _, ok := cache.Get(CacheKey(helper, req)); ok {
+		t.Error("expected unconfirmed credentials not to be cached")
+	}
+	if err := store.Erase(ctx); err == nil || !strings.Contains(err.Error(), "did not confirm erase") {
+		t.Errorf("expected erase to be unconfirmed, got: %v", err)
+	}
+}
+
+func TestMemoryCacheExpires(t *testing.T) {
+	cache := &memoryCache{entries: map[string]cachedCredentials{}}
+	cache.Set("short", []byte("a"), time.Millisecond)
+	cache.Set("long", []byte("b"), time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := cache.Get("short"); ok {
+		t.Error("expected the short entry to expire")
+	}
+	if data, ok := cache.Get("long"); !ok || string(data) != "b" {
+		t.Errorf("expected the long entry to be cached, got %q %v", data, ok)
+	}
+}
@@ -0,0 +1,252 @@
+// Package auth signs craftie in to Google with a user account, as an
+// alternative to service accounts, and keeps the credentials in the keyring.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// KeyringService and KeyringUser locate the Google credentials in the keyring
+	KeyringService = "craftie"
+	KeyringUser    = "google-sheets"
+
+	// AuthorizedUserType is the credentials type written by Login
+	AuthorizedUserType = "authorized_user"
+)
+
+// AuthorizedUser are the credentials of a user who signed in with Login,
+// in the format Google uses for application default credentials
+type AuthorizedUser struct {
+	Type         string `json:"type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	// TokenURI is only written for token endpoints other than Google's
+	TokenURI string `json:"token_uri,omitempty"`
+}
+
+// ClientConfig returns the OAuth client craftie signs in with. clientFile is
+// the client secret JSON of a desktop app downloaded from the Google Cloud
+// console, otherwise clientID and clientSecret are used.
+func ClientConfig(clientFile, clientID, clientSecret string, scopes ...string) (*oauth2.Config, error) {
+	if clientFile != "" {
+		data, err := os.ReadFile(clientFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OAuth client file: %w", err)
+		}
+		cfg, err := google.ConfigFromJSON(data, scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse OAuth client file: %w", err)
+		}
+		return cfg, nil
+	}
+
+	if clientID == "" {
+		return nil, fmt.Errorf("an OAuth client is required, pass --client-file or --client-id")
+	}
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     google.Endpoint,
+		Scopes:       scopes,
+	}, nil
+}
+
+// Login runs the installed app flow: it listens on a loopback port, lets the
+// user consent in the browser opened by open and exchanges the returned code
+// using PKCE. cfg.RedirectURL is set to the loopback address.
+func Login(ctx context.Context, cfg *oauth2.Config, open func(url string) error) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the OAuth redirect: %w", err)
+	}
+	defer listener.Close()
+
+	cfg.RedirectURL = fmt.Sprintf("http://%s/callback", listener.Addr())
+
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	var once sync.Once
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		var result error
+		switch {
+		case query.Get("state") != state:
+			result = errors.New("OAuth redirect has a wrong state, try again")
+		case query.Get("error") != "":
+			result = fmt.Errorf("sign in was refused: %s", query.Get("error"))
+		case query.Get("code") == "":
+			result = errors.New("OAuth redirect has no code")
+		}
+
+		if result != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<p>craftie sign in failed: %s</p>", html.EscapeString(result.Error()))
+			once.Do(func() { errs <- result })
+			return
+		}
+
+		fmt.Fprint(w, "<p>craftie is signed in, you can close this tab.</p>")
+		once.Do(func() { codes <- query.Get("code") })
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := cfg.AuthCodeURL(state,
+		oauth2.AccessTypeOffline,
+		oauth2.ApprovalForce,
+		oauth2.S256ChallengeOption(verifier))
+	if err := open(authURL); err != nil {
+		return nil, err
+	}
+
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-errs:
+		return nil, err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("sign in was not completed: %w", ctx.Err())
+	}
+
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange the authorization code: %w", err)
+	}
+	if token.RefreshToken == "" {
+		return nil, errors.New("no refresh token was returned, remove craftie from your Google account's third-party access and sign in again")
+	}
+	return token, nil
+}
+
+// NewAuthorizedUser bundles the client and the refresh token of a login
+func NewAuthorizedUser(cfg *oauth2.Config, token *oauth2.Token) *AuthorizedUser {
+	user := &AuthorizedUser{
+		Type:         AuthorizedUserType,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RefreshToken: token.RefreshToken,
+	}
+	if cfg.Endpoint.TokenURL != google.Endpoint.TokenURL {
+		user.TokenURI = cfg.Endpoint.TokenURL
+	}
+	return user
+}
+
+// ParseAuthorizedUser reads credentials written by Login
+func ParseAuthorizedUser(data []byte) (*AuthorizedUser, error) {
+	var user AuthorizedUser
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+	if user.Type != AuthorizedUserType {
+		return nil, fmt.Errorf("credentials are of type %q, not %s", user.Type, AuthorizedUserType)
+	}
+	if user.ClientID == "" || user.RefreshToken == "" {
+		return nil, errors.New("credentials are missing client_id or refresh_token")
+	}
+	return &user, nil
+}
+
+// Config returns the OAuth client the user signed in with
+func (u *AuthorizedUser) Config(scopes ...string) *oauth2.Config {
+	endpoint := google.Endpoint
+	if u.TokenURI != "" {
+		endpoint.TokenURL = u.TokenURI
+	}
+	return &oauth2.Config{
+		ClientID:     u.ClientID,
+		ClientSecret: u.ClientSecret,
+		Endpoint:     endpoint,
+		Scopes:       scopes,
+	}
+}
+
+// Save puts the credentials in store, replacing any stored before
+func (u *AuthorizedUser) Save(ctx context.Context, store Store) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+	_, err = Save(ctx, store, data)
+	return err
+}
+
+// TokenSource returns access tokens for the user, refreshing them as they
+// expire. A refresh token rotated by the server is passed to save.
+func (u *AuthorizedUser) TokenSource(ctx context.Context, save func(*AuthorizedUser) error, scopes ...string) oauth2.TokenSource {
+	base := u.Config(scopes...).TokenSource(ctx, &oauth2.Token{RefreshToken: u.RefreshToken})
+	return oauth2.ReuseTokenSource(nil, &rotatingTokenSource{base: base, user: u, save: save})
+}
+
+// rotatingTokenSource keeps the stored refresh token current
+type rotatingTokenSource struct {
+	base oauth2.TokenSource
+	user *AuthorizedUser
+	save func(*AuthorizedUser) error
+}
+
+func (s *rotatingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token.RefreshToken != "" && token.RefreshToken != s.user.RefreshToken {
+		rotated := *s.user
+		rotated.RefreshToken = token.RefreshToken
+		if s.save != nil {
+			if err := s.save(&rotated); err != nil {
+				return nil, fmt.Errorf("failed to save the new refresh token: %w", err)
+			}
+		}
+		s.user = &rotated
+	}
+	return token, nil
+}
+
+// OpenBrowser prints url and tries to open it in the default browser
+func OpenBrowser(out io.Writer, opener func(url string) error) func(string) error {
+	return func(url string) error {
+		fmt.Fprintf(out, "Open this link to sign in to Google:\n\n  %s\n\n", url)
+		if opener != nil && opener(url) == nil {
+			fmt.Fprintln(out, "Your browser has been opened, waiting for you to sign in...")
+		}
+		return nil
+	}
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate OAuth state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
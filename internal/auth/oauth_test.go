@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+// fakeOAuthServer is a Google-like authorization server that approves every
+// sign in and checks PKCE
+type fakeOAuthServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	challenge string
+	redirect  string
+	// deny makes the consent screen refuse the sign in
+	deny bool
+	// rotate makes refreshes return a new refresh token
+	rotate    bool
+	refreshes int
+}
+
+func newFakeOAuthServer(t *testing.T) *fakeOAuthServer {
+	f := &fakeOAuthServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth", f.authorize)
+	mux.HandleFunc("/token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOAuthServer) config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  f.URL + "/auth",
+			TokenURL: f.URL + "/token",
+		},
+		Scopes: []string{"sheets"},
+	}
+}
+
+func (f *fakeOAuthServer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Hostname() != "127.0.0.1" {
+		http.Error(w, "redirect_uri must be a loopback address", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("access_type") != "offline" {
+		http.Error(w, "expected an offline S256 request", http.StatusBadRequest)
+		return
+	}
+	f.challenge = query.Get("code_challenge")
+	f.redirect = query.Get("redirect_uri")
+
+	params := url.Values{"state": {query.Get("state")}}
+	if f.deny {
+		params.Set("error", "access_denied")
+	} else {
+		params.Set("code", "auth-code")
+	}
+	http.Redirect(w, r, f.redirect+"?"+params.Encode(), http.StatusFound)
+}
+
+func (f *fakeOAuthServer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fail := func(msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"invalid_grant","error_description":%q}`, msg)
+	}
+
+	response := map[string]any{"token_type": "Bearer", "expires_in": 3600}
+	switch r.Form.Get("grant_type") {
+	case "authorization_code":
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		switch {
+		case r.Form.Get("code") != "auth-code":
+			fail("wrong code")
+			return
+		case r.Form.Get("redirect_uri") != f.redirect:
+			fail("redirect_uri does not match")
+			return
+		case base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge:
+			fail("code_verifier does not match the challenge")
+			return
+		}
+		response["access_token"] = "access-0"
+		response["refresh_token"] = "refresh-1"
+	case "refresh_token":
+		if !strings.HasPrefix(r.Form.Get("refresh_token"), "refresh-") {
+			fail("unknown refresh token")
+			return
+		}
+		f.refreshes++
+		response["access_token"] = fmt.Sprintf("access-%d", f.refreshes)
+		if f.rotate {
+			response["refresh_token"] = fmt.Sprintf("refresh-%d", f.refreshes+1)
+		}
+	default:
+		fail("unsupported grant_type")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// browse plays the browser: it follows the redirects back to the loopback listener
+func browse(url string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestLogin(t *testing.T) {
+	t.Run("exchanges the code with PKCE", func(t *testing.T) {
+		server := newFakeOAuthServer(t)
+		cfg := server.config()
+
+		token, err := Login(context.Background(), cfg, browse)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if token.AccessToken != "access-0" || token.RefreshToken != "refresh-1" {
+			t.Errorf("unexpected token: %+v", token)
+		}
+		if !strings.HasPrefix(cfg.RedirectURL, "http://127.0.0.1:") {
+			t.Errorf("expected a loopback redirect, got %q", cfg.RedirectURL)
+		}
+	})
+
+	t.Run("refused consent", func(t *testing.T) {
+		server := newFakeOAuthServer(t)
+		server.deny = true
+
+		_, err := Login(context.Background(), server.config(), browse)
+		if err == nil || !strings.Contains(err.Error(), "access_denied") {
+			t.Fatalf("expected access_denied error, got: %v", err)
+		}
+	})
+
+	t.Run("forged redirect", func(t *testing.T) {
+		server := newFakeOAuthServer(t)
+		forge := func(authURL string) error {
+			u, _ := url.Parse(authURL)
+			redirect := u.Query().Get("redirect_uri")
+			return browse(redirect + "?code=auth-code&state=forged")
+		}
+
+		_, err := Login(context.Background(), server.config(), forge)
+		if err == nil || !strings.Contains(err.Error(), "state") {
+			t.Fatalf("expected state error, got: %v", err)
+		}
+	})
+
+	t.Run("gives up when the context ends", func(t *testing.T) {
+		server := newFakeOAuthServer(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := Login(ctx, server.config(), func(string) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "not completed") {
+			t.Fatalf("expected timeout error, got: %v", err)
+		}
+	})
+}
+
+func TestAuthorizedUser(t *testing.T) {
+	keyring.MockInit()
+
+	t.Run("round trips through the keyring", func(t *testing.T) {
+		server := newFakeOAuthServer(t)
+		cfg := server.config()
+		user := NewAuthorizedUser(cfg, &oauth2.Token{RefreshToken: "refresh-1"})
+		if err := user.Save(context.Background(), KeyringStore{}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		stored, err := keyring.Get(KeyringService, KeyringUser)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		parsed, err := ParseAuthorizedUser([]byte(stored))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if *parsed != *user {
+			t.Errorf("expected %+v, got %+v", user, parsed)
+		}
+		if parsed.TokenURI != cfg.Endpoint.TokenURL {
+			t.Errorf("expected token_uri %q, got %q", cfg.Endpoint.TokenURL, parsed.TokenURI)
+		}
+	})
+
+	t.Run("rejects service accounts", func(t *testing.T) {
+		_, err := ParseAuthorizedUser([]byte(`{"type": "service_account"}`))
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("refreshes and saves rotated tokens", func(t *testing.T) {
+		server := newFakeOAuthServer(t)
+		server.rotate = true
+		user := NewAuthorizedUser(server.config(), &oauth2.Token{RefreshToken: "refresh-1"})
+
+		var saved []string
+		save := func(u *AuthorizedUser) error {
+			saved = append(saved, u.RefreshToken)
+			return nil
+		}
+
+		token, err := user.TokenSource(context.Background(), save).Token()
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if token.AccessToken != "access-1" {
+			t.Errorf("expected access-1, got %q", token.AccessToken)
+		}
+		if len(saved) != 1 || saved[0] != "refresh-2" {
+			t.Errorf("expected refresh-2 to be saved, got %v", saved)
+		}
+	})
+
+	t.Run("reuses valid access tokens", func(t *testing.T) {
+		server := newFakeOAuthServer(t)
+		user := NewAuthorizedUser(server.config(), &oauth2.Token{RefreshToken: "refresh-1"})
+		source := user.TokenSource(context.Background(), nil)
+
+		for range 3 {
+			if _, err := source.Token(); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+		if server.refreshes != 1 {
+			t.Errorf("expected 1 refresh, got %d", server.refreshes)
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	cloudauth "cloud.google.com/go/auth"
+	"cloud.google.com/go/auth/credentials"
+)
+
+// Environment variables read by the env and token sources
+const (
+	CredentialsEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+	AccessTokenEnv = "GOOGLE_OAUTH_ACCESS_TOKEN"
+)
+
+// accessTokenLifetime is how long a token from an access token command is
+// used before the command runs again, Google access tokens last an hour
+const accessTokenLifetime = 30 * time.Minute
+
+// Credentials are what a Source found
+type Credentials struct {
+	*cloudauth.Credentials
+	Identity *Identity
+	// Source tells where the credentials came from, e.g. "file ~/key.json"
+	Source string
+}
+
+// Source is a place Google credentials may come from
+type Source interface {
+	// Name is the source as written in google_sheets.credentials_sources
+	Name() string
+	// Find returns the credentials of the source. A source without
+	// credentials returns an error made by skip, so the next one is tried.
+	Find(ctx context.Context, scopes []string) (*Credentials, error)
+}
+
+// skipped tells why a source had no credentials
+type skipped struct {
+	reason string
+}
+
+func (s *skipped) Error() string {
+	return s.reason
+}
+
+func skip(format string, args ...any) error {
+	return &skipped{reason: fmt.Sprintf(format, args...)}
+}
+
+// Attempt is the outcome of asking one source
+type Attempt struct {
+	Source string
+	Err    error
+}
+
+// DetectError lists every source that was tried and why it gave no credentials
+type DetectError struct {
+	Attempts []Attempt
+}
+
+func (e *DetectError) Error() string {
+	var b strings.Builder
+	last := e.Attempts[len(e.Attempts)-1]
+	if isSkipped(last.Err) {
+		b.WriteString("no Google credentials found, tried:")
+	} else {
+		fmt.Fprintf(&b, "failed to get Google credentials from %s, tried:", last.Source)
+	}
+	for _, a := range e.Attempts {
+		fmt.Fprintf(&b, "\n  %s: %v", a.Source, a.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the error of the source that failed
+func (e *DetectError) Unwrap() error {
+	last := e.Attempts[len(e.Attempts)-1].Err
+	if isSkipped(last) {
+		return nil
+	}
+	return last
+}
+
+func isSkipped(err error) bool {
+	var s *skipped
+	return errors.As(err, &s)
+}
+
+// Detect asks the sources in order and returns the credentials of the first
+// one that has some. A source that has credentials but fails to load them
+// stops the search, falling back would hide the problem.
+func Detect(ctx context.Context, sources []Source, scopes ...string) (*Credentials, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("no credential sources are configured")
+	}
+
+	var detectErr DetectError
+	for _, source := range sources {
+		creds, err := source.Find(ctx, scopes)
+		if err == nil {
+			if creds.Source == "" {
+				creds.Source = source.Name()
+			}
+			return creds, nil
+		}
+		detectErr.Attempts = append(detectErr.Attempts, Attempt{Source: source.Name(), Err: err})
+		if !isSkipped(err) {
+			break
+		}
+	}
+	return nil, &detectErr
+}
+
+// StoreSource finds credentials in a Store, the keyring or a credentials helper
+type StoreSource struct {
+	// SourceName is helper or keyring
+	SourceName string
+	// Store is nil when the source is not set up
+	Store Store
+}
+
+func (s *StoreSource) Name() string {
+	return s.SourceName
+}
+
+func (s *StoreSource) Find(ctx context.Context, scopes []string) (*Credentials, error) {
+	if s.Store == nil {
+		return nil, skip("not configured")
+	}
+
+	data, err := s.Store.Get(ctx)
+	if errors.Is(err, ErrNotStored) {
+		return nil, skip("no credentials stored, run craftie auth login or craftie auth set")
+	}
+	if _, ok := s.Store.(KeyringStore); ok && err != nil {
+		// headless machines have no keyring, that is no reason to stop
+		return nil, skip("%v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	save := func(user *AuthorizedUser) error {
+		return user.Save(ctx, s.Store)
+	}
+	creds, err := fromJSON(ctx, data, save, scopes)
+	if err != nil {
+		return nil, err
+	}
+	creds.Source = s.Store.String()
+	return creds, nil
+}
+
+// FileSource reads a credentials JSON file, its path set in the config or,
+// for the env source, in GOOGLE_APPLICATION_CREDENTIALS
+type FileSource struct {
+	SourceName string
+	Path       string
+	// Unset tells why Path is empty
+	Unset string
+}
+
+// EnvSource reads the file GOOGLE_APPLICATION_CREDENTIALS points to
+func EnvSource() *FileSource {
+	return &FileSource{SourceName: "env", Path: os.Getenv(CredentialsEnv), Unset: CredentialsEnv + " is not set"}
+}
+
+func (s *FileSource) Name() string {
+	return s.SourceName
+}
+
+func (s *FileSource) Find(ctx context.Context, scopes []string) (*Credentials, error) {
+	if s.Path == "" {
+		return nil, skip("%s", s.Unset)
+	}
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	creds, err := fromJSON(ctx, data, nil, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	creds.Source = fmt.Sprintf("%s %s", s.SourceName, s.Path)
+	return creds, nil
+}
+
+// ADCSource uses application default credentials, as set up by
+// gcloud auth application-default login or the metadata server on Google Cloud
+type ADCSource struct{}
+
+func (ADCSource) Name() string {
+	return "adc"
+}
+
+func (ADCSource) Find(ctx context.Context, scopes []string) (*Credentials, error) {
+	creds, err := credentials.DetectDefault(&credentials.DetectOptions{Scopes: scopes})
+	if err != nil {
+		return nil, skip("%v", err)
+	}
+
+	identity := &Identity{Type: ComputeType}
+	if data := creds.JSON(); len(data) > 0 {
+		identity = describe(data)
+	}
+	return &Credentials{Credentials: creds, Identity: identity}, nil
+}
+
+// AccessTokenSource uses an access token obtained elsewhere, from
+// GOOGLE_OAUTH_ACCESS_TOKEN or printed by a command. Such tokens are not
+// refreshed, a command is run again when its token gets old.
+type AccessTokenSource struct {
+	// Command prints an access token, e.g. gcloud auth print-access-token
+	Command string
+	Timeout time.Duration
+}
+
+func (s *AccessTokenSource) Name() string {
+	return "token"
+}
+
+func (s *AccessTokenSource) Find(ctx context.Context, scopes []string) (*Credentials, error) {
+	if token := strings.TrimSpace(os.Getenv(AccessTokenEnv)); token != "" {
+		provider := staticToken{&cloudauth.Token{Value: token, Type: "Bearer"}}
+		return &Credentials{
+			Credentials: cloudauth.NewCredentials(&cloudauth.CredentialsOptions{TokenProvider: provider}),
+			Identity:    &Identity{Type: AccessTokenType, Name: AccessTokenEnv},
+		}, nil
+	}
+	if s.Command == "" {
+		return nil, skip("%s is not set and google_sheets.access_token_command is empty", AccessTokenEnv)
+	}
+
+	words, err := splitCommand(s.Command)
+	if err != nil || len(words) == 0 {
+		return nil, fmt.Errorf("invalid access token command %q", s.Command)
+	}
+	provider := &commandToken{words: words, timeout: s.Timeout}
+	// the first token is fetched now, so a broken command is reported here
+	if _, err := provider.Token(ctx); err != nil {
+		return nil, err
+	}
+	return &Credentials{
+		Credentials: cloudauth.NewCredentials(&cloudauth.CredentialsOptions{
+			TokenProvider: cloudauth.NewCachedTokenProvider(provider, &cloudauth.CachedTokenProviderOptions{
+				DisableAsyncRefresh: true,
+			}),
+		}),
+		Identity: &Identity{Type: AccessTokenType, Name: s.Command},
+	}, nil
+}
+
+type staticToken struct {
+	token *cloudauth.Token
+}
+
+func (s staticToken) Token(context.Context) (*cloudauth.Token, error) {
+	return s.token, nil
+}
+
+// commandToken runs a command for each token
+type commandToken struct {
+	words   []string
+	timeout time.Duration
+}
+
+func (c *commandToken) Token(ctx context.Context) (*cloudauth.Token, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, c.words[0], c.words[1:]...)
+	cmd.WaitDelay = time.Second
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("access token command timed out after %s", c.timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("access token command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return nil, errors.New("access token command printed no token")
+	}
+	return &cloudauth.Token{Value: token, Type: "Bearer", Expiry: time.Now().Add(accessTokenLifetime)}, nil
+}
+
+func fromJSON(ctx context.Context, data []byte, save func(*AuthorizedUser) error, scopes []string) (*Credentials, error) {
+	creds, identity, err := NewCredentials(ctx, data, save, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	return &Credentials{Credentials: creds, Identity: identity}, nil
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// failingSource has credentials that cannot be loaded
+type failingSource struct{}
+
+func (failingSource) Name() string { return "broken" }
+
+func (failingSource) Find(context.Context, []string) (*Credentials, error) {
+	return nil, errors.New("helper exploded")
+}
+
+func TestDetect(t *testing.T) {
+	keyring.MockInit()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.json")
+	if err := os.WriteFile(keyPath, serviceAccountKey(t, nil), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	t.Run("first source with credentials wins", func(t *testing.T) {
+		t.Setenv(CredentialsEnv, keyPath)
+		t.Setenv(AccessTokenEnv, "")
+
+		sources := []Source{
+			&FileSource{SourceName: "file", Unset: "google_sheets.credentials_file is not set"},
+			&AccessTokenSource{},
+			EnvSource(),
+			&StoreSource{SourceName: "keyring", Store: KeyringStore{}},
+		}
+		creds, err := Detect(ctx, sources, "sheets")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if creds.Source != "env "+keyPath {
+			t.Errorf("expected the env source, got %q", creds.Source)
+		}
+		if creds.Identity.Name != "craftie@project.iam.gserviceaccount.com" {
+			t.Errorf("unexpected identity %v", creds.Identity)
+		}
+	})
+
+	t.Run("lists every source tried", func(t *testing.T) {
+		t.Setenv(CredentialsEnv, "")
+		t.Setenv(AccessTokenEnv, "")
+
+		sources := []Source{
+			&StoreSource{SourceName: "helper"},
+			&FileSource{SourceName: "file", Unset: "google_sheets.credentials_file is not set"},
+			&AccessTokenSource{},
+			EnvSource(),
+			&StoreSource{SourceName: "keyring", Store: KeyringStore{}},
+		}
+		_, err := Detect(ctx, sources, "sheets")
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		want := []string{
+			"no Google credentials found, tried:",
+			"  helper: not configured",
+			"  file: google_sheets.credentials_file is not set",
+			"  token: GOOGLE_OAUTH_ACCESS_TOKEN is not set",
+			"  env: GOOGLE_APPLICATION_CREDENTIALS is not set",
+			"  keyring: no credentials stored",
+		}
+		for _, line := range want {
+			if !strings.Contains(err.Error(), line) {
+				t.Errorf("expected %q in:\n%v", line, err)
+			}
+		}
+	})
+
+	t.Run("a failing source stops the search", func(t *testing.T) {
+		sources := []Source{
+			&StoreSource{SourceName: "helper"},
+			failingSource{},
+			&FileSource{SourceName: "file", Path: keyPath},
+		}
+		_, err := Detect(ctx, sources, "sheets")
+		if err == nil || !strings.HasPrefix(err.Error(), "failed to get Google credentials from broken, tried:") {
+			t.Fatalf("expected the broken source to be reported, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "helper: not configured") || strings.Contains(err.Error(), "file:") {
+			t.Errorf("expected the sources up to the failing one, got:\n%v", err)
+		}
+	})
+
+	t.Run("invalid credentials file", func(t *testing.T) {
+		badPath := filepath.Join(dir, "bad.json")
+		os.WriteFile(badPath, []byte(`{"type": "service_account"}`), 0600)
+
+		_, err := Detect(ctx, []Source{&FileSource{SourceName: "file", Path: badPath}}, "sheets")
+		if err == nil || !strings.Contains(err.Error(), "client_email") {
+			t.Fatalf("expected a client_email error, got: %v", err)
+		}
+	})
+}
+
+func TestAccessTokenSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("from the environment", func(t *testing.T) {
+		t.Setenv(AccessTokenEnv, "ya29.env-token\n")
+
+		creds, err := (&AccessTokenSource{Command: "false"}).Find(ctx, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		token, err := creds.Token(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if token.Value != "ya29.env-token" {
+			t.Errorf("expected the env token, got %q", token.Value)
+		}
+	})
+
+	t.Run("from a command", func(t *testing.T) {
+		t.Setenv(AccessTokenEnv, "")
+
+		source := &AccessTokenSource{Command: `echo "ya29.command-token"`, Timeout: 5 * time.Second}
+		creds, err := source.Find(ctx, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		token, err := creds.Token(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if token.Value != "ya29.command-token" || token.Expiry.IsZero() {
+			t.Errorf("unexpected token %+v", token)
+		}
+		if creds.Identity.String() != `access token from echo "ya29.command-token"` {
+			t.Errorf("unexpected identity %q", creds.Identity)
+		}
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		t.Setenv(AccessTokenEnv, "")
+
+		_, err := (&AccessTokenSource{Command: "false"}).Find(ctx, nil)
+		if err == nil || isSkipped(err) {
+			t.Fatalf("expected the command to fail, got: %v", err)
+		}
+	})
+}
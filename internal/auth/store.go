@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// ErrNotStored is returned when no credentials are stored
+var ErrNotStored = errors.New("no credentials are stored")
+
+// Store is where craftie keeps the Google credentials
+type Store interface {
+	// Get returns the credentials, ErrNotStored if there are none
+	Get(ctx context.Context) ([]byte, error)
+	// Set replaces the credentials
+	Set(ctx context.Context, credentials []byte) error
+	// Erase removes the credentials, ErrNotStored if there are none
+	Erase(ctx context.Context) error
+	// String names the store for messages
+	String() string
+}
+
+// Save validates credentials and puts them in store
+func Save(ctx context.Context, store Store, credentials []byte) (*Identity, error) {
+	identity, err := ParseCredentials(credentials)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Set(ctx, credentials); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// KeyringStore keeps the credentials in the system keyring
+type KeyringStore struct{}
+
+func (KeyringStore) String() string {
+	return "keyring"
+}
+
+func (KeyringStore) Get(ctx context.Context) ([]byte, error) {
+	data, err := keyring.Get(KeyringService, KeyringUser)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, ErrNotStored
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials from keyring: %w", err)
+	}
+	return []byte(data), nil
+}
+
+func (KeyringStore) Set(ctx context.Context, credentials []byte) error {
+	if err := keyring.Set(KeyringService, KeyringUser, string(credentials)); err != nil {
+		return fmt.Errorf("failed to store credentials in keyring: %w", err)
+	}
+	return nil
+}
+
+func (KeyringStore) Erase(ctx context.Context) error {
+	err := keyring.Delete(KeyringService, KeyringUser)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return ErrNotStored
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove credentials from keyring: %w", err)
+	}
+	return nil
+}
+
+// HelperStore gets the credentials from a credentials helper, caching them
+// for TTL when Cache is set
+type HelperStore struct {
+	Helper  *Helper
+	Request Request
+	Cache   Cache
+	TTL     time.Duration
+}
+
+func (s *HelperStore) String() string {
+	return "credentials helper " + s.Helper.String()
+}
+
+func (s *HelperStore) Get(ctx context.Context) ([]byte, error) {
+	key := CacheKey(s.Helper, s.Request)
+	if s.Cache != nil {
+		if credentials, ok := s.Cache.Get(key); ok {
+			return credentials, nil
+		}
+	}
+
+	credentials, err := s.Helper.Get(ctx, s.Request)
+	if err != nil {
+		return nil, err
+	}
+	if s.Cache != nil && s.TTL > 0 {
+		s.Cache.Set(key, credentials, s.TTL)
+	}
+	return credentials, nil
+}
+
+func (s *HelperStore) Set(ctx context.Context, credentials []byte) error {
+	// only credentials the helper confirmed keeping are cached
+	if err := s.Helper.Store(ctx, s.Request, credentials); err != nil {
+		return err
+	}
+	if s.Cache != nil && s.TTL > 0 {
+		s.Cache.Set(CacheKey(s.Helper, s.Request), credentials, s.TTL)
+	}
+	return nil
+}
+
+func (s *HelperStore) Erase(ctx context.Context) error {
+	if s.Cache != nil {
+		s.Cache.Delete(CacheKey(s.Helper, s.Request))
+	}
+	return s.Helper.Erase(ctx, s.Request)
+}
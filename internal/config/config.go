@@ -4,19 +4,25 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/vlad/craftie/internal/pkg"
 	"gopkg.in/yaml.v3"
 )
 
+//go:generate go run gentemplate.go ../../config-template.yaml
+
 const (
 	SessionSyncTime = time.Minute * 10
 )
 
-// LoadConfig loads configuration from the specified path or creates default if it doesn't exist
-func LoadConfig(cfgPath string) (*Config, error) {
+// LoadConfig loads configuration from the specified path or creates default if it doesn't exist.
+// The overlay is applied over the file, see Resolve.
+func LoadConfig(cfgPath string, overlay Overlay) (*Config, error) {
 	if cfgPath == "" {
 		fmt.Println("No config path provided, using the default one")
 		cfgPath = DefaultConfigPath()
@@ -35,56 +41,82 @@ func LoadConfig(cfgPath string) (*Config, error) {
 	if !configFileExists {
 		fmt.Println("Config doesn't exist, generating default...")
 
-		if err := createConfigFile(cfgPath, defaultConfig()); err != nil {
+		if err := WriteConfigFile(cfgPath, Template()); err != nil {
 			return nil, fmt.Errorf("failed to create default config file: %w", err)
 		}
-		fmt.Printf("Default config file created at %s\n", cfgPath)
+		fmt.Printf("Default config file created at %s (run `craftie config init` to set up sinks)\n", cfgPath)
+	}
+
+	config, _, err := Resolve(cfgPath, overlay)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range config.Warnings() {
+		fmt.Println("Warning:", warning)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
-	// Load config file
+	return config, nil
+}
+
+// ReadConfig parses the config file at cfgPath without validating it
+func ReadConfig(cfgPath string) (*Config, error) {
 	data, err := os.ReadFile(cfgPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	config, _, err := parseConfig(cfgPath, data)
+	return config, err
+}
+
+// ParseConfig parses config yaml over the defaults without validating it
+func ParseConfig(data []byte) (*Config, error) {
+	config, _, err := parseConfig("", data)
+	return config, err
+}
+
+// parseConfig decodes strictly: unknown keys and values of the wrong type
+// are returned as pkg.ValidationErrors pointing into file. Older versions
+// are migrated in memory. The keys set in the file are recorded in the
+// returned Sources.
+func parseConfig(file string, data []byte) (*Config, Sources, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, pkg.ValidationErrors{pkg.NewValidationError(fmt.Sprintf("%s: %v", displayName(file), err))}
+	}
+	migration, err := migrate(file, &doc)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Expand tilde paths in config
-	if err := config.expandPaths(); err != nil {
-		return nil, fmt.Errorf("failed to expand paths: %w", err)
+	config := defaultConfig()
+	config.warnings = migration.warnings
+	sources := Sources{}
+	if err := decodeNode(file, &doc, config, sources); err != nil {
+		return nil, nil, err
 	}
 
-	if err := config.Validate(); err != nil {
-		return nil, err
+	// Expand tilde paths in config
+	if err := config.expandPaths(); err != nil {
+		return nil, nil, fmt.Errorf("failed to expand paths: %w", err)
 	}
 
-	return &config, nil
+	return config, sources, nil
 }
 
-func createConfigFile(configPath string, config *Config) error {
+// WriteConfigFile writes data to configPath, creating its directory if needed
+func WriteConfigFile(configPath string, data []byte) error {
 	// Ensure directory exists
 	dir := filepath.Dir(configPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	// Create config file
-	file, err := os.Create(configPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	configContent, err := yaml.Marshal(config)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config file: %w", err)
-	}
-
-	_, err = file.Write(configContent)
-	if err != nil {
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
@@ -106,18 +138,51 @@ func DefaultConfigPath() string {
 }
 
 type Config struct {
+	Version       int                `yaml:"version" mapstructure:"version"`
 	GoogleSheets  GoogleSheetsConfig `yaml:"google_sheets" mapstructure:"google_sheets"`
 	Notifications NotificationConfig `yaml:"notifications" mapstructure:"notifications"`
-	Logging       LoggingConfig      `yaml:"logging" mapstructure:"logging"`
 	CSV           CSVConfig          `yaml:"csv" mapstructure:"csv"`
+	Logging       LoggingConfig      `yaml:"logging" mapstructure:"logging"`
+	Profiles      map[string]Profile `yaml:"profiles,omitempty" mapstructure:"profiles"`
+
+	// Profile is the name of the active profile, set by Resolve
+	Profile string `yaml:"-"`
+
+	// warnings are deprecations found while reading the file
+	warnings []string
 }
 
 type GoogleSheetsConfig struct {
-	SpreadsheetID     string `yaml:"spreadsheet_id" mapstructure:"spreadsheet_id"`
-	SheetName         string `yaml:"sheet_name" mapstructure:"sheet_name"`
-	CredentialsHelper string `yaml:"credentials_helper" mapstructure:"credentials_helper"`
-	SyncInterval      time.Duration
-	Enabled           bool `yaml:"enabled" mapstructure:"enabled"`
+	SpreadsheetID string `yaml:"spreadsheet_id" mapstructure:"spreadsheet_id"`
+	SheetName     string `yaml:"sheet_name" mapstructure:"sheet_name"`
+	// CredentialsSources are where credentials are looked for, in order
+	CredentialsSources []string `yaml:"credentials_sources" mapstructure:"credentials_sources"`
+	CredentialsFile    string   `yaml:"credentials_file" mapstructure:"credentials_file"`
+	CredentialsHelper  string   `yaml:"credentials_helper" mapstructure:"credentials_helper"`
+	// CredentialsHelperTimeout stops a helper that hangs, 0 waits forever
+	CredentialsHelperTimeout time.Duration `yaml:"credentials_helper_timeout" mapstructure:"credentials_helper_timeout"`
+	// CredentialsHelperFormat is how requests are written to the helper: keyvalue or json
+	CredentialsHelperFormat string `yaml:"credentials_helper_format" mapstructure:"credentials_helper_format"`
+	// CredentialsCache keeps helper credentials in memory or the keyring, or none
+	CredentialsCache    string        `yaml:"credentials_cache" mapstructure:"credentials_cache"`
+	CredentialsCacheTTL time.Duration `yaml:"credentials_cache_ttl" mapstructure:"credentials_cache_ttl"`
+	// AccessTokenCommand prints an access token, e.g. gcloud auth print-access-token
+	AccessTokenCommand string        `yaml:"access_token_command" mapstructure:"access_token_command"`
+	SyncInterval       time.Duration `yaml:"sync_interval" mapstructure:"sync_interval"`
+	// RequestsPerMinute limits the calls to the Sheets API, 0 means no limit
+	RequestsPerMinute int `yaml:"requests_per_minute" mapstructure:"requests_per_minute"`
+	// MaxRetries is how often a call refused for quota or unavailability is retried
+	MaxRetries int           `yaml:"max_retries" mapstructure:"max_retries"`
+	Enabled    bool          `yaml:"enabled" mapstructure:"enabled"`
+	Summary    SummaryConfig `yaml:"summary" mapstructure:"summary"`
+}
+
+// SummaryConfig describes the summary tab kept next to the session rows
+type SummaryConfig struct {
+	Enabled   bool   `yaml:"enabled" mapstructure:"enabled"`
+	SheetName string `yaml:"sheet_name" mapstructure:"sheet_name"`
+	// Tables are written left to right, see SummaryTables
+	Tables []string `yaml:"tables" mapstructure:"tables"`
 }
 
 type NotificationConfig struct {
@@ -137,10 +202,33 @@ type CSVConfig struct {
 	FilePath string `yaml:"file_path" mapstructure:"file_path"`
 }
 
+// SummaryTables are the tables a summary tab can show: hours per project per
+// week and per month, hours per task and hours per day with a running total
+var SummaryTables = []string{"project_week", "project_month", "task", "running_total"}
+
+// CredentialSources are the places Google credentials can come from, in the
+// default order: configured ones first, then the environment, the keyring and
+// application default credentials
+var CredentialSources = []string{"helper", "file", "token", "env", "keyring", "adc"}
+
 func defaultConfig() *Config {
 	return &Config{
+		Version: CurrentVersion,
 		GoogleSheets: GoogleSheetsConfig{
-			Enabled: false,
+			SheetName:                "CraftTime",
+			CredentialsSources:       CredentialSources,
+			CredentialsHelperTimeout: 10 * time.Second,
+			CredentialsHelperFormat:  "keyvalue",
+			CredentialsCache:         "memory",
+			CredentialsCacheTTL:      time.Hour,
+			RequestsPerMinute:        60,
+			MaxRetries:               5,
+			Enabled:                  false,
+			Summary: SummaryConfig{
+				Enabled:   false,
+				SheetName: "Summary",
+				Tables:    SummaryTables,
+			},
 		},
 		Notifications: NotificationConfig{
 			Enabled:          true,
@@ -164,6 +252,10 @@ func (c *Config) expandPaths() error {
 		return fmt.Errorf("failed to get home directory: %w", err)
 	}
 
+	if strings.HasPrefix(c.GoogleSheets.CredentialsFile, "~/") {
+		c.GoogleSheets.CredentialsFile = filepath.Join(homeDir, c.GoogleSheets.CredentialsFile[2:])
+	}
+
 	if strings.HasPrefix(c.GoogleSheets.CredentialsHelper, "~/") {
 		c.GoogleSheets.CredentialsHelper = filepath.Join(homeDir, c.GoogleSheets.CredentialsHelper[2:])
 	}
@@ -179,30 +271,203 @@ func (c *Config) expandPaths() error {
 	return nil
 }
 
+// Warnings returns the deprecated keys found in the config file
+func (c *Config) Warnings() []string {
+	return c.warnings
+}
+
+// SyncTime returns how often the running session is synced to the sinks
+func (c *Config) SyncTime() time.Duration {
+	if c.GoogleSheets.SyncInterval > 0 {
+		return c.GoogleSheets.SyncInterval
+	}
+	return SessionSyncTime
+}
+
+// sheetNameData is what a sheet_name template can use
+type sheetNameData struct {
+	// Year is 2025, Month 03, MonthName March and Quarter Q1
+	Year, Month, MonthName, Quarter string
+}
+
+// maxSheetName is the longest tab name Google Sheets accepts
+const maxSheetName = 100
+
+// SheetTitle evaluates sheet_name for a session started at t, e.g.
+// "CraftTime {{.Year}}-{{.Month}}" gives "CraftTime 2025-03"
+func (g GoogleSheetsConfig) SheetTitle(t time.Time) (string, error) {
+	if !strings.Contains(g.SheetName, "{{") {
+		return g.SheetName, nil
+	}
+
+	tmpl, err := template.New("sheet_name").Option("missingkey=error").Parse(g.SheetName)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+	var name strings.Builder
+	err = tmpl.Execute(&name, sheetNameData{
+		Year:      t.Format("2006"),
+		Month:     t.Format("01"),
+		MonthName: t.Format("January"),
+		Quarter:   fmt.Sprintf("Q%d", (int(t.Month())-1)/3+1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+
+	title := strings.TrimSpace(name.String())
+	switch {
+	case title == "":
+		return "", fmt.Errorf("template gives an empty name")
+	case len([]rune(title)) > maxSheetName:
+		return "", fmt.Errorf("%q is longer than %d characters", title, maxSheetName)
+	}
+	return title, nil
+}
+
+// SheetPattern matches the tabs sheet_name gives for any date, e.g.
+// "CraftTime {{.Year}}" matches CraftTime 2024 and CraftTime 2025
+func (g GoogleSheetsConfig) SheetPattern() (*regexp.Regexp, error) {
+	if !strings.Contains(g.SheetName, "{{") {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(g.SheetName) + "$"), nil
+	}
+
+	tmpl, err := template.New("sheet_name").Option("missingkey=error").Parse(g.SheetName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	// every field is replaced by a marker that becomes a pattern
+	patterns := map[string]string{
+		"\x00Year\x00":      `\d{4}`,
+		"\x00Month\x00":     `\d{2}`,
+		"\x00MonthName\x00": `[A-Z][a-z]+`,
+		"\x00Quarter\x00":   `Q[1-4]`,
+	}
+	var name strings.Builder
+	err = tmpl.Execute(&name, sheetNameData{
+		Year:      "\x00Year\x00",
+		Month:     "\x00Month\x00",
+		MonthName: "\x00MonthName\x00",
+		Quarter:   "\x00Quarter\x00",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	pattern := regexp.QuoteMeta(strings.TrimSpace(name.String()))
+	for marker, p := range patterns {
+		pattern = strings.ReplaceAll(pattern, marker, p)
+	}
+	return regexp.Compile("^" + pattern + "$")
+}
+
+// Validate checks the whole config and returns every problem found as pkg.ValidationErrors
 func (c *Config) Validate() error {
+	var errs pkg.ValidationErrors
+
 	if c.GoogleSheets.Enabled {
 		// Check if credentials are available via helper or keyring
 		if c.GoogleSheets.SpreadsheetID == "" {
-			return pkg.NewValidationError("google_sheets.spreadsheet_id is required when Google Sheets is enabled")
+			errs = append(errs, pkg.NewValidationError("google_sheets.spreadsheet_id is required when Google Sheets is enabled"))
 		}
 
 		if c.GoogleSheets.SheetName == "" {
-			return pkg.NewValidationError("google_sheets.sheet_name is required when Google Sheets is enabled")
+			errs = append(errs, pkg.NewValidationError("google_sheets.sheet_name is required when Google Sheets is enabled"))
 		}
 	}
 
+	if _, err := c.GoogleSheets.SheetTitle(time.Now()); c.GoogleSheets.SheetName != "" && err != nil {
+		errs = append(errs, pkg.NewValidationError(fmt.Sprintf("google_sheets.sheet_name: %v", err)))
+	}
+
+	if c.GoogleSheets.SyncInterval < 0 {
+		errs = append(errs, pkg.NewValidationError("google_sheets.sync_interval must not be negative"))
+	}
+
+	seen := map[string]bool{}
+	for _, source := range c.GoogleSheets.CredentialsSources {
+		if !slices.Contains(CredentialSources, source) {
+			errs = append(errs, pkg.NewValidationError(fmt.Sprintf("google_sheets.credentials_sources: unknown source %q, must be one of: %s", source, strings.Join(CredentialSources, ", "))))
+		} else if seen[source] {
+			errs = append(errs, pkg.NewValidationError(fmt.Sprintf("google_sheets.credentials_sources: %s is listed twice", source)))
+		}
+		seen[source] = true
+	}
+	if len(c.GoogleSheets.CredentialsSources) == 0 {
+		errs = append(errs, pkg.NewValidationError("google_sheets.credentials_sources must list at least one source"))
+	}
+
+	if c.GoogleSheets.CredentialsHelperTimeout < 0 {
+		errs = append(errs, pkg.NewValidationError("google_sheets.credentials_helper_timeout must not be negative"))
+	}
+
+	if !slices.Contains([]string{"keyvalue", "json"}, c.GoogleSheets.CredentialsHelperFormat) {
+		errs = append(errs, pkg.NewValidationError("google_sheets.credentials_helper_format must be one of: keyvalue, json"))
+	}
+
+	if !slices.Contains([]string{"none", "memory", "keyring"}, c.GoogleSheets.CredentialsCache) {
+		errs = append(errs, pkg.NewValidationError("google_sheets.credentials_cache must be one of: none, memory, keyring"))
+	}
+
+	if c.GoogleSheets.CredentialsCacheTTL < 0 {
+		errs = append(errs, pkg.NewValidationError("google_sheets.credentials_cache_ttl must not be negative"))
+	}
+
+	if c.GoogleSheets.RequestsPerMinute < 0 {
+		errs = append(errs, pkg.NewValidationError("google_sheets.requests_per_minute must not be negative"))
+	}
+
+	if c.GoogleSheets.MaxRetries < 0 {
+		errs = append(errs, pkg.NewValidationError("google_sheets.max_retries must not be negative"))
+	}
+
+	if summary := c.GoogleSheets.Summary; summary.Enabled {
+		if summary.SheetName == "" {
+			errs = append(errs, pkg.NewValidationError("google_sheets.summary.sheet_name is required when the summary is enabled"))
+		} else if pattern, err := c.GoogleSheets.SheetPattern(); err == nil && pattern.MatchString(summary.SheetName) {
+			errs = append(errs, pkg.NewValidationError(fmt.Sprintf("google_sheets.summary.sheet_name %q is also a session tab of google_sheets.sheet_name", summary.SheetName)))
+		}
+		if len(summary.Tables) == 0 {
+			errs = append(errs, pkg.NewValidationError("google_sheets.summary.tables must list at least one table"))
+		}
+	}
+
+	seenTables := map[string]bool{}
+	for _, table := range c.GoogleSheets.Summary.Tables {
+		if !slices.Contains(SummaryTables, table) {
+			errs = append(errs, pkg.NewValidationError(fmt.Sprintf("google_sheets.summary.tables: unknown table %q, must be one of: %s", table, strings.Join(SummaryTables, ", "))))
+		} else if seenTables[table] {
+			errs = append(errs, pkg.NewValidationError(fmt.Sprintf("google_sheets.summary.tables: %s is listed twice", table)))
+		}
+		seenTables[table] = true
+	}
+
 	if c.CSV.Enabled {
 		if c.CSV.FilePath == "" {
-			return pkg.NewValidationError("csv.file_path is required when CSV is enabled")
+			errs = append(errs, pkg.NewValidationError("csv.file_path is required when CSV is enabled"))
 		}
 	}
 
+	if c.Notifications.ReminderInterval < 0 {
+		errs = append(errs, pkg.NewValidationError("notifications.reminder_interval must not be negative"))
+	}
+
 	validLevels := map[string]bool{
 		"trace": true, "debug": true, "info": true,
 		"warn": true, "error": true, "fatal": true, "panic": true,
 	}
 	if !validLevels[c.Logging.Level] {
-		return pkg.NewValidationError("logging.level must be one of: trace, debug, info, warn, error, fatal, panic")
+		errs = append(errs, pkg.NewValidationError("logging.level must be one of: trace, debug, info, warn, error, fatal, panic"))
+	}
+
+	for _, name := range c.ProfileNames() {
+		if c.Profiles[name].Rate < 0 {
+			errs = append(errs, pkg.NewValidationError(fmt.Sprintf("profiles.%s.rate must not be negative", name)))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
 	}
 	return nil
 }
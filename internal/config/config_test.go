@@ -0,0 +1,262 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/pkg"
+)
+
+func TestTemplate(t *testing.T) {
+	t.Run("config-template.yaml is up to date", func(t *testing.T) {
+		data, err := os.ReadFile("../../config-template.yaml")
+		if err != nil {
+			t.Fatalf("failed to read template: %v", err)
+		}
+		if string(data) != string(Template()) {
+			t.Error("config-template.yaml is out of date, run: go generate ./internal/config")
+		}
+	})
+
+	t.Run("every key is documented", func(t *testing.T) {
+		for _, f := range Fields() {
+			if f.Doc == "" {
+				t.Errorf("config key %s has no entry in fieldDocs", f.Path)
+			}
+		}
+	})
+
+	t.Run("template parses back to the defaults", func(t *testing.T) {
+		cfg, err := ParseConfig(Template())
+		if err != nil {
+			t.Fatalf("failed to parse template: %v", err)
+		}
+		if !reflect.DeepEqual(cfg, defaultConfig()) {
+			t.Errorf("expected defaults %+v, got %+v", defaultConfig(), cfg)
+		}
+	})
+}
+
+func TestValidateCollectsAllErrors(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.GoogleSheets.Enabled = true
+	cfg.GoogleSheets.SheetName = ""
+	cfg.CSV.Enabled = true
+	cfg.Logging.Level = "loud"
+
+	err := cfg.Validate()
+
+	var errs pkg.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected pkg.ValidationErrors, got %T: %v", err, err)
+	}
+	if len(errs) != 4 {
+		t.Errorf("expected 4 problems, got %d: %v", len(errs), err)
+	}
+
+	// each problem can be reached on its own
+	var first *pkg.ValidationError
+	if !errors.As(err, &first) || first != errs[0] {
+		t.Errorf("expected the first problem, got %v", first)
+	}
+}
+
+func TestSheetTitle(t *testing.T) {
+	start := time.Date(2025, 3, 31, 23, 50, 0, 0, time.Local)
+
+	tests := map[string]string{
+		"CraftTime":                                "CraftTime",
+		"CraftTime {{.Year}}-{{.Month}}":           "CraftTime 2025-03",
+		"{{.MonthName}} {{.Year}}":                 "March 2025",
+		"Log {{.Year}} {{.Quarter}}":               "Log 2025 Q1",
+		"{{if eq .Month \"12\"}}December{{end}} x": "x",
+	}
+	for sheetName, want := range tests {
+		got, err := GoogleSheetsConfig{SheetName: sheetName}.SheetTitle(start)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", sheetName, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", sheetName, want, got)
+		}
+	}
+
+	for _, sheetName := range []string{"{{.Year", "{{.Day}}", "{{if false}}x{{end}}", strings.Repeat("{{.Year}}", 30)} {
+		cfg := defaultConfig()
+		cfg.GoogleSheets.SheetName = sheetName
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "google_sheets.sheet_name") {
+			t.Errorf("%s: expected a sheet_name error, got: %v", sheetName, err)
+		}
+	}
+}
+
+func TestSheetPattern(t *testing.T) {
+	tests := []struct {
+		sheetName string
+		match     []string
+		noMatch   []string
+	}{
+		{"CraftTime", []string{"CraftTime"}, []string{"CraftTime 2025", "Summary"}},
+		{"CraftTime {{.Year}}-{{.Month}}", []string{"CraftTime 2025-03", "CraftTime 2024-12"}, []string{"CraftTime 2025", "CraftTime 2025-3", "Summary"}},
+		{"{{.MonthName}} ({{.Year}})", []string{"March (2025)"}, []string{"March 2025"}},
+	}
+	for _, tt := range tests {
+		pattern, err := GoogleSheetsConfig{SheetName: tt.sheetName}.SheetPattern()
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", tt.sheetName, err)
+		}
+		for _, name := range tt.match {
+			if !pattern.MatchString(name) {
+				t.Errorf("%s: expected %q to match", tt.sheetName, name)
+			}
+		}
+		for _, name := range tt.noMatch {
+			if pattern.MatchString(name) {
+				t.Errorf("%s: expected %q not to match", tt.sheetName, name)
+			}
+		}
+	}
+
+	t.Run("summary tab must not be a session tab", func(t *testing.T) {
+		cfg := defaultConfig()
+		cfg.GoogleSheets.SheetName = "Craft {{.Year}}"
+		cfg.GoogleSheets.Summary.Enabled = true
+		cfg.GoogleSheets.Summary.SheetName = "Craft 2025"
+		cfg.GoogleSheets.Summary.Tables = []string{"task", "weekly", "task"}
+
+		err := cfg.Validate()
+		var errs pkg.ValidationErrors
+		if !errors.As(err, &errs) || len(errs) != 3 {
+			t.Errorf("expected 3 problems, got: %v", err)
+		}
+	})
+}
+
+func TestGetSet(t *testing.T) {
+	cfg := defaultConfig()
+
+	if err := cfg.Set("notifications.reminder_interval", "30m"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if got, _ := cfg.Get("notifications.reminder_interval"); got != "30m" {
+		t.Errorf("expected 30m, got %q", got)
+	}
+
+	if err := cfg.Set("csv.enabled", "maybe"); err == nil {
+		t.Error("expected error for invalid boolean, got nil")
+	}
+	if err := cfg.Set("csv.file", "x"); err == nil {
+		t.Error("expected error for unknown key, got nil")
+	}
+}
+
+func TestSetInFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "craftie.yaml")
+	content := `# my craftie setup
+csv:
+  # where my sessions go
+  enabled: false
+  file_path: "/tmp/sessions.csv"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	t.Run("keeps comments", func(t *testing.T) {
+		if err := SetInFile(path, "csv.enabled", "true"); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		data, _ := os.ReadFile(path)
+		if !strings.Contains(string(data), "# where my sessions go") {
+			t.Errorf("expected comments to be kept, got:\n%s", data)
+		}
+
+		cfg, err := ReadConfig(path)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+		if !cfg.CSV.Enabled {
+			t.Error("expected csv.enabled to be true")
+		}
+	})
+
+	t.Run("creates missing sections", func(t *testing.T) {
+		if err := SetInFile(path, "logging.level", "debug"); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		cfg, err := ReadConfig(path)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+		if cfg.Logging.Level != "debug" {
+			t.Errorf("expected logging.level debug, got %q", cfg.Logging.Level)
+		}
+	})
+
+	t.Run("refuses invalid result", func(t *testing.T) {
+		before, _ := os.ReadFile(path)
+
+		if err := SetInFile(path, "csv.file_path", ""); err == nil {
+			t.Fatal("expected validation error, got nil")
+		}
+
+		after, _ := os.ReadFile(path)
+		if string(before) != string(after) {
+			t.Error("expected file to be left untouched")
+		}
+	})
+}
+
+func TestStrictParsing(t *testing.T) {
+	data := []byte(`google_sheet:
+  enabled: true
+csv:
+  enabled: yes please
+  file-path: "~/sessions.csv"
+notifications:
+  reminder_interval: soon
+`)
+
+	_, _, err := parseConfig("craftie.yaml", data)
+
+	var errs pkg.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected pkg.ValidationErrors, got %T: %v", err, err)
+	}
+
+	expected := []struct {
+		line, column int
+		contains     string
+	}{
+		{1, 1, "did you mean google_sheets?"},
+		{4, 12, "csv.enabled must be true or false"},
+		{5, 3, "did you mean csv.file_path?"},
+		{7, 22, "notifications.reminder_interval must be a duration"},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d problems, got %d: %v", len(expected), len(errs), err)
+	}
+	for i, e := range expected {
+		if errs[i].File != "craftie.yaml" || errs[i].Line != e.line || errs[i].Column != e.column {
+			t.Errorf("expected problem %d at craftie.yaml:%d:%d, got %s:%d:%d", i, e.line, e.column, errs[i].File, errs[i].Line, errs[i].Column)
+		}
+		if !strings.Contains(errs[i].Message, e.contains) {
+			t.Errorf("expected problem %d to contain %q, got %q", i, e.contains, errs[i].Message)
+		}
+	}
+}
+
+func TestSuggestKeyFromOtherSection(t *testing.T) {
+	_, err := ParseConfig([]byte("file_path: sessions.csv\n"))
+	if err == nil || !strings.Contains(err.Error(), "did you mean csv.file_path?") {
+		t.Errorf("expected suggestion for csv.file_path, got: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetInFile sets the key at path to value in the config file at cfgPath.
+// Comments and layout of the file are kept. The file is only written when
+// the resulting config is valid.
+func SetInFile(cfgPath, path, value string) error {
+	f, ok := LookupField(path)
+	if !ok {
+		return fmt.Errorf("unknown config key %q", path)
+	}
+
+	// Parse the value by the type of the key before touching the file
+	probe := defaultConfig()
+	if err := probe.Set(path, value); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	updated, err := setInYaml(data, path, valueNode(reflect.ValueOf(probe).Elem().FieldByIndex(f.index)))
+	if err != nil {
+		return err
+	}
+
+	cfg, err := ParseConfig(updated)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	return WriteConfigFile(cfgPath, updated)
+}
+
+// setInYaml replaces the node at path in the yaml document, creating missing mappings
+func setInYaml(data []byte, path string, value *yaml.Node) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	node := doc.Content[0]
+	keys := strings.Split(path, ".")
+	for i, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("cannot set %q: %s is not a mapping", path, strings.Join(keys[:i], "."))
+		}
+
+		var child *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == key {
+				child = node.Content[j+1]
+				break
+			}
+		}
+
+		last := i == len(keys)-1
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			if last {
+				child = value
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+		} else if last {
+			// keep comments attached to the old value
+			value.HeadComment, value.LineComment, value.FootComment = child.HeadComment, child.LineComment, child.FootComment
+			*child = *value
+		}
+		node = child
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// valueNode renders a config value the same way config-template.yaml does
+func valueNode(v reflect.Value) *yaml.Node {
+	if v.Kind() == reflect.Slice {
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < v.Len(); i++ {
+			node.Content = append(node.Content, valueNode(v.Index(i)))
+		}
+		return node
+	}
+
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: formatValue(v)}
+	if v.Kind() == reflect.String || v.Type() == durationType {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	return node
+}
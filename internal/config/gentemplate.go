@@ -0,0 +1,22 @@
+//go:build ignore
+
+// gentemplate writes config-template.yaml from the config schema, so the
+// template cannot drift from Config. Run with: go generate ./internal/config
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/vlad/craftie/internal/config"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run gentemplate.go <output file>")
+	}
+
+	if err := os.WriteFile(os.Args[1], config.Template(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vlad/craftie/internal/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config file version written by this craftie.
+// Files without a version: key are version 1.
+const CurrentVersion = 2
+
+// rename is a key that moved within its section
+type rename struct {
+	from, to string
+}
+
+// migration upgrades a config file to version to
+type migration struct {
+	to      int
+	renames []rename
+}
+
+// migrations is the upgrade chain, in order. Renamed keys keep working with
+// a deprecation warning until the file is migrated.
+var migrations = []migration{
+	{
+		// sync_interval was written as syncinterval before it had a yaml tag
+		to:      2,
+		renames: []rename{{"google_sheets.syncinterval", "google_sheets.sync_interval"}},
+	},
+}
+
+// textEdit replaces old at line:column of the file with new. Line 0 inserts
+// new after the leading comment, remove drops the whole line.
+type textEdit struct {
+	line, column int
+	old, new     string
+	remove       bool
+}
+
+// migrationResult is what migrate changed in a document
+type migrationResult struct {
+	from     int
+	warnings []string
+	edits    []textEdit
+}
+
+// migrate upgrades doc to CurrentVersion in place
+func migrate(file string, doc *yaml.Node) (*migrationResult, error) {
+	result := &migrationResult{from: 1}
+	if doc.Kind == 0 || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		result.from = CurrentVersion
+		return result, nil
+	}
+	root := doc.Content[0]
+
+	versionKey, versionValue := lookupKey(root, "version")
+	if versionValue != nil {
+		version, err := strconv.Atoi(versionValue.Value)
+		if err != nil || version < 1 {
+			return nil, pkg.ValidationErrors{pkg.NewValidationErrorAt(file, versionValue.Line, versionValue.Column,
+				fmt.Sprintf("version must be a positive integer, got %q", versionValue.Value))}
+		}
+		if version > CurrentVersion {
+			return nil, pkg.ValidationErrors{pkg.NewValidationErrorAt(file, versionValue.Line, versionValue.Column,
+				fmt.Sprintf("config version %d is newer than this craftie supports (%d), please upgrade craftie", version, CurrentVersion))}
+		}
+		result.from = version
+	}
+
+	for _, m := range migrations {
+		if m.to <= result.from {
+			continue
+		}
+		for _, r := range m.renames {
+			result.rename(file, root, r)
+		}
+	}
+
+	if result.from == CurrentVersion {
+		return result, nil
+	}
+
+	version := strconv.Itoa(CurrentVersion)
+	if versionValue != nil {
+		column := versionValue.Column
+		if versionValue.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+			column++
+		}
+		result.edits = append(result.edits, textEdit{line: versionValue.Line, column: column, old: versionValue.Value, new: version})
+		versionValue.Value = version
+		return result, nil
+	}
+
+	versionKey = &yaml.Node{Kind: yaml.ScalarNode, Value: "version"}
+	versionValue = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: version}
+	root.Content = append([]*yaml.Node{versionKey, versionValue}, root.Content...)
+	result.edits = append(result.edits, textEdit{new: versionBlock()})
+	return result, nil
+}
+
+// rename moves the key r.from to r.to, a key already written under the new
+// name wins
+func (result *migrationResult) rename(file string, root *yaml.Node, r rename) {
+	section, oldName := splitPath(r.from)
+	_, newName := splitPath(r.to)
+
+	parent := root
+	if section != "" {
+		_, parent = lookupKey(root, section)
+		if parent == nil || parent.Kind != yaml.MappingNode {
+			return
+		}
+	}
+
+	key, value := lookupKey(parent, oldName)
+	if key == nil {
+		return
+	}
+	position := fmt.Sprintf("%s:%d:%d", displayName(file), key.Line, key.Column)
+
+	if existing, _ := lookupKey(parent, newName); existing != nil {
+		result.warnings = append(result.warnings, fmt.Sprintf("%s: %s is deprecated and ignored because %s is set, remove it", position, r.from, r.to))
+		for i := 0; i+1 < len(parent.Content); i += 2 {
+			if parent.Content[i] == key {
+				parent.Content = slices.Delete(parent.Content, i, i+2)
+				break
+			}
+		}
+		// renamed keys hold scalars, the whole key sits on one line
+		if value.Line == key.Line {
+			result.edits = append(result.edits, textEdit{line: key.Line, remove: true})
+		}
+		return
+	}
+
+	result.warnings = append(result.warnings, fmt.Sprintf("%s: %s is deprecated, use %s (run `craftie config migrate` to update the file)", position, r.from, r.to))
+	result.edits = append(result.edits, textEdit{line: key.Line, column: key.Column, old: oldName, new: newName})
+	key.Value = newName
+}
+
+func lookupKey(mapping *yaml.Node, name string) (key, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == name {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func splitPath(path string) (section, name string) {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return "", path
+}
+
+// versionBlock is how version: is written by Render
+func versionBlock() string {
+	return fmt.Sprintf("\n# %s\nversion: %d\n", fieldDocs["version"], CurrentVersion)
+}
+
+// MigrateFile upgrades the config file at cfgPath to CurrentVersion. It returns
+// the version the file had and the migrated contents, comments and layout are
+// kept. Nothing is written.
+func MigrateFile(cfgPath string) (from int, migrated []byte, err error) {
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return 0, nil, pkg.ValidationErrors{pkg.NewValidationError(fmt.Sprintf("%s: %v", cfgPath, err))}
+	}
+	result, err := migrate(cfgPath, &doc)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	migrated, err = applyEdits(data, result.edits)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The migrated file has to be a valid config on its own
+	if _, _, err := parseConfig(cfgPath, migrated); err != nil {
+		return 0, nil, err
+	}
+	return result.from, migrated, nil
+}
+
+// applyEdits applies edits to the file text, so comments and blank lines survive
+func applyEdits(data []byte, edits []textEdit) ([]byte, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+
+	for _, e := range edits {
+		if e.line == 0 {
+			i := insertionLine(lines)
+			text := e.new
+			if i == 0 {
+				// no leading comment, the blank line goes after the inserted text
+				text = strings.TrimPrefix(text, "\n") + "\n"
+			}
+			lines[i] = text + lines[i]
+			continue
+		}
+
+		if e.remove {
+			// lines stay at their index, so later edits still find theirs
+			lines[e.line-1] = ""
+			continue
+		}
+
+		line := lines[e.line-1]
+		start := e.column - 1
+		if start+len(e.old) > len(line) || line[start:start+len(e.old)] != e.old {
+			return nil, fmt.Errorf("failed to migrate line %d: expected %q at column %d", e.line, e.old, e.column)
+		}
+		lines[e.line-1] = line[:start] + e.new + line[start+len(e.old):]
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// insertionLine is the line after the leading comment block, where version: goes
+func insertionLine(lines []string) int {
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Run("renamed key works with a warning", func(t *testing.T) {
+		cfg, err := ParseConfig([]byte("google_sheets:\n  syncinterval: 5m\n"))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if cfg.GoogleSheets.SyncInterval.String() != "5m0s" {
+			t.Errorf("expected sync_interval 5m, got %s", cfg.GoogleSheets.SyncInterval)
+		}
+		if len(cfg.Warnings()) != 1 || !strings.Contains(cfg.Warnings()[0], "google_sheets.syncinterval is deprecated") {
+			t.Errorf("expected a deprecation warning, got %v", cfg.Warnings())
+		}
+	})
+
+	t.Run("new key wins over the renamed one", func(t *testing.T) {
+		cfg, err := ParseConfig([]byte("google_sheets:\n  syncinterval: 5m\n  sync_interval: 1m\n"))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if cfg.GoogleSheets.SyncInterval.String() != "1m0s" {
+			t.Errorf("expected sync_interval 1m, got %s", cfg.GoogleSheets.SyncInterval)
+		}
+	})
+
+	t.Run("renamed key is unknown in a current file", func(t *testing.T) {
+		if _, err := ParseConfig([]byte("version: 2\ngoogle_sheets:\n  syncinterval: 5m\n")); err == nil {
+			t.Error("expected unknown key error, got nil")
+		}
+	})
+
+	t.Run("newer version is refused", func(t *testing.T) {
+		_, err := ParseConfig([]byte("version: 99\n"))
+		if err == nil || !strings.Contains(err.Error(), "please upgrade craftie") {
+			t.Errorf("expected version error, got: %v", err)
+		}
+	})
+}
+
+func TestMigrateFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("keeps comments and layout", func(t *testing.T) {
+		path := filepath.Join(dir, "commented.yaml")
+		content := "# my setup\n\ngoogle_sheets:\n  # how often\n  syncinterval: 5m\n\ncsv:\n  enabled: false\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		from, migrated, err := MigrateFile(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if from != 1 {
+			t.Errorf("expected version 1, got %d", from)
+		}
+
+		expected := "# my setup\n" + versionBlock() + "\ngoogle_sheets:\n  # how often\n  sync_interval: 5m\n\ncsv:\n  enabled: false\n"
+		if string(migrated) != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, migrated)
+		}
+	})
+
+	t.Run("version goes first without a leading comment", func(t *testing.T) {
+		path := filepath.Join(dir, "bare.yaml")
+		if err := os.WriteFile(path, []byte("csv:\n  enabled: false\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		_, migrated, err := MigrateFile(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if !strings.HasPrefix(string(migrated), "# Config file version") || !strings.HasSuffix(string(migrated), "version: 2\n\ncsv:\n  enabled: false\n") {
+			t.Errorf("unexpected migrated file:\n%s", migrated)
+		}
+	})
+
+	t.Run("template is current", func(t *testing.T) {
+		path := filepath.Join(dir, "template.yaml")
+		if err := os.WriteFile(path, Template(), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		from, migrated, err := MigrateFile(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if from != CurrentVersion || string(migrated) != string(Template()) {
+			t.Errorf("expected template to be left as is, got version %d", from)
+		}
+	})
+}
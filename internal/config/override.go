@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vlad/craftie/internal/pkg"
+)
+
+// Source tells where a config value came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceProject Source = "project"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Sources maps each config key to the source of its value
+type Sources map[string]Source
+
+// Origin describes where the value of the key at path came from,
+// e.g. "env CRAFTIE_CSV_FILE_PATH"
+func (s Sources) Origin(path string) string {
+	switch source := s[path]; source {
+	case SourceEnv:
+		return "env " + EnvName(path)
+	case SourceFlag:
+		return "flag --" + FlagName(path)
+	case SourceProject:
+		return "project " + ProjectFileName
+	case "":
+		return string(SourceDefault)
+	default:
+		return string(source)
+	}
+}
+
+// Overrides are config values set outside the config file, keyed by path
+type Overrides map[string]string
+
+// EnvName is the environment variable overriding the key at path,
+// csv.file_path becomes CRAFTIE_CSV_FILE_PATH
+func EnvName(path string) string {
+	return "CRAFTIE_" + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// FlagName is the global flag overriding the key at path,
+// csv.file_path becomes csv-file-path
+func FlagName(path string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(path)
+}
+
+// EnvOverrides collects the CRAFTIE_* environment variables named after config keys
+func EnvOverrides() Overrides {
+	overrides := Overrides{}
+	for _, f := range Fields() {
+		if value, ok := os.LookupEnv(EnvName(f.Path)); ok {
+			overrides[f.Path] = value
+		}
+	}
+	return overrides
+}
+
+// Overlay is what Resolve layers over the config file
+type Overlay struct {
+	// Project is the .craftie.yaml of the session, may be nil
+	Project *ProjectFile
+	// Profile is the profile chosen with --profile, see ProfileName
+	Profile string
+	// NoProfile makes Profile final, CRAFTIE_PROFILE and the project file's
+	// profile are not looked at
+	NoProfile bool
+	// Flags are config values set with global flags
+	Flags Overrides
+}
+
+// Resolve reads the config file at cfgPath, if there is one, and layers the
+// active profile, the project file, the CRAFTIE_* environment variables and
+// then flags on top of it. Precedence is
+// flag > env > project > profile > file > default.
+// The result is not validated.
+func Resolve(cfgPath string, overlay Overlay) (*Config, Sources, error) {
+	data, err := os.ReadFile(cfgPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config, sources, err := parseConfig(cfgPath, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile := ProfileName(overlay.Profile, overlay.Project)
+	if overlay.NoProfile {
+		profile = overlay.Profile
+	}
+	if err := config.applyProfile(cfgPath, profile, sources); err != nil {
+		return nil, nil, err
+	}
+
+	if err := overlay.Project.apply(config, sources); err != nil {
+		return nil, nil, err
+	}
+
+	var errs pkg.ValidationErrors
+	errs = append(errs, config.apply(EnvOverrides(), SourceEnv, sources)...)
+	errs = append(errs, config.apply(overlay.Flags, SourceFlag, sources)...)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	if err := config.expandPaths(); err != nil {
+		return nil, nil, fmt.Errorf("failed to expand paths: %w", err)
+	}
+
+	return config, sources, nil
+}
+
+// apply sets every override on c and records source for it, returning
+// a problem for each value that does not parse
+func (c *Config) apply(overrides Overrides, source Source, sources Sources) pkg.ValidationErrors {
+	var errs pkg.ValidationErrors
+	for _, f := range Fields() {
+		value, ok := overrides[f.Path]
+		if !ok {
+			continue
+		}
+		sources[f.Path] = source
+
+		if err := c.Set(f.Path, value); err != nil {
+			errs = append(errs, pkg.NewValidationError(fmt.Sprintf("%s: %v", sources.Origin(f.Path), err)))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "craftie.yaml")
+	content := `csv:
+  enabled: true
+  file_path: "/tmp/file.csv"
+logging:
+  level: warn
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	t.Setenv("CRAFTIE_CSV_FILE_PATH", "/tmp/env.csv")
+	t.Setenv("CRAFTIE_LOGGING_LEVEL", "debug")
+
+	cfg, sources, err := Resolve(path, Overlay{Flags: Overrides{"logging.level": "error"}})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	expected := []struct {
+		path, value, origin string
+	}{
+		{"notifications.reminder_interval", "15m", "default"},
+		{"csv.enabled", "true", "file"},
+		{"csv.file_path", "/tmp/env.csv", "env CRAFTIE_CSV_FILE_PATH"},
+		{"logging.level", "error", "flag --logging-level"},
+	}
+	for _, e := range expected {
+		if got, _ := cfg.Get(e.path); got != e.value {
+			t.Errorf("expected %s = %q, got %q", e.path, e.value, got)
+		}
+		if got := sources.Origin(e.path); got != e.origin {
+			t.Errorf("expected %s from %q, got %q", e.path, e.origin, got)
+		}
+	}
+}
+
+func TestResolveInvalidOverride(t *testing.T) {
+	t.Setenv("CRAFTIE_CSV_ENABLED", "maybe")
+
+	_, _, err := Resolve(filepath.Join(t.TempDir(), "missing.yaml"), Overlay{Flags: Overrides{"notifications.reminder_interval": "soon"}})
+	if err == nil {
+		t.Fatal("expected error for invalid overrides, got nil")
+	}
+	for _, want := range []string{"env CRAFTIE_CSV_ENABLED", "flag --notifications-reminder-interval"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got: %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/vlad/craftie/internal/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// SourceProfile marks values set by the active profile
+const SourceProfile Source = "profile"
+
+// Profile is a named set of sinks and a rate, e.g. for a side business.
+// Only the keys written in the profile override the top level config.
+type Profile struct {
+	GoogleSheets GoogleSheetsConfig `yaml:"google_sheets" mapstructure:"google_sheets"`
+	CSV          CSVConfig          `yaml:"csv" mapstructure:"csv"`
+	// Rate is the hourly rate of sessions logged under the profile
+	Rate float64 `yaml:"rate" mapstructure:"rate"`
+
+	// node is the profile as written in the config file
+	node *yaml.Node
+}
+
+func (p *Profile) UnmarshalYAML(node *yaml.Node) error {
+	type plain Profile
+	if err := node.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	p.node = node
+	return nil
+}
+
+// MarshalYAML writes the profile back as it was written, not with every key
+func (p Profile) MarshalYAML() (any, error) {
+	if p.node != nil {
+		return p.node, nil
+	}
+	type plain Profile
+	return plain(p), nil
+}
+
+// ProfileName picks the profile: the --profile flag, then CRAFTIE_PROFILE,
+// then the profile of the project file. Empty means no profile.
+func ProfileName(flag string, project *ProjectFile) string {
+	if flag != "" {
+		return flag
+	}
+	if name := os.Getenv("CRAFTIE_PROFILE"); name != "" {
+		return name
+	}
+	if project != nil {
+		return project.Profile
+	}
+	return ""
+}
+
+// ProfileNames lists the profiles defined in the config, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// applyProfile layers the profile called name over the google_sheets and
+// csv sections and makes it the active profile
+func (c *Config) applyProfile(file, name string, sources Sources) error {
+	if name == "" {
+		return nil
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		available := "no profiles are defined"
+		if len(c.Profiles) > 0 {
+			available = "available: " + strings.Join(c.ProfileNames(), ", ")
+		}
+		return pkg.ValidationErrors{pkg.NewValidationError(fmt.Sprintf("unknown profile %q (%s)", name, available))}
+	}
+
+	if profile.node != nil {
+		set := Sources{}
+		layered := Profile{GoogleSheets: c.GoogleSheets, CSV: c.CSV}
+		if err := decodeNode(file, profile.node, &layered, set); err != nil {
+			return err
+		}
+		c.GoogleSheets, c.CSV = layered.GoogleSheets, layered.CSV
+
+		for path := range set {
+			if _, ok := LookupField(path); ok {
+				sources[path] = SourceProfile
+			}
+		}
+	}
+
+	c.Profile = name
+	return nil
+}
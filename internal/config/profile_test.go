@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "craftie.yaml")
+	content := `csv:
+  enabled: true
+  file_path: "/tmp/personal.csv"
+profiles:
+  business:
+    rate: 40
+    csv:
+      file_path: "/tmp/business.csv"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	t.Run("only keys set in the profile override", func(t *testing.T) {
+		cfg, sources, err := Resolve(path, Overlay{Profile: "business"})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if cfg.Profile != "business" {
+			t.Errorf("expected active profile business, got %q", cfg.Profile)
+		}
+		if cfg.CSV.FilePath != "/tmp/business.csv" {
+			t.Errorf("expected csv.file_path from the profile, got %s", cfg.CSV.FilePath)
+		}
+		if !cfg.CSV.Enabled {
+			t.Error("expected csv.enabled to be kept from the top level")
+		}
+		if sources["csv.file_path"] != SourceProfile || sources["csv.enabled"] != SourceFile {
+			t.Errorf("unexpected sources: %v", sources)
+		}
+		if cfg.Profiles["business"].Rate != 40 {
+			t.Errorf("expected rate 40, got %v", cfg.Profiles["business"].Rate)
+		}
+	})
+
+	t.Run("CRAFTIE_PROFILE picks the profile", func(t *testing.T) {
+		t.Setenv("CRAFTIE_PROFILE", "business")
+
+		cfg, _, err := Resolve(path, Overlay{})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if cfg.Profile != "business" {
+			t.Errorf("expected active profile business, got %q", cfg.Profile)
+		}
+	})
+
+	t.Run("NoProfile ignores CRAFTIE_PROFILE", func(t *testing.T) {
+		t.Setenv("CRAFTIE_PROFILE", "business")
+
+		cfg, _, err := Resolve(path, Overlay{NoProfile: true})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if cfg.Profile != "" || cfg.CSV.FilePath != "/tmp/personal.csv" {
+			t.Errorf("expected the top level config, got profile %q and %s", cfg.Profile, cfg.CSV.FilePath)
+		}
+	})
+
+	t.Run("no profile keeps the top level", func(t *testing.T) {
+		cfg, _, err := Resolve(path, Overlay{})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if cfg.Profile != "" || cfg.CSV.FilePath != "/tmp/personal.csv" {
+			t.Errorf("expected the top level config, got profile %q and %s", cfg.Profile, cfg.CSV.FilePath)
+		}
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		_, _, err := Resolve(path, Overlay{Profile: "hobby"})
+		if err == nil || !strings.Contains(err.Error(), "available: business") {
+			t.Errorf("expected unknown profile error listing business, got: %v", err)
+		}
+	})
+
+	t.Run("rendered as written", func(t *testing.T) {
+		cfg, err := ReadConfig(path)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+		rendered, err := ParseConfig(Render(cfg))
+		if err != nil {
+			t.Fatalf("failed to parse rendered config: %v", err)
+		}
+		if _, ok := rendered.Profiles["business"]; !ok {
+			t.Error("expected the business profile to be rendered")
+		}
+	})
+}
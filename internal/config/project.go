@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vlad/craftie/internal/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the per-directory config file, found the way git finds .git
+const ProjectFileName = ".craftie.yaml"
+
+// ProjectFile is a .craftie.yaml. Besides session defaults it may set any
+// key of the user config, e.g. a different csv.file_path for the workspace.
+type ProjectFile struct {
+	Path string `yaml:"-"`
+
+	Project string   `yaml:"project"`
+	Task    string   `yaml:"task"`
+	Tags    []string `yaml:"tags"`
+	Rate    float64  `yaml:"rate"`
+	// Profile is used when none is chosen with --profile or CRAFTIE_PROFILE
+	Profile string `yaml:"profile"`
+
+	// doc holds the config keys, decoded over the user config by Resolve
+	doc *yaml.Node
+}
+
+// projectFileSchema is what a .craftie.yaml may contain
+type projectFileSchema struct {
+	ProjectFile `yaml:",inline"`
+	Config      `yaml:",inline"`
+}
+
+// FindProjectFile walks up from dir looking for a .craftie.yaml and loads
+// the first one found. Returns nil if there is none.
+func FindProjectFile(dir string) (*ProjectFile, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		if _, err := os.Stat(path); err == nil {
+			return LoadProjectFile(path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to check for %s: %w", ProjectFileName, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectFile reads the .craftie.yaml at path, rejecting unknown keys
+// and values of the wrong type
+func LoadProjectFile(path string) (*ProjectFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, pkg.ValidationErrors{pkg.NewValidationError(fmt.Sprintf("%s: %v", path, err))}
+	}
+
+	var schema projectFileSchema
+	if err := decodeNode(path, &doc, &schema, Sources{}); err != nil {
+		return nil, err
+	}
+
+	project := schema.ProjectFile
+	project.Path = path
+	project.doc = &doc
+	return &project, nil
+}
+
+// Dir returns the directory the project file is in
+func (p *ProjectFile) Dir() string {
+	return filepath.Dir(p.Path)
+}
+
+// apply decodes the config keys of the project file over c and marks them
+// as SourceProject. Relative paths are taken from the project directory.
+func (p *ProjectFile) apply(c *Config, sources Sources) error {
+	if p == nil || p.doc == nil {
+		return nil
+	}
+
+	set := Sources{}
+	layered := projectFileSchema{Config: *c}
+	if err := decodeNode(p.Path, p.doc, &layered, set); err != nil {
+		return err
+	}
+	*c = layered.Config
+
+	for path := range set {
+		if _, ok := LookupField(path); ok {
+			sources[path] = SourceProject
+		}
+	}
+
+	paths := map[string]*string{
+		"google_sheets.credentials_file":   &c.GoogleSheets.CredentialsFile,
+		"google_sheets.credentials_helper": &c.GoogleSheets.CredentialsHelper,
+		"csv.file_path":                    &c.CSV.FilePath,
+		"logging.output_file":              &c.Logging.OutputFile,
+	}
+	for key, value := range paths {
+		if set[key] == "" || *value == "" || filepath.IsAbs(*value) || strings.HasPrefix(*value, "~/") {
+			continue
+		}
+		*value = filepath.Join(p.Dir(), *value)
+	}
+	return nil
+}
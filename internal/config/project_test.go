@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindProjectFile(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "patterns", "winter")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("failed to create directories: %v", err)
+	}
+
+	content := `project: knitting
+task: sleeves
+tags: [wool, winter]
+rate: 42.5
+csv:
+  file_path: sessions.csv
+`
+	if err := os.WriteFile(filepath.Join(root, ProjectFileName), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write project file: %v", err)
+	}
+
+	t.Run("found from a subdirectory", func(t *testing.T) {
+		project, err := FindProjectFile(nested)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if project == nil {
+			t.Fatal("expected project file, got nil")
+		}
+		if project.Project != "knitting" || project.Task != "sleeves" || project.Rate != 42.5 {
+			t.Errorf("unexpected project defaults: %+v", project)
+		}
+		if !reflect.DeepEqual(project.Tags, []string{"wool", "winter"}) {
+			t.Errorf("expected tags [wool winter], got %v", project.Tags)
+		}
+	})
+
+	t.Run("merged over the user config", func(t *testing.T) {
+		cfgPath := filepath.Join(root, "craftie.yaml")
+		if err := os.WriteFile(cfgPath, []byte("csv:\n  enabled: true\n  file_path: /tmp/user.csv\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		project, err := FindProjectFile(nested)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		cfg, sources, err := Resolve(cfgPath, Overlay{Project: project})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if !cfg.CSV.Enabled {
+			t.Error("expected csv.enabled from the user config to be kept")
+		}
+		if want := filepath.Join(root, "sessions.csv"); cfg.CSV.FilePath != want {
+			t.Errorf("expected csv.file_path %s, got %s", want, cfg.CSV.FilePath)
+		}
+		if sources["csv.file_path"] != SourceProject {
+			t.Errorf("expected csv.file_path from the project file, got %s", sources.Origin("csv.file_path"))
+		}
+	})
+
+	t.Run("none outside a project", func(t *testing.T) {
+		project, err := FindProjectFile(t.TempDir())
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if project != nil {
+			t.Errorf("expected no project file, got %s", project.Path)
+		}
+	})
+}
+
+func TestProjectFileUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ProjectFileName)
+	if err := os.WriteFile(path, []byte("projcet: knitting\n"), 0644); err != nil {
+		t.Fatalf("failed to write project file: %v", err)
+	}
+
+	if _, err := LoadProjectFile(path); err == nil {
+		t.Error("expected error for unknown key, got nil")
+	}
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field describes one config key, e.g. csv.file_path
+type Field struct {
+	Path string
+	Type reflect.Type
+	Doc  string
+	// index is the reflect field index path from Config
+	index []int
+}
+
+// sectionDocs are written above each top level section of the template
+var sectionDocs = map[string]string{
+	"google_sheets":         "Google Sheets sink, rows are appended to a sheet tab",
+	"google_sheets.summary": "Summary tab with hours per project, week, month and task, built with\nformulas over every session tab",
+	"notifications":         "Desktop notifications sent by the daemon",
+	"csv":                   "CSV sink, rows are appended to a local file",
+	"profiles": `Named profiles, e.g. one per client or business, chosen with --profile,
+CRAFTIE_PROFILE or profile: in a .craftie.yaml. A profile overrides the
+google_sheets and csv keys it sets and gives its sessions an hourly rate.`,
+}
+
+// profilesExample is written, commented out, when no profiles are defined
+const profilesExample = `profiles:
+  business:
+    rate: 40
+    google_sheets:
+      enabled: true
+      spreadsheet_id: "1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"
+    csv:
+      file_path: "~/.craftie/business.csv"`
+
+// fieldDocs document every config key, they end up in config-template.yaml
+var fieldDocs = map[string]string{
+	"version":                                  "Config file version, upgraded by `craftie config migrate`",
+	"google_sheets.spreadsheet_id":             "Google Sheets spreadsheet ID (found in the URL)\nExample: \"1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms\"",
+	"google_sheets.sheet_name":                 "Name of the sheet/tab to write to, created when missing\nA template gives a tab per month or year, filled from the session's start:\n{{.Year}}, {{.Month}} (01-12), {{.MonthName}} and {{.Quarter}} (Q1-Q4)\nExample: \"CraftTime {{.Year}}-{{.Month}}\"",
+	"google_sheets.credentials_sources":        "Where Google credentials are looked for, in order. A source that is not set up\nis skipped: helper (credentials_helper), file (credentials_file), token\n(GOOGLE_OAUTH_ACCESS_TOKEN or access_token_command), env (GOOGLE_APPLICATION_CREDENTIALS),\nkeyring (craftie auth login/set) and adc (gcloud application default credentials)",
+	"google_sheets.credentials_file":           "Path to a Google credentials JSON file, e.g. a service account key\nExample: \"~/.craftie/service-account.json\"",
+	"google_sheets.credentials_helper":         "Credentials helper command, arguments are allowed. It is run with get, store\nor erase and prints Google credentials JSON for get\nExample: \"~/.craftie/get-credentials.sh --vault work\"",
+	"google_sheets.credentials_helper_timeout": "How long the credentials helper may take, 0 means no limit\nValid units: ns, us, ms, s, m, h",
+	"google_sheets.credentials_helper_format":  "How the request is written to the helper's stdin: keyvalue or json",
+	"google_sheets.credentials_cache":          "Where credentials from the helper are cached: none, memory or keyring",
+	"google_sheets.access_token_command":       "Command printing an OAuth access token, used by the token source\nExample: \"gcloud auth print-access-token\"",
+	"google_sheets.credentials_cache_ttl":      "How long cached helper credentials are used\nValid units: ns, us, ms, s, m, h",
+	"google_sheets.sync_interval":              "How often the running session is synced, 0 means every 10 minutes\nValid units: ns, us, ms, s, m, h",
+	"google_sheets.requests_per_minute":        "How many Sheets API calls craftie makes per minute at most, 0 means no limit\nGoogle allows 60 write requests per minute and user by default",
+	"google_sheets.max_retries":                "How often a call refused with 429 (quota), or with 503 (unavailable) when it can be repeated safely, is retried\nThe wait doubles every time, with some jitter",
+	"google_sheets.enabled":                    "Enable/disable Google Sheets integration",
+	"google_sheets.summary.enabled":            "Keep the summary tab up to date, it is refreshed after every finished session",
+	"google_sheets.summary.sheet_name":         "Name of the summary tab, it is overwritten by craftie",
+	"google_sheets.summary.tables":             "Tables on the summary tab, left to right: project_week, project_month (hours\nper project per week or month), task (hours per task) and running_total\n(hours per day and in total)",
+	"notifications.enabled":                    "Enable/disable all notifications",
+	"notifications.reminder_interval":          "How often to show reminder notifications\nValid units: ns, us, ms, s, m, h",
+	"notifications.sound_enabled":              "Enable notification sounds",
+	"logging.level":                            "Log level: trace, debug, info, warn, error, fatal, panic",
+	"logging.output_file":                      "Path to log file (empty for stdout)\nExample: \"~/.craftie/craftie.log\"",
+	"csv.enabled":                              "Enable/disable CSV export",
+	"csv.file_path":                            "Path to CSV file for session export\nExample: \"~/.craftie/sessions.csv\"",
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Fields lists every config key in the order they appear in Config
+func Fields() []Field {
+	return collectFields(reflect.TypeOf(Config{}), "", nil)
+}
+
+func collectFields(t reflect.Type, prefix string, index []int) []Field {
+	var fields []Field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := yamlName(sf)
+		// profiles are not single keys, they are written by hand, and
+		// version is managed by migrations
+		if name == "" || sf.Type.Kind() == reflect.Map || name == "version" {
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			fields = append(fields, collectFields(sf.Type, path, fieldIndex)...)
+			continue
+		}
+
+		fields = append(fields, Field{Path: path, Type: sf.Type, Doc: fieldDocs[path], index: fieldIndex})
+	}
+	return fields
+}
+
+// yamlName returns the key a struct field is stored under, or "" if it is skipped
+func yamlName(sf reflect.StructField) string {
+	if !sf.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(sf.Name)
+	}
+	return name
+}
+
+// LookupField returns the field stored under path
+func LookupField(path string) (Field, bool) {
+	for _, f := range Fields() {
+		if f.Path == path {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Get returns the value of the key at path formatted the way it is written in yaml
+func (c *Config) Get(path string) (string, error) {
+	f, ok := LookupField(path)
+	if !ok {
+		return "", fmt.Errorf("unknown config key %q", path)
+	}
+	return formatValue(reflect.ValueOf(c).Elem().FieldByIndex(f.index)), nil
+}
+
+// Set parses value according to the type of the key at path and stores it
+func (c *Config) Set(path, value string) error {
+	f, ok := LookupField(path)
+	if !ok {
+		return fmt.Errorf("unknown config key %q", path)
+	}
+	return parseValue(reflect.ValueOf(c).Elem().FieldByIndex(f.index), value)
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return formatDuration(time.Duration(v.Int()))
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// formatDuration drops the zero units time.Duration.String adds, 15m0s becomes 15m
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func parseValue(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (use format like 2h, 30m, 1h30m)", value)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (use true or false)", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		items := []string{}
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := parseValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
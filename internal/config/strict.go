@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+
+	"github.com/vlad/craftie/internal/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeNode decodes a parsed document or mapping into out, rejecting unknown
+// keys and values of the wrong type. Every problem is reported with its line
+// and column. Keys found are marked as SourceFile in sources, fields of out
+// that are not in node keep their value.
+func decodeNode(file string, node *yaml.Node, out any, sources Sources) error {
+	if node.Kind == yaml.DocumentNode || node.Kind == 0 {
+		// empty file, nothing to decode
+		if len(node.Content) == 0 {
+			return nil
+		}
+		node = node.Content[0]
+	}
+
+	c := checker{file: file, sources: sources}
+	c.check(node, reflect.TypeOf(out).Elem(), "")
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+
+	if err := node.Decode(out); err != nil {
+		return pkg.ValidationErrors{pkg.NewValidationError(fmt.Sprintf("%s: %v", displayName(file), err))}
+	}
+	return nil
+}
+
+func displayName(file string) string {
+	if file == "" {
+		return "config"
+	}
+	return file
+}
+
+type checker struct {
+	file    string
+	errs    pkg.ValidationErrors
+	sources Sources
+}
+
+func (c *checker) errorf(node *yaml.Node, format string, args ...any) {
+	c.errs = append(c.errs, pkg.NewValidationErrorAt(c.file, node.Line, node.Column, fmt.Sprintf(format, args...)))
+}
+
+// check walks node alongside the Go type it is decoded into
+func (c *checker) check(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	// null leaves the default in place
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && t != durationType:
+		c.checkMapping(node, t, path)
+	case t.Kind() == reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			c.errorf(node, "%s must be a mapping", path)
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			c.check(node.Content[i+1], t.Elem(), path+"."+node.Content[i].Value)
+		}
+	case t.Kind() == reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			c.errorf(node, "%s must be a list", path)
+			return
+		}
+		for _, item := range node.Content {
+			c.check(item, t.Elem(), path)
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			c.errorf(node, "%s must be %s", path, typeName(t))
+			return
+		}
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			c.errorf(node, "%s must be %s, got %q", path, typeName(t), node.Value)
+		}
+	}
+}
+
+func (c *checker) checkMapping(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind != yaml.MappingNode {
+		name := path
+		if name == "" {
+			name = "config"
+		}
+		c.errorf(node, "%s must be a mapping", name)
+		return
+	}
+
+	fields := mappingFields(t)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		keyPath := joinPath(path, key.Value)
+
+		fieldType, ok := fields[key.Value]
+		if !ok {
+			msg := fmt.Sprintf("unknown key %q", keyPath)
+			if suggestion := suggestKey(path, key.Value, fields); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean %s?)", suggestion)
+			}
+			c.errorf(key, "%s", msg)
+			continue
+		}
+
+		if fieldType.Kind() != reflect.Struct || fieldType == durationType {
+			c.sources[keyPath] = SourceFile
+		}
+		c.check(value, fieldType, keyPath)
+	}
+}
+
+// mappingFields returns the keys of a struct, including those of inlined structs
+func mappingFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if strings.HasSuffix(sf.Tag.Get("yaml"), ",inline") {
+			maps.Copy(fields, mappingFields(sf.Type))
+			continue
+		}
+		if name := yamlName(sf); name != "" {
+			fields[name] = sf.Type
+		}
+	}
+	return fields
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func typeName(t reflect.Type) string {
+	if t == durationType {
+		return "a duration like 15m or 1h30m"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Float64:
+		return "a number"
+	default:
+		return t.String()
+	}
+}
+
+// suggestKey finds the key that was probably meant: a sibling with a
+// similar name, or a key with the same name in another section
+func suggestKey(path, key string, siblings map[string]reflect.Type) string {
+	normalized := strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+
+	best, bestDistance := "", len(key)/3+2
+	for name := range siblings {
+		d := levenshtein(normalized, name)
+		if d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	if best != "" {
+		return joinPath(path, best)
+	}
+
+	for _, f := range Fields() {
+		if strings.HasSuffix(f.Path, "."+normalized) {
+			return f.Path
+		}
+	}
+	return ""
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
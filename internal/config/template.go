@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const templateHeader = `# Craftie Configuration File
+# This file contains all configuration options for Craftie
+`
+
+// Template renders the default config with every key documented.
+// config-template.yaml is generated from it, see gentemplate.go.
+func Template() []byte {
+	return Render(defaultConfig())
+}
+
+// Render writes cfg as yaml in the layout of the template, with every key documented
+func Render(cfg *Config) []byte {
+	var b strings.Builder
+	b.WriteString(templateHeader)
+	writeTemplateStruct(&b, reflect.ValueOf(cfg).Elem(), "", 0)
+	return []byte(b.String())
+}
+
+func writeTemplateStruct(b *strings.Builder, v reflect.Value, prefix string, indent int) {
+	pad := strings.Repeat("  ", indent)
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := yamlName(sf)
+		if name == "" {
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		fv := v.Field(i)
+
+		// blank line between keys, but not right below the section name
+		if indent == 0 || i > 0 {
+			b.WriteString("\n")
+		}
+		if sf.Type.Kind() == reflect.Map {
+			writeTemplateMap(b, fv, path, name)
+			continue
+		}
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			writeComment(b, pad, sectionDocs[path])
+			fmt.Fprintf(b, "%s%s:\n", pad, name)
+			writeTemplateStruct(b, fv, path, indent+1)
+			continue
+		}
+
+		writeComment(b, pad, fieldDocs[path])
+		fmt.Fprintf(b, "%s%s: %s\n", pad, name, templateValue(fv))
+	}
+}
+
+// writeTemplateMap writes profiles as yaml, or a commented out example when
+// there are none
+func writeTemplateMap(b *strings.Builder, v reflect.Value, path, name string) {
+	writeComment(b, "", sectionDocs[path])
+	if v.Len() == 0 {
+		writeComment(b, "", profilesExample)
+		return
+	}
+
+	enc := yaml.NewEncoder(b)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]any{name: v.Interface()}); err != nil {
+		fmt.Fprintf(b, "# failed to render %s: %v\n", name, err)
+	}
+	enc.Close()
+}
+
+func writeComment(b *strings.Builder, pad, doc string) {
+	if doc == "" {
+		return
+	}
+	for line := range strings.SplitSeq(doc, "\n") {
+		fmt.Fprintf(b, "%s# %s\n", pad, line)
+	}
+}
+
+func templateValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return strconv.Quote(formatDuration(time.Duration(v.Int())))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = templateValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+const WatchInterval = 2 * time.Second
+
+// ResolvePath returns the config file LoadConfig reads for cfgPath
+func ResolvePath(cfgPath string) string {
+	if cfgPath == "" {
+		return DefaultConfigPath()
+	}
+	return cfgPath
+}
+
+// Watch polls a config or project file every interval and signals on the
+// returned channel when its modification time or size changes. Polling copes with
+// editors that replace the file instead of writing it in place.
+func Watch(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last, _ := os.Stat(path)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := os.Stat(path)
+			if err != nil {
+				// file is being replaced or was removed, wait for it to come back
+				continue
+			}
+			if last != nil && current.ModTime().Equal(last.ModTime()) && current.Size() == last.Size() {
+				continue
+			}
+			last = current
+
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changed
+}
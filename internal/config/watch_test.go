@@ -0,0 +1,37 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "craftie.yaml")
+	if err := os.WriteFile(path, []byte("csv:\n  enabled: false\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := Watch(ctx, path, 10*time.Millisecond)
+
+	select {
+	case <-changed:
+		t.Fatal("expected no change before the file is written")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("csv:\n  enabled: true\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("expected change to be reported")
+	}
+}
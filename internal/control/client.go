@@ -0,0 +1,82 @@
+package control
+
+import (
+	"fmt"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+)
+
+// Client talks to the running session over the control socket
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to the control socket at path
+func Dial(path string) (*Client, error) {
+	c, err := jsonrpc.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("no running session found (is `craftie start` running?): %w", err)
+	}
+	return &Client{rpc: c}, nil
+}
+
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// Start begins a new session in the daemon
+func (c *Client) Start(args StartArgs) error {
+	return c.rpc.Call(serviceName+".Start", &args, &Empty{})
+}
+
+// Status returns the state of the running session
+func (c *Client) Status() (Status, error) {
+	var status Status
+	err := c.rpc.Call(serviceName+".Status", &Empty{}, &status)
+	return status, err
+}
+
+// Stop ends the running session
+func (c *Client) Stop() error {
+	return c.rpc.Call(serviceName+".Stop", &Empty{}, &Empty{})
+}
+
+// Pause starts a break
+func (c *Client) Pause() error {
+	return c.rpc.Call(serviceName+".Pause", &Empty{}, &Empty{})
+}
+
+// Resume ends the ongoing break
+func (c *Client) Resume() error {
+	return c.rpc.Call(serviceName+".Resume", &Empty{}, &Empty{})
+}
+
+// Note appends a timestamped note to the running session
+func (c *Client) Note(text string) error {
+	return c.rpc.Call(serviceName+".Note", &NoteArgs{Text: text}, &Empty{})
+}
+
+// Switch closes the current segment and continues under a new task
+func (c *Client) Switch(task string) error {
+	return c.rpc.Call(serviceName+".Switch", &SwitchArgs{Task: task}, &Empty{})
+}
+
+// Extend pushes the end timer back, e.g. by "30m"
+func (c *Client) Extend(duration string) error {
+	return c.rpc.Call(serviceName+".Extend", &ExtendArgs{Duration: duration}, &Empty{})
+}
+
+// Sync saves the session to all sinks right away
+func (c *Client) Sync() error {
+	return c.rpc.Call(serviceName+".Sync", &Empty{}, &Empty{})
+}
+
+// StopDaemon ends the running session and the daemon
+func (c *Client) StopDaemon() error {
+	return c.rpc.Call(daemonServiceName+".Stop", &Empty{}, &Empty{})
+}
+
+// Reload makes the daemon re-read its configuration
+func (c *Client) Reload() error {
+	return c.rpc.Call(daemonServiceName+".Reload", &Empty{}, &Empty{})
+}
@@ -0,0 +1,307 @@
+// Package control exposes the running session over a Unix domain socket.
+//
+// The protocol is JSON-RPC 1.0 as implemented by net/rpc/jsonrpc, one JSON
+// object per request, e.g.
+//
+//	{"id": 1, "method": "Session.Note", "params": [{"text": "finished the sleeves"}]}
+//
+// Available methods: Session.Start, Session.Status, Session.Stop, Session.Pause,
+// Session.Resume, Session.Note, Session.Switch, Session.Extend and Session.Sync,
+// and Daemon.Stop and Daemon.Reload for the background daemon.
+// Only the user owning the session process may connect.
+package control
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	serviceName       = "Session"
+	daemonServiceName = "Daemon"
+)
+
+// Handler is implemented by the process owning the running session.
+// Its methods are always called from the goroutine that receives from Server.Calls.
+type Handler interface {
+	Start(args StartArgs) error
+	Status() (Status, error)
+	Stop() error
+	Pause() error
+	Resume() error
+	Note(text string) error
+	SwitchTask(task string) error
+	Extend(duration time.Duration) error
+	Sync() error
+	// Shutdown ends the running session, if any, and then the daemon
+	Shutdown() error
+	// Reload makes the daemon re-read its configuration
+	Reload() error
+}
+
+// Status describes the running session
+type Status struct {
+	Project    string        `json:"project"`
+	Task       string        `json:"task"`
+	Notes      string        `json:"notes"`
+	Tags       []string      `json:"tags,omitempty"`
+	Rate       float64       `json:"rate,omitempty"`
+	Profile    string        `json:"profile,omitempty"`
+	StartTime  time.Time     `json:"start_time"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Paused     bool          `json:"paused"`
+	BreakTime  time.Duration `json:"break_time"`
+	PlannedEnd *time.Time    `json:"planned_end,omitempty"`
+	Sinks      []SinkStatus  `json:"sinks"`
+}
+
+// SinkStatus is the outcome of the last sync to a sink
+type SinkStatus struct {
+	Name     string    `json:"name"`
+	LastSync time.Time `json:"last_sync"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Call is a pending control request that has to be run against the Handler
+type Call struct {
+	fn   func(Handler) error
+	done chan error
+}
+
+// Run executes the request and unblocks the waiting client
+func (c Call) Run(h Handler) {
+	c.done <- c.fn(h)
+}
+
+// SocketPath returns the location of the control socket.
+// Uses XDG_RUNTIME_DIR if set, otherwise a per-user directory in the temp dir.
+func SocketPath() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("craftie-%d", os.Getuid()), "craftie.sock")
+	}
+	return filepath.Join(runtimeDir, "craftie", "craftie.sock")
+}
+
+// Server accepts control requests from other craftie processes
+type Server struct {
+	listener net.Listener
+	path     string
+	calls    chan Call
+	conns    sync.WaitGroup
+}
+
+// closeTimeout is how long Close waits for clients to read their last reply
+const closeTimeout = time.Second
+
+// Listen creates the control socket at path. A socket left behind by a
+// process that is gone is replaced, a live one is an error.
+func Listen(path string) (*Server, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to restrict socket directory: %w", err)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	s := &Server{
+		listener: listener,
+		path:     path,
+		calls:    make(chan Call),
+	}
+
+	rpcServer := rpc.NewServer()
+	session := &service{calls: s.calls}
+	if err := rpcServer.RegisterName(serviceName, session); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to register control service: %w", err)
+	}
+	if err := rpcServer.RegisterName(daemonServiceName, &daemonService{session: session}); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to register daemon service: %w", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if err := checkPeer(conn); err != nil {
+				conn.Close()
+				continue
+			}
+			s.conns.Add(1)
+			go func() {
+				defer s.conns.Done()
+				rpcServer.ServeCodec(jsonrpc.NewServerCodec(conn))
+			}()
+		}
+	}()
+
+	return s, nil
+}
+
+func removeStaleSocket(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("a session is already running (control socket %s is in use)", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	return nil
+}
+
+// Calls returns the channel incoming requests are delivered on
+func (s *Server) Calls() <-chan Call {
+	return s.calls
+}
+
+// Close stops accepting requests and removes the socket file.
+// Clients that are still connected get a moment to receive their reply,
+// e.g. the one that asked the session to stop.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+	}
+
+	if rmErr := os.Remove(s.path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+		return rmErr
+	}
+	return err
+}
+
+type StartArgs struct {
+	Project string `json:"project"`
+	Task    string `json:"task"`
+	Notes   string `json:"notes"`
+	// EndTime is the session length in time.ParseDuration format, e.g. "2h"
+	EndTime string   `json:"endtime"`
+	Tags    []string `json:"tags,omitempty"`
+	Rate    float64  `json:"rate,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+	// NoProfile asks for no profile when Profile is empty, also when the
+	// daemon has CRAFTIE_PROFILE set
+	NoProfile bool `json:"no_profile,omitempty"`
+	// Dir is where the session was started, the .craftie.yaml is looked up from there
+	Dir string `json:"dir,omitempty"`
+}
+
+type NoteArgs struct {
+	Text string `json:"text"`
+}
+
+type SwitchArgs struct {
+	Task string `json:"task"`
+}
+
+type ExtendArgs struct {
+	// Duration in time.ParseDuration format, e.g. "30m"
+	Duration string `json:"duration"`
+}
+
+type Empty struct{}
+
+// service is what net/rpc exposes; it forwards every request to the session loop
+type service struct {
+	calls chan<- Call
+}
+
+func (s *service) do(fn func(Handler) error) error {
+	call := Call{fn: fn, done: make(chan error, 1)}
+	s.calls <- call
+	return <-call.done
+}
+
+func (s *service) Start(args *StartArgs, _ *Empty) error {
+	return s.do(func(h Handler) error { return h.Start(*args) })
+}
+
+func (s *service) Status(_ *Empty, reply *Status) error {
+	return s.do(func(h Handler) error {
+		status, err := h.Status()
+		*reply = status
+		return err
+	})
+}
+
+func (s *service) Stop(_ *Empty, _ *Empty) error {
+	return s.do(func(h Handler) error { return h.Stop() })
+}
+
+func (s *service) Pause(_ *Empty, _ *Empty) error {
+	return s.do(func(h Handler) error { return h.Pause() })
+}
+
+func (s *service) Resume(_ *Empty, _ *Empty) error {
+	return s.do(func(h Handler) error { return h.Resume() })
+}
+
+func (s *service) Note(args *NoteArgs, _ *Empty) error {
+	return s.do(func(h Handler) error { return h.Note(args.Text) })
+}
+
+func (s *service) Switch(args *SwitchArgs, _ *Empty) error {
+	return s.do(func(h Handler) error { return h.SwitchTask(args.Task) })
+}
+
+func (s *service) Extend(args *ExtendArgs, _ *Empty) error {
+	duration, err := time.ParseDuration(args.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration format: %w (use format like 2h, 30m, 1h30m)", err)
+	}
+	return s.do(func(h Handler) error { return h.Extend(duration) })
+}
+
+func (s *service) Sync(_ *Empty, _ *Empty) error {
+	return s.do(func(h Handler) error { return h.Sync() })
+}
+
+// daemonService exposes the Daemon methods, forwarded like the session ones
+type daemonService struct {
+	session *service
+}
+
+func (s *daemonService) Stop(_ *Empty, _ *Empty) error {
+	return s.session.do(func(h Handler) error { return h.Shutdown() })
+}
+
+func (s *daemonService) Reload(_ *Empty, _ *Empty) error {
+	return s.session.do(func(h Handler) error { return h.Reload() })
+}
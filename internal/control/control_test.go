@@ -0,0 +1,168 @@
+package control
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeHandler struct {
+	notes    []string
+	paused   bool
+	stopped  bool
+	shutdown bool
+	reloads  int
+}
+
+func (h *fakeHandler) Start(StartArgs) error { return errors.New("a session is already running") }
+func (h *fakeHandler) Status() (Status, error) {
+	return Status{Project: "test-project", Paused: h.paused}, nil
+}
+func (h *fakeHandler) Stop() error { h.stopped = true; return nil }
+func (h *fakeHandler) Pause() error {
+	if h.paused {
+		return errors.New("session is already paused")
+	}
+	h.paused = true
+	return nil
+}
+func (h *fakeHandler) Resume() error                { h.paused = false; return nil }
+func (h *fakeHandler) Note(text string) error       { h.notes = append(h.notes, text); return nil }
+func (h *fakeHandler) SwitchTask(task string) error { return nil }
+func (h *fakeHandler) Extend(time.Duration) error   { return nil }
+func (h *fakeHandler) Sync() error                  { return nil }
+func (h *fakeHandler) Shutdown() error              { h.shutdown = true; return nil }
+func (h *fakeHandler) Reload() error                { h.reloads++; return nil }
+
+func startServer(t *testing.T, path string, h Handler) *Server {
+	t.Helper()
+
+	srv, err := Listen(path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case call := <-srv.Calls():
+				call.Run(h)
+			case <-done:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		srv.Close()
+	})
+
+	return srv
+}
+
+func TestControlSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "craftie", "craftie.sock")
+	h := &fakeHandler{}
+	srv := startServer(t, path, h)
+
+	t.Run("socket is private", func(t *testing.T) {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat socket: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("expected socket mode 0600, got %o", perm)
+		}
+	})
+
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	t.Run("note and status", func(t *testing.T) {
+		if err := client.Note("finished the sleeves"); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(h.notes) != 1 || h.notes[0] != "finished the sleeves" {
+			t.Errorf("expected note to reach handler, got %v", h.notes)
+		}
+
+		status, err := client.Status()
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if status.Project != "test-project" {
+			t.Errorf("expected project %q, got %q", "test-project", status.Project)
+		}
+	})
+
+	t.Run("handler errors reach the client", func(t *testing.T) {
+		if err := client.Pause(); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if err := client.Pause(); err == nil {
+			t.Fatal("expected error when pausing twice, got nil")
+		}
+	})
+
+	t.Run("invalid extend duration", func(t *testing.T) {
+		if err := client.Extend("soon"); err == nil {
+			t.Fatal("expected error for invalid duration, got nil")
+		}
+	})
+
+	t.Run("daemon stop and reload", func(t *testing.T) {
+		if err := client.Reload(); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if err := client.StopDaemon(); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if h.reloads != 1 || !h.shutdown {
+			t.Errorf("expected a reload and a shutdown, got %d reloads and shutdown %v", h.reloads, h.shutdown)
+		}
+	})
+
+	t.Run("second server is refused", func(t *testing.T) {
+		if _, err := Listen(path); err == nil {
+			t.Fatal("expected error while socket is in use, got nil")
+		}
+	})
+
+	t.Run("close removes socket", func(t *testing.T) {
+		srv.Close()
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected socket to be removed, got: %v", err)
+		}
+	})
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "craftie.sock")
+
+	// A socket file nobody listens on, as left behind by a killed process
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to create socket: %v", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	startServer(t, path, &fakeHandler{})
+
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Status(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
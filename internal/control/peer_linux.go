@@ -0,0 +1,39 @@
+package control
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkPeer rejects connections from processes of other users
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("not a unix socket connection")
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return err
+	}
+	if credErr != nil {
+		return fmt.Errorf("failed to read peer credentials: %w", credErr)
+	}
+
+	if int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("connection from uid %d rejected", cred.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package control
+
+import "net"
+
+// checkPeer relies on the 0700 socket directory and 0600 socket file
+// on platforms without SO_PEERCRED
+func checkPeer(conn net.Conn) error {
+	return nil
+}
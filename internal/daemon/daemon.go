@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/vlad/craftie/internal/control"
+	"github.com/vlad/craftie/internal/pkg"
+)
+
+// PidfilePath returns the pidfile location, next to the control socket
+func PidfilePath() string {
+	return filepath.Join(filepath.Dir(control.SocketPath()), "craftie.pid")
+}
+
+// LogPath returns where the daemon writes its output when none is configured.
+// Uses XDG_STATE_HOME if set, otherwise ~/.local/state.
+func LogPath() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return filepath.Join(os.TempDir(), "craftie-daemon.log")
+		}
+		stateDir = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateDir, "craftie", "daemon.log")
+}
+
+// WritePidfile records the current process in the pidfile. A pidfile
+// pointing at a live process means another daemon is running.
+func WritePidfile(path string) error {
+	if pid, err := ReadPidfile(path); err == nil && processAlive(pid) {
+		return &pkg.CraftieError{
+			Code:    pkg.ErrCodeDaemon,
+			Message: fmt.Sprintf("daemon is already running (pid %d)", pid),
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create pidfile directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write pidfile: %w", err)
+	}
+	return nil
+}
+
+// ReadPidfile returns the pid stored in the pidfile
+func ReadPidfile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pidfile %s: %w", path, err)
+	}
+	return pid, nil
+}
+
+// RemovePidfile deletes the pidfile if it still belongs to this process
+func RemovePidfile(path string) error {
+	if pid, err := ReadPidfile(path); err != nil || pid != os.Getpid() {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Signal sends sig to the daemon recorded in the pidfile
+func Signal(path string, sig syscall.Signal) error {
+	pid, err := ReadPidfile(path)
+	if err != nil {
+		return &pkg.CraftieError{Code: pkg.ErrCodeDaemon, Message: "daemon is not running", Cause: err}
+	}
+	if err := signalProcess(pid, sig); err != nil {
+		return &pkg.CraftieError{Code: pkg.ErrCodeDaemon, Message: fmt.Sprintf("failed to signal daemon (pid %d)", pid), Cause: err}
+	}
+	return nil
+}
+
+// Spawn starts `craftie daemon` detached from the terminal, in its own
+// session, with output going to logPath. Returns the daemon's pid.
+func Spawn(args []string, logPath string) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find craftie executable: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, append([]string{"daemon"}, args...)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detached()
+
+	if err := cmd.Start(); err != nil {
+		return 0, &pkg.CraftieError{Code: pkg.ErrCodeDaemon, Message: "failed to start daemon", Cause: err}
+	}
+
+	pid := cmd.Process.Pid
+	if err := cmd.Process.Release(); err != nil {
+		return 0, err
+	}
+	return pid, nil
+}
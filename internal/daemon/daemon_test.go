@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPidfile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("write and remove", func(t *testing.T) {
+		path := filepath.Join(tempDir, "write", "craftie.pid")
+
+		if err := WritePidfile(path); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		pid, err := ReadPidfile(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if pid != os.Getpid() {
+			t.Errorf("expected pid %d, got %d", os.Getpid(), pid)
+		}
+
+		if err := RemovePidfile(path); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected pidfile to be removed, got: %v", err)
+		}
+	})
+
+	t.Run("live process is refused", func(t *testing.T) {
+		path := filepath.Join(tempDir, "live.pid")
+		// the test process itself is alive
+		if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600); err != nil {
+			t.Fatalf("failed to write pidfile: %v", err)
+		}
+
+		if err := WritePidfile(path); err == nil {
+			t.Fatal("expected error for running daemon, got nil")
+		}
+	})
+
+	t.Run("stale pidfile is replaced", func(t *testing.T) {
+		path := filepath.Join(tempDir, "stale.pid")
+		if err := os.WriteFile(path, []byte("999999999\n"), 0600); err != nil {
+			t.Fatalf("failed to write pidfile: %v", err)
+		}
+
+		if err := WritePidfile(path); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("pidfile of another process is kept", func(t *testing.T) {
+		path := filepath.Join(tempDir, "other.pid")
+		if err := os.WriteFile(path, []byte("1\n"), 0600); err != nil {
+			t.Fatalf("failed to write pidfile: %v", err)
+		}
+
+		if err := RemovePidfile(path); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected pidfile to be kept, got: %v", err)
+		}
+	})
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit := SystemdUnit("/usr/local/bin/craftie", "/home/me/craftie.yaml")
+
+	expected := `ExecStart="/usr/local/bin/craftie" daemon --config "/home/me/craftie.yaml"`
+	if !strings.Contains(unit, expected) {
+		t.Errorf("expected unit to contain %q, got:\n%s", expected, unit)
+	}
+	if !strings.Contains(unit, "ExecReload=/bin/kill -HUP $MAINPID") {
+		t.Errorf("expected unit to reload with SIGHUP, got:\n%s", unit)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package daemon
+
+import (
+	"errors"
+	"syscall"
+)
+
+// signalProcess sends sig to pid
+func signalProcess(pid int, sig syscall.Signal) error {
+	return syscall.Kill(pid, sig)
+}
+
+// processAlive probes pid with signal 0; EPERM means it exists but belongs to someone else
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// detached starts a process in its own session, away from the terminal
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,36 @@
+//go:build windows
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// detachedProcess is DETACHED_PROCESS, the process gets no console
+const detachedProcess = 0x00000008
+
+// signalProcess fails, Windows has no signals to send. The daemon is
+// stopped and reloaded over the control socket there, killing it would
+// leave its session without an end.
+func signalProcess(pid int, sig syscall.Signal) error {
+	return fmt.Errorf("signal %v is not supported on Windows, the daemon (pid %d) is not listening on its control socket", sig, pid)
+}
+
+// processAlive reports whether pid can be opened, which fails once the
+// process is gone
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+// detached starts a process without a console in its own process group, so
+// closing the terminal does not end it
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SystemdUnitPath returns where the systemd user unit is installed
+func SystemdUnitPath() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		homeDir, _ := os.UserHomeDir()
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configDir, "systemd", "user", "craftie.service")
+}
+
+// SystemdUnit generates a systemd user unit running the daemon.
+// configPath is passed on to the daemon if set.
+func SystemdUnit(executable, configPath string) string {
+	execStart := []string{strconv.Quote(executable), "daemon"}
+	if configPath != "" {
+		execStart = append(execStart, "--config", strconv.Quote(configPath))
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=Craftie time tracking daemon
+
+[Service]
+Type=simple
+ExecStart=%s
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+
+[Install]
+WantedBy=default.target
+`, strings.Join(execStart, " "))
+}
@@ -0,0 +1,223 @@
+// Package history keeps every session craftie tracked in a JSON file, so
+// sessions can be compared with the sheet or replayed into another sink
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/vlad/craftie/internal/session"
+)
+
+// version is written to the file, for changes to its format
+const version = 1
+
+// Entry is a session as it is stored
+type Entry struct {
+	ID      string    `json:"id"`
+	Project string    `json:"project"`
+	Task    string    `json:"task,omitempty"`
+	Start   time.Time `json:"start"`
+	// End is nil while the session runs
+	End *time.Time `json:"end,omitempty"`
+	// Duration is the time worked, breaks excluded
+	Duration time.Duration `json:"duration"`
+	Notes    string        `json:"notes,omitempty"`
+	Tags     []string      `json:"tags,omitempty"`
+	Rate     float64       `json:"rate,omitempty"`
+	Profile  string        `json:"profile,omitempty"`
+	// Spreadsheet is the Google Sheets spreadsheet the session was synced with
+	Spreadsheet string `json:"spreadsheet,omitempty"`
+	// Sheet is the session's row as last written to or read from the
+	// spreadsheet, as text by header. Edits made in the sheet since are
+	// found by comparing with it.
+	Sheet map[string]string `json:"sheet,omitempty"`
+}
+
+// FromSession records the current state of a session
+func FromSession(s *session.Session) Entry {
+	return Entry{
+		ID:       s.ID,
+		Project:  s.ProjectName,
+		Task:     s.Task,
+		Start:    s.StartTime,
+		End:      s.EndTime(),
+		Duration: s.CurrentDuration().Round(time.Second),
+		Notes:    s.Notes,
+		Tags:     s.Tags,
+		Rate:     s.Rate,
+		Profile:  s.Profile,
+	}
+}
+
+// Session rebuilds the session of an entry. The time of a finished session
+// that was not worked counts as one break.
+func (e Entry) Session() *session.Session {
+	s := &session.Session{
+		ID:          e.ID,
+		StartTime:   e.Start,
+		ProjectName: e.Project,
+		Task:        e.Task,
+		Notes:       e.Notes,
+		Tags:        e.Tags,
+		Rate:        e.Rate,
+		Profile:     e.Profile,
+	}
+	if e.End != nil {
+		s.Finish(*e.End, e.Duration)
+	}
+	return s
+}
+
+// History is the stored sessions, ordered by start
+type History struct {
+	entries []Entry
+}
+
+type file struct {
+	Version  int     `json:"version"`
+	Sessions []Entry `json:"sessions"`
+}
+
+// DefaultPath is where the history is kept, under XDG_STATE_HOME or
+// ~/.local/state
+func DefaultPath() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return filepath.Join(os.TempDir(), "craftie-history.json")
+		}
+		stateDir = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateDir, "craftie", "history.json")
+}
+
+// Load reads the history at path, a missing file is an empty history
+func Load(path string) (*History, error) {
+	unlock, err := lock(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return read(path)
+}
+
+// Update changes the history at path with fn and saves it, unless fn fails.
+// Other processes wait until it is saved.
+func Update(path string, fn func(h *History) error) error {
+	unlock, err := lock(path, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	h, err := read(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(h); err != nil {
+		return err
+	}
+	return h.write(path)
+}
+
+// Get returns the entry of a session
+func (h *History) Get(id string) (Entry, bool) {
+	i := slices.IndexFunc(h.entries, func(e Entry) bool { return e.ID == id })
+	if i < 0 {
+		return Entry{}, false
+	}
+	return h.entries[i], true
+}
+
+// Put adds an entry or replaces the one with the same ID
+func (h *History) Put(e Entry) {
+	h.entries = slices.DeleteFunc(h.entries, func(old Entry) bool { return old.ID == e.ID })
+	i, _ := slices.BinarySearchFunc(h.entries, e.Start, func(e Entry, start time.Time) int {
+		return e.Start.Compare(start)
+	})
+	// after entries starting at the same time
+	for i < len(h.entries) && h.entries[i].Start.Equal(e.Start) {
+		i++
+	}
+	h.entries = slices.Insert(h.entries, i, e)
+}
+
+// Entries returns every entry, ordered by start
+func (h *History) Entries() []Entry {
+	return slices.Clone(h.entries)
+}
+
+// lock takes a lock on a file next to path, created when missing. An
+// exclusive lock waits for every other lock, a shared one for exclusive ones.
+func lock(path string, exclusive bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history lock: %w", err)
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock history: %w", err)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+func read(path string) (*History, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &History{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse history %s: %w", path, err)
+	}
+	if f.Version > version {
+		return nil, fmt.Errorf("history %s was written by a newer craftie (version %d)", path, f.Version)
+	}
+	h := &History{}
+	for _, e := range f.Sessions {
+		h.Put(e)
+	}
+	return h, nil
+}
+
+// write replaces the file at path in one step, so a crash leaves the old one
+func (h *History) write(path string) error {
+	data, err := json.MarshalIndent(file{Version: version, Sessions: h.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".history-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/session"
+)
+
+func TestHistory(t *testing.T) {
+	start := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	t.Run("missing file is empty", func(t *testing.T) {
+		h, err := Load(filepath.Join(t.TempDir(), "history.json"))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(h.Entries()) != 0 {
+			t.Errorf("expected no entries, got %v", h.Entries())
+		}
+	})
+
+	t.Run("entries are saved in start order", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie", "history.json")
+		err := Update(path, func(h *History) error {
+			h.Put(Entry{ID: "b", Project: "hat", Start: start.Add(time.Hour)})
+			h.Put(Entry{ID: "a", Project: "quilt", Start: start})
+			h.Put(Entry{ID: "c", Project: "rug", Start: start.Add(2 * time.Hour)})
+			// replaces b
+			h.Put(Entry{ID: "b", Project: "scarf", Start: start.Add(3 * time.Hour)})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		h, err := Load(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		entries := h.Entries()
+		if len(entries) != 3 || entries[0].ID != "a" || entries[1].ID != "c" || entries[2].Project != "scarf" {
+			t.Errorf("expected a, c, b, got %v", entries)
+		}
+		if e, ok := h.Get("c"); !ok || e.Project != "rug" {
+			t.Errorf("expected to get c, got %v", e)
+		}
+		if _, ok := h.Get("d"); ok {
+			t.Error("expected no entry d")
+		}
+	})
+
+	t.Run("a failed update is not saved", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.json")
+		err := Update(path, func(h *History) error {
+			h.Put(Entry{ID: "a", Start: start})
+			return errors.New("boom")
+		})
+		if err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected no history file, got: %v", err)
+		}
+	})
+
+	t.Run("newer files are refused", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.json")
+		if err := os.WriteFile(path, []byte(`{"version": 2, "sessions": []}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
+
+func TestEntrySession(t *testing.T) {
+	start := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+	s := &session.Session{ID: "a", StartTime: start, ProjectName: "quilt", Tags: []string{"gift"}, Rate: 40}
+	s.Finish(start.Add(3*time.Hour), 2*time.Hour+30*time.Minute)
+
+	e := FromSession(s)
+	if e.End == nil || !e.End.Equal(start.Add(3*time.Hour)) || e.Duration != 2*time.Hour+30*time.Minute {
+		t.Fatalf("expected a finished entry of 2h30m, got %+v", e)
+	}
+
+	restored := e.Session()
+	if restored.ID != "a" || restored.ProjectName != "quilt" || restored.Rate != 40 || len(restored.Tags) != 1 {
+		t.Errorf("expected the fields back, got %+v", restored)
+	}
+	if got := restored.CurrentDuration(); got != 2*time.Hour+30*time.Minute {
+		t.Errorf("expected 2h30m worked, got %v", got)
+	}
+	if got := restored.BreakDuration(); got != 30*time.Minute {
+		t.Errorf("expected a 30m break, got %v", got)
+	}
+
+	running := Entry{ID: "b", Start: start}.Session()
+	if running.EndTime() != nil {
+		t.Errorf("expected a running session, got end %v", running.EndTime())
+	}
+}
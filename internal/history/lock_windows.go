@@ -0,0 +1,24 @@
+//go:build windows
+
+package history
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockRange is the byte range locked, the whole file however long
+const lockRange = ^uint32(0)
+
+func lockFile(f *os.File, exclusive bool) error {
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	return windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, lockRange, lockRange, &windows.Overlapped{})
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, lockRange, lockRange, &windows.Overlapped{})
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Send shows a desktop notification using notify-send on Linux
+// and osascript on macOS
+func Send(title, message string, sound bool) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title))
+		if sound {
+			script += ` sound name "Glass"`
+		}
+		cmd = exec.Command("osascript", "-e", script)
+	default:
+		args := []string{"--app-name=craftie"}
+		if sound {
+			args = append(args, "--hint=string:sound-name:complete")
+		}
+		args = append(args, title, message)
+		cmd = exec.Command("notify-send", args...)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to send notification: %w: %s", err, output)
+	}
+	return nil
+}
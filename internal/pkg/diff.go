@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines are shown around a change
+const diffContext = 3
+
+// UnifiedDiff returns a unified diff turning a into b, empty when they are equal
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	aLines := splitLines(string(a))
+	bLines := splitLines(string(b))
+	ops := diffLines(aLines, bLines)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	changed := false
+
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		changed = true
+
+		// grow the hunk until changes are more than two contexts apart
+		from := max(start-diffContext, 0)
+		end := start
+		for i := start; i < len(ops) && i-end <= 2*diffContext; i++ {
+			if ops[i].kind != ' ' {
+				end = i
+			}
+		}
+		to := min(end+diffContext+1, len(ops))
+
+		aStart, bStart := ops[from].aLine, ops[from].bLine
+		aCount, bCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart+1, aCount, bStart+1, bCount)
+		for _, op := range ops[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+
+		start = to
+	}
+
+	if !changed {
+		return ""
+	}
+	return out.String()
+}
+
+type diffOp struct {
+	kind         byte // ' ', '-' or '+'
+	text         string
+	aLine, bLine int
+}
+
+// diffLines computes a line edit script from the longest common subsequence
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
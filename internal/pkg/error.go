@@ -1,6 +1,9 @@
 package pkg
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // CraftieError represents a base error type for the application
 type CraftieError struct {
@@ -41,6 +44,10 @@ const (
 // ValidationError represents a configuration or input validation error
 type ValidationError struct {
 	*CraftieError
+	// Position of the problem in the config file, Line is 0 when unknown
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
 }
 
 func NewValidationError(message string) *ValidationError {
@@ -51,3 +58,36 @@ func NewValidationError(message string) *ValidationError {
 		},
 	}
 }
+
+// NewValidationErrorAt creates a validation error pointing at a position in a file.
+// The position is prepended to the message, e.g. "craftie.yaml:3:5: unknown key".
+func NewValidationErrorAt(file string, line, column int, message string) *ValidationError {
+	position := fmt.Sprintf("line %d, column %d", line, column)
+	if file != "" {
+		position = fmt.Sprintf("%s:%d:%d", file, line, column)
+	}
+
+	err := NewValidationError(position + ": " + message)
+	err.File, err.Line, err.Column = file, line, column
+	return err
+}
+
+// ValidationErrors collects every problem found in one validation pass
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return fmt.Sprintf("%s: %s", ErrCodeValidation, strings.Join(messages, "; "))
+}
+
+// Unwrap lets errors.Is and errors.As reach each problem
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
@@ -1,30 +1,81 @@
 package session
 
 import (
+	"crypto/rand"
 	"fmt"
 	"time"
 )
 
 type Session struct {
+	// ID is unique to the session, it finds the session's row in Google Sheets
+	ID          string
 	StartTime   time.Time
 	endTime     *time.Time
 	ProjectName string
 	Task        string
 	Notes       string
+	Tags        []string
+	// Rate is the hourly rate, 0 when not billed
+	Rate float64
+	// Profile is the config profile the session is logged under
+	Profile    string
+	breaks     []Break
+	plannedEnd *time.Time
+	timer      *time.Timer
+}
+
+// now is the clock sessions read, replaced in tests
+var now = time.Now
+
+// NewID returns a random session ID
+func NewID() string {
+	return rand.Text()
+}
+
+// Break is a paused stretch of a session. End is nil while the break is ongoing.
+type Break struct {
+	Start time.Time
+	End   *time.Time
 }
 
 // Duration returns the duration from start until now (for in-progress sessions)
-// and duration from start to end for ended sessions
+// and duration from start to end for ended sessions, minus time spent on breaks
 func (s *Session) CurrentDuration() time.Duration {
+	end := now()
 	if s.endTime != nil {
-		return s.endTime.Sub(s.StartTime)
+		end = *s.endTime
 	}
-	return time.Since(s.StartTime)
+	return end.Sub(s.StartTime) - s.breakDuration(end)
+}
+
+// BreakDuration returns the total time spent on breaks so far
+func (s *Session) BreakDuration() time.Duration {
+	end := now()
+	if s.endTime != nil {
+		end = *s.endTime
+	}
+	return s.breakDuration(end)
+}
+
+func (s *Session) breakDuration(until time.Time) time.Duration {
+	var total time.Duration
+	for _, b := range s.breaks {
+		if b.End != nil {
+			total += b.End.Sub(b.Start)
+		} else {
+			total += until.Sub(b.Start)
+		}
+	}
+	return total
 }
 
 // SetEndTimer parses the duration string, sets the session end time,
 // and returns a timer channel that will fire when the session should end.
 // Returns nil channel if durationStr is empty.
+//
+// The end is wall-clock time: breaks do not push it back, so a session
+// started for 2h ends 2h later however long it was paused. Use
+// ExtendEndTimer to make up for a break.
 func (s *Session) SetEndTimer(durationStr string) (<-chan time.Time, error) {
 	if durationStr == "" {
 		return nil, nil
@@ -35,18 +86,109 @@ func (s *Session) SetEndTimer(durationStr string) (<-chan time.Time, error) {
 		return nil, fmt.Errorf("invalid duration format: %w (use format like 2h, 30m, 1h30m)", err)
 	}
 
-	endTime := time.Now().Add(duration)
+	endTime := now().Add(duration)
+	s.plannedEnd = &endTime
+	s.timer = time.NewTimer(duration)
 
 	fmt.Printf("Session will end automatically in %s (at %s)\n", duration, endTime.Format("15:04:05"))
 
-	return time.After(duration), nil
+	return s.timer.C, nil
+}
+
+// ExtendEndTimer pushes the planned end back by duration. Without an end
+// timer, one is started that fires duration from now.
+// Returns the channel that fires when the session should end.
+func (s *Session) ExtendEndTimer(duration time.Duration) <-chan time.Time {
+	if s.timer == nil {
+		endTime := now().Add(duration)
+		s.plannedEnd = &endTime
+		s.timer = time.NewTimer(duration)
+		return s.timer.C
+	}
+
+	endTime := s.plannedEnd.Add(duration)
+	s.plannedEnd = &endTime
+	s.timer.Reset(max(time.Until(endTime), 0))
+	return s.timer.C
+}
+
+// Pause starts a break. Pausing an already paused session is a no-op. The
+// end timer keeps running, see SetEndTimer.
+func (s *Session) Pause() {
+	if s.Paused() || s.endTime != nil {
+		return
+	}
+	s.breaks = append(s.breaks, Break{Start: now()})
+}
+
+// Resume ends the ongoing break, if any
+func (s *Session) Resume() {
+	if !s.Paused() {
+		return
+	}
+	end := now()
+	s.breaks[len(s.breaks)-1].End = &end
+}
+
+// Paused reports whether the session is currently on a break
+func (s *Session) Paused() bool {
+	return len(s.breaks) > 0 && s.breaks[len(s.breaks)-1].End == nil
+}
+
+// Breaks returns the breaks taken during the session
+func (s *Session) Breaks() []Break {
+	return s.breaks
+}
+
+// AddNote appends a timestamped note to the session notes
+func (s *Session) AddNote(note string) {
+	entry := fmt.Sprintf("[%s] %s", now().Format("15:04"), note)
+	if s.Notes == "" {
+		s.Notes = entry
+		return
+	}
+	s.Notes += "; " + entry
 }
 
 func (s *Session) Stop() {
-	now := time.Now()
-	s.endTime = &now
+	s.Resume()
+	end := now()
+	s.endTime = &end
+}
+
+// NextSegment stops the session and returns a new one continuing the same
+// project under a different task. The end timer carries over.
+func (s *Session) NextSegment(task string) *Session {
+	s.Stop()
+	return &Session{
+		ID:          NewID(),
+		StartTime:   *s.endTime,
+		ProjectName: s.ProjectName,
+		Task:        task,
+		Tags:        s.Tags,
+		Rate:        s.Rate,
+		Profile:     s.Profile,
+		plannedEnd:  s.plannedEnd,
+		timer:       s.timer,
+	}
+}
+
+// Finish ends the session at end after working for worked, e.g. for a
+// session read back from a sheet. The time not worked counts as one break
+// before the end, worked is capped at the time between start and end.
+func (s *Session) Finish(end time.Time, worked time.Duration) {
+	s.endTime = &end
+	s.breaks = nil
+	if idle := end.Sub(s.StartTime) - max(worked, 0); idle > 0 {
+		s.breaks = []Break{{Start: end.Add(-idle), End: &end}}
+	}
 }
 
 func (s *Session) EndTime() *time.Time {
 	return s.endTime
 }
+
+// PlannedEnd returns when the end timer fires, or nil if no end timer is set
+func (s *Session) PlannedEnd() *time.Time {
+	return s.plannedEnd
+}
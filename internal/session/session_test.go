@@ -0,0 +1,132 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+// clock makes the session package read a clock the test moves
+func clock(t *testing.T, start time.Time) *time.Time {
+	t.Helper()
+	current := start
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = time.Now })
+	return &current
+}
+
+func TestBreaks(t *testing.T) {
+	start := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	t.Run("breaks are not counted", func(t *testing.T) {
+		current := clock(t, start)
+		s := &Session{StartTime: start}
+
+		*current = start.Add(time.Hour)
+		s.Pause()
+		if !s.Paused() {
+			t.Fatal("expected the session to be paused")
+		}
+		*current = start.Add(90 * time.Minute)
+		if got := s.CurrentDuration(); got != time.Hour {
+			t.Errorf("expected 1h while paused, got %v", got)
+		}
+		s.Resume()
+		*current = start.Add(2 * time.Hour)
+
+		if got := s.CurrentDuration(); got != 90*time.Minute {
+			t.Errorf("expected 1h30m worked, got %v", got)
+		}
+		if got := s.BreakDuration(); got != 30*time.Minute {
+			t.Errorf("expected a 30m break, got %v", got)
+		}
+		if len(s.Breaks()) != 1 || s.Paused() {
+			t.Errorf("expected one finished break, got %+v", s.Breaks())
+		}
+	})
+
+	t.Run("pausing twice keeps the first break", func(t *testing.T) {
+		current := clock(t, start)
+		s := &Session{StartTime: start}
+
+		*current = start.Add(time.Hour)
+		s.Pause()
+		*current = start.Add(75 * time.Minute)
+		s.Pause()
+		*current = start.Add(90 * time.Minute)
+		s.Resume()
+		// resuming a running session does nothing
+		s.Resume()
+
+		if len(s.Breaks()) != 1 || !s.Breaks()[0].Start.Equal(start.Add(time.Hour)) {
+			t.Errorf("expected one break from the first pause, got %+v", s.Breaks())
+		}
+		if got := s.BreakDuration(); got != 30*time.Minute {
+			t.Errorf("expected a 30m break, got %v", got)
+		}
+	})
+
+	t.Run("stopping ends the break", func(t *testing.T) {
+		current := clock(t, start)
+		s := &Session{StartTime: start}
+
+		*current = start.Add(time.Hour)
+		s.Pause()
+		*current = start.Add(2 * time.Hour)
+		s.Stop()
+		*current = start.Add(5 * time.Hour)
+
+		if got := s.CurrentDuration(); got != time.Hour {
+			t.Errorf("expected 1h worked, got %v", got)
+		}
+		if s.Paused() || !s.EndTime().Equal(start.Add(2*time.Hour)) {
+			t.Errorf("expected the session stopped at 11:00, got end %v", s.EndTime())
+		}
+		// a stopped session cannot be paused
+		s.Pause()
+		if len(s.Breaks()) != 1 {
+			t.Errorf("expected no new break, got %+v", s.Breaks())
+		}
+	})
+}
+
+func TestAddNote(t *testing.T) {
+	current := clock(t, time.Date(2025, 3, 14, 9, 5, 0, 0, time.Local))
+	s := &Session{}
+
+	s.AddNote("binding")
+	*current = current.Add(time.Hour)
+	s.AddNote("pressing")
+
+	if s.Notes != "[09:05] binding; [10:05] pressing" {
+		t.Errorf("expected timestamped notes, got %q", s.Notes)
+	}
+}
+
+func TestEndTimer(t *testing.T) {
+	start := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+	current := clock(t, start)
+	s := &Session{StartTime: start}
+
+	if _, err := s.SetEndTimer("2h"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer s.timer.Stop()
+
+	// a break does not move the end
+	*current = start.Add(time.Hour)
+	s.Pause()
+	*current = start.Add(90 * time.Minute)
+	s.Resume()
+	if got := s.PlannedEnd(); !got.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("expected the end at 11:00, got %v", got)
+	}
+
+	s.ExtendEndTimer(30 * time.Minute)
+	if got := s.PlannedEnd(); !got.Equal(start.Add(150 * time.Minute)) {
+		t.Errorf("expected the end at 11:30, got %v", got)
+	}
+
+	if _, err := s.SetEndTimer("two hours"); err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
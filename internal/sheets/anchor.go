@@ -0,0 +1,71 @@
+package sheets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// anchorKey is the developer metadata key a session's row is tagged with,
+// the value is the session ID. Metadata on a row moves with it when rows are
+// sorted, filtered or inserted above it.
+const anchorKey = "craftie_session"
+
+// MissingAnchorError is returned when no row is tagged with a session, e.g.
+// because the row was deleted
+type MissingAnchorError struct {
+	SessionIDs []string
+}
+
+func (e *MissingAnchorError) Error() string {
+	return fmt.Sprintf("no row found for session %s, it was deleted or its metadata removed",
+		strings.Join(e.SessionIDs, ", "))
+}
+
+// anchorFilter finds the row tagged with a session
+func anchorFilter(sessionID string) *sheets.DataFilter {
+	return &sheets.DataFilter{
+		DeveloperMetadataLookup: &sheets.DeveloperMetadataLookup{
+			MetadataKey:   anchorKey,
+			MetadataValue: sessionID,
+		},
+	}
+}
+
+// anchorRequest tags row, 1-based, of a sheet with a session
+func anchorRequest(sheetID int64, row int, sessionID string) *sheets.Request {
+	return &sheets.Request{
+		CreateDeveloperMetadata: &sheets.CreateDeveloperMetadataRequest{
+			DeveloperMetadata: &sheets.DeveloperMetadata{
+				MetadataKey:   anchorKey,
+				MetadataValue: sessionID,
+				Visibility:    "DOCUMENT",
+				Location: &sheets.DeveloperMetadataLocation{
+					DimensionRange: &sheets.DimensionRange{
+						SheetId:    sheetID,
+						Dimension:  "ROWS",
+						StartIndex: int64(row - 1),
+						EndIndex:   int64(row),
+					},
+				},
+			},
+		},
+	}
+}
+
+// rangeRow is the first row of an A1 range like 'Craft Time'!A5:J5
+func rangeRow(a1 string) (int, error) {
+	cells := a1
+	if i := strings.LastIndex(a1, "!"); i >= 0 {
+		cells = a1[i+1:]
+	}
+	cell, _, _ := strings.Cut(cells, ":")
+	digits := strings.TrimLeft(cell, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	row, err := strconv.Atoi(digits)
+	if err != nil || row < 1 || len(digits) == len(cell) {
+		return 0, fmt.Errorf("no row in range %q", a1)
+	}
+	return row, nil
+}
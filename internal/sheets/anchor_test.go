@@ -0,0 +1,112 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRangeRow(t *testing.T) {
+	for a1, want := range map[string]int{
+		"CraftTime!A5:J5":      5,
+		"'Craft Time'!A12:K12": 12,
+		"'a!b'!AB3":            3,
+		"A7":                   7,
+	} {
+		got, err := rangeRow(a1)
+		if err != nil || got != want {
+			t.Errorf("%s: expected row %d, got %d (%v)", a1, want, got, err)
+		}
+	}
+
+	for _, a1 := range []string{"", "CraftTime!A:J", "CraftTime!5", "CraftTime!A0"} {
+		if _, err := rangeRow(a1); err == nil {
+			t.Errorf("%q: expected an error, got nil", a1)
+		}
+	}
+}
+
+func TestRowAnchors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rows are tagged with the session", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := server.Metadata("sheet-id", "CraftTime", anchorKey, "session-1"); got != state.RowNumber {
+			t.Errorf("expected row %d to be tagged, got %d", state.RowNumber, got)
+		}
+	})
+
+	t.Run("moved rows are found", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		server.SetValues("sheet-id", "CraftTime", [][]string{
+			{"Project", "Task", "Date", "Start Time", "End Time", "Duration", "Notes", "Tags", "Rate", "Profile"},
+			{"rug", "weaving"},
+			{"hat", "knitting"},
+		})
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if state.RowNumber != 4 {
+			t.Fatalf("expected row 4, got %d", state.RowNumber)
+		}
+
+		// quilt sorts between hat and rug, then moves down by two
+		server.SortRows("sheet-id", "CraftTime", "A", false)
+		server.InsertRows("sheet-id", "CraftTime", 2, 2)
+
+		p.Session.AddNote("sorted")
+		p.Session.Stop()
+		if err := SyncGoogleSheetsRow(ctx, p, state); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		rows := server.Values("sheet-id", "CraftTime")
+		if len(rows) != 6 {
+			t.Fatalf("expected 6 rows, got %v", rows)
+		}
+		if rows[4][0] != "quilt" || rows[4][4] == "" || rows[4][6] == "" {
+			t.Errorf("expected the moved row to be updated, got %v", rows[4])
+		}
+		if rows[3][0] != "hat" || rows[5][0] != "rug" || len(rows[5]) != 2 {
+			t.Errorf("expected the other rows to be untouched, got %v", rows)
+		}
+	})
+
+	t.Run("a deleted row is reported", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		server.DeleteRow("sheet-id", "CraftTime", state.RowNumber)
+
+		err = SyncGoogleSheetsRow(ctx, p, state)
+		var missing *MissingAnchorError
+		if !errors.As(err, &missing) {
+			t.Fatalf("expected a missing anchor, got: %v", err)
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 1 {
+			t.Errorf("expected only the headers, got %v", rows)
+		}
+	})
+
+	t.Run("sessions need an ID", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		p.Session.ID = ""
+
+		if _, err := InitRow(ctx, p); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 0 {
+			t.Errorf("expected nothing written, got %v", rows)
+		}
+	})
+}
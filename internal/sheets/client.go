@@ -0,0 +1,86 @@
+package sheets
+
+import (
+	"context"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Client is the part of the Google Sheets API craftie uses. Values are
+// written as USER_ENTERED, so formulas and dates are parsed by Sheets.
+type Client interface {
+	// GetValues reads the cells of an A1 range unformatted, numbers as
+	// numbers and dates as serial numbers
+	GetValues(ctx context.Context, spreadsheetID, readRange string) (*sheets.ValueRange, error)
+	// UpdateValues writes values to an A1 range
+	UpdateValues(ctx context.Context, spreadsheetID, writeRange string, values [][]any) (*sheets.UpdateValuesResponse, error)
+	// AppendValues adds rows after the table found in an A1 range
+	AppendValues(ctx context.Context, spreadsheetID, tableRange string, values [][]any) (*sheets.AppendValuesResponse, error)
+	// BatchUpdateValues writes several ranges in one request
+	BatchUpdateValues(ctx context.Context, spreadsheetID string, data []*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error)
+	// BatchUpdateValuesByDataFilter writes to the ranges found by data
+	// filters, e.g. rows tagged with developer metadata
+	BatchUpdateValuesByDataFilter(ctx context.Context, spreadsheetID string, data []*sheets.DataFilterValueRange) (*sheets.BatchUpdateValuesByDataFilterResponse, error)
+	// GetSpreadsheet reads the spreadsheet and sheet properties and the
+	// conditional formats of the sheets
+	GetSpreadsheet(ctx context.Context, spreadsheetID string) (*sheets.Spreadsheet, error)
+	// SearchDeveloperMetadata finds developer metadata, e.g. the tags on rows
+	SearchDeveloperMetadata(ctx context.Context, spreadsheetID string, filters []*sheets.DataFilter) (*sheets.SearchDeveloperMetadataResponse, error)
+	// BatchUpdate applies structural changes, e.g. adding a sheet
+	BatchUpdate(ctx context.Context, spreadsheetID string, requests []*sheets.Request) (*sheets.BatchUpdateSpreadsheetResponse, error)
+}
+
+// NewClient wraps a Sheets API service
+func NewClient(srv *sheets.Service) Client {
+	return &serviceClient{srv: srv}
+}
+
+type serviceClient struct {
+	srv *sheets.Service
+}
+
+func (c *serviceClient) GetValues(ctx context.Context, spreadsheetID, readRange string) (*sheets.ValueRange, error) {
+	return c.srv.Spreadsheets.Values.Get(spreadsheetID, readRange).
+		ValueRenderOption("UNFORMATTED_VALUE").
+		DateTimeRenderOption("SERIAL_NUMBER").
+		Context(ctx).Do()
+}
+
+func (c *serviceClient) UpdateValues(ctx context.Context, spreadsheetID, writeRange string, values [][]any) (*sheets.UpdateValuesResponse, error) {
+	return c.srv.Spreadsheets.Values.Update(spreadsheetID, writeRange, &sheets.ValueRange{Values: values}).
+		ValueInputOption("USER_ENTERED").
+		Context(ctx).Do()
+}
+
+func (c *serviceClient) AppendValues(ctx context.Context, spreadsheetID, tableRange string, values [][]any) (*sheets.AppendValuesResponse, error) {
+	return c.srv.Spreadsheets.Values.Append(spreadsheetID, tableRange, &sheets.ValueRange{Values: values}).
+		ValueInputOption("USER_ENTERED").
+		InsertDataOption("INSERT_ROWS").
+		Context(ctx).Do()
+}
+
+func (c *serviceClient) BatchUpdateValues(ctx context.Context, spreadsheetID string, data []*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error) {
+	req := &sheets.BatchUpdateValuesRequest{ValueInputOption: "USER_ENTERED", Data: data}
+	return c.srv.Spreadsheets.Values.BatchUpdate(spreadsheetID, req).Context(ctx).Do()
+}
+
+func (c *serviceClient) BatchUpdateValuesByDataFilter(ctx context.Context, spreadsheetID string, data []*sheets.DataFilterValueRange) (*sheets.BatchUpdateValuesByDataFilterResponse, error) {
+	req := &sheets.BatchUpdateValuesByDataFilterRequest{ValueInputOption: "USER_ENTERED", Data: data}
+	return c.srv.Spreadsheets.Values.BatchUpdateByDataFilter(spreadsheetID, req).Context(ctx).Do()
+}
+
+func (c *serviceClient) GetSpreadsheet(ctx context.Context, spreadsheetID string) (*sheets.Spreadsheet, error) {
+	return c.srv.Spreadsheets.Get(spreadsheetID).
+		Fields("spreadsheetId", "properties", "sheets.properties", "sheets.conditionalFormats").
+		Context(ctx).Do()
+}
+
+func (c *serviceClient) SearchDeveloperMetadata(ctx context.Context, spreadsheetID string, filters []*sheets.DataFilter) (*sheets.SearchDeveloperMetadataResponse, error) {
+	req := &sheets.SearchDeveloperMetadataRequest{DataFilters: filters}
+	return c.srv.Spreadsheets.DeveloperMetadata.Search(spreadsheetID, req).Context(ctx).Do()
+}
+
+func (c *serviceClient) BatchUpdate(ctx context.Context, spreadsheetID string, requests []*sheets.Request) (*sheets.BatchUpdateSpreadsheetResponse, error) {
+	req := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+	return c.srv.Spreadsheets.BatchUpdate(spreadsheetID, req).Context(ctx).Do()
+}
@@ -1,57 +1,81 @@
 package sheets
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
-	"strings"
 
-	"github.com/zalando/go-keyring"
+	"github.com/vlad/craftie/internal/auth"
+	"github.com/vlad/craftie/internal/config"
+	"google.golang.org/api/sheets/v4"
 )
 
-// GetCredentials fetches Google service account credentials.
-// If credentialsHelper is provided, it will be used to fetch credentials,
-// otherwise falls back to the system keyring.
-func GetCredentials(credentialsHelper string) ([]byte, error) {
-	if credentialsHelper != "" {
-		credentials, err := ExecuteCredentialsHelper(credentialsHelper)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get credentials from helper: %w", err)
-		}
-		return credentials, nil
-	}
+// credentialsRequest is what credential helpers are asked for
+var credentialsRequest = auth.Request{
+	Protocol: "https",
+	Host:     "sheets.googleapis.com",
+	Scope:    sheets.SpreadsheetsScope,
+}
 
-	// Fall back to keyring
-	credsStr, err := keyring.Get("craftie", "google-sheets")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get credentials from keyring: %w", err)
+// CredentialsStore returns where the Google credentials are kept, the
+// credentials helper if one is configured, otherwise the system keyring
+func CredentialsStore(cfg config.GoogleSheetsConfig) (auth.Store, error) {
+	if cfg.CredentialsHelper == "" {
+		return auth.KeyringStore{}, nil
 	}
-	return []byte(credsStr), nil
-}
 
-// ExecuteCredentialsHelper runs the credentials helper script and returns the output
-func ExecuteCredentialsHelper(helperPath string) ([]byte, error) {
-	// Check if helper script exists and is executable
-	info, err := os.Stat(helperPath)
+	helper, err := auth.NewHelper(cfg.CredentialsHelper, cfg.CredentialsHelperFormat, cfg.CredentialsHelperTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("credentials helper not found: %w", err)
+		return nil, err
 	}
+	return &auth.HelperStore{
+		Helper:  helper,
+		Request: credentialsRequest,
+		Cache:   auth.NewCache(cfg.CredentialsCache),
+		TTL:     cfg.CredentialsCacheTTL,
+	}, nil
+}
 
-	// Check if it's executable (Unix permissions)
-	if info.Mode()&0111 == 0 {
-		return nil, fmt.Errorf("credentials helper is not executable: %s (run: chmod +x %s)", helperPath, helperPath)
+// CredentialSources returns the sources of google_sheets.credentials_sources,
+// in order
+func CredentialSources(cfg config.GoogleSheetsConfig) ([]auth.Source, error) {
+	var sources []auth.Source
+	for _, name := range cfg.CredentialsSources {
+		switch name {
+		case "helper":
+			source := &auth.StoreSource{SourceName: name}
+			if cfg.CredentialsHelper != "" {
+				store, err := CredentialsStore(cfg)
+				if err != nil {
+					return nil, err
+				}
+				source.Store = store
+			}
+			sources = append(sources, source)
+		case "keyring":
+			sources = append(sources, &auth.StoreSource{SourceName: name, Store: auth.KeyringStore{}})
+		case "file":
+			sources = append(sources, &auth.FileSource{SourceName: name, Path: cfg.CredentialsFile, Unset: "google_sheets.credentials_file is not set"})
+		case "env":
+			sources = append(sources, auth.EnvSource())
+		case "adc":
+			sources = append(sources, auth.ADCSource{})
+		case "token":
+			sources = append(sources, &auth.AccessTokenSource{Command: cfg.AccessTokenCommand, Timeout: cfg.CredentialsHelperTimeout})
+		default:
+			return nil, fmt.Errorf("unknown credentials source %q", name)
+		}
 	}
+	return sources, nil
+}
 
-	// Execute the helper script
-	cmd := exec.Command(helperPath)
-	output, err := cmd.Output()
+// GetCredentials fetches Google credentials from the first of the configured
+// sources that has some: a credentials helper, a credentials file, an access
+// token, GOOGLE_APPLICATION_CREDENTIALS, the keyring or application default
+// credentials. The error lists every source that was tried.
+func GetCredentials(ctx context.Context, cfg config.GoogleSheetsConfig) (*auth.Credentials, error) {
+	sources, err := CredentialSources(cfg)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, fmt.Errorf("credentials helper failed: %s", string(exitErr.Stderr))
-		}
-		return nil, fmt.Errorf("failed to execute credentials helper: %w", err)
+		return nil, err
 	}
-
-	// Trim whitespace from output
-	return []byte(strings.TrimSpace(string(output))), nil
+	return auth.Detect(ctx, sources, sheets.SpreadsheetsScope)
 }
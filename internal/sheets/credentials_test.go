@@ -1,12 +1,37 @@
 package sheets
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/auth"
+	"github.com/vlad/craftie/internal/config"
 )
 
-func TestExecuteCredentialsHelper(t *testing.T) {
+// helperOutput asks the credentials helper configured in cfg for credentials
+func helperOutput(cfg config.GoogleSheetsConfig) ([]byte, error) {
+	store, err := CredentialsStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(context.Background())
+}
+
+// helperConfig uses command as the credentials helper, without caching
+func helperConfig(command string) config.GoogleSheetsConfig {
+	return config.GoogleSheetsConfig{
+		CredentialsHelper:        command,
+		CredentialsHelperFormat:  auth.FormatKeyValue,
+		CredentialsHelperTimeout: 5 * time.Second,
+		CredentialsCache:         auth.CacheNone,
+	}
+}
+
+func TestCredentialsHelper(t *testing.T) {
 	// Create a temporary directory for test scripts
 	tempDir := t.TempDir()
 
@@ -22,7 +47,7 @@ echo '{"type": "service_account", "project_id": "test-project"}'`
 		}
 
 		// Execute the helper
-		result, err := ExecuteCredentialsHelper(helperPath)
+		result, err := helperOutput(helperConfig(helperPath))
 		if err != nil {
 			t.Fatalf("expected no error, got: %v", err)
 		}
@@ -36,7 +61,7 @@ echo '{"type": "service_account", "project_id": "test-project"}'`
 	t.Run("non-existent helper script", func(t *testing.T) {
 		helperPath := filepath.Join(tempDir, "does-not-exist.sh")
 
-		_, err := ExecuteCredentialsHelper(helperPath)
+		_, err := helperOutput(helperConfig(helperPath))
 		if err == nil {
 			t.Fatal("expected error for non-existent script, got nil")
 		}
@@ -53,7 +78,7 @@ echo '{"test": "data"}'`
 			t.Fatalf("failed to create test helper: %v", err)
 		}
 
-		_, err = ExecuteCredentialsHelper(helperPath)
+		_, err = helperOutput(helperConfig(helperPath))
 		if err == nil {
 			t.Fatal("expected error for non-executable script, got nil")
 		}
@@ -71,10 +96,105 @@ exit 1`
 			t.Fatalf("failed to create test helper: %v", err)
 		}
 
-		_, err = ExecuteCredentialsHelper(helperPath)
+		_, err = helperOutput(helperConfig(helperPath))
 		if err == nil {
 			t.Fatal("expected error for failing script, got nil")
 		}
 	})
 
+	t.Run("arguments and request", func(t *testing.T) {
+		// The helper echoes its arguments and the request it was given
+		helperPath := filepath.Join(tempDir, "echo-helper.sh")
+		helperContent := `#!/bin/bash
+printf 'credentials={"type":"service_account","args":"%s","request":"%s"}\n' "$*" "$(cat | tr '\n' ' ')"`
+
+		err := os.WriteFile(helperPath, []byte(helperContent), 0755)
+		if err != nil {
+			t.Fatalf("failed to create test helper: %v", err)
+		}
+
+		result, err := helperOutput(helperConfig(helperPath + ` --vault "work stuff"`))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if !strings.Contains(string(result), `"args":"--vault work stuff get"`) {
+			t.Errorf("expected the arguments and action to be passed, got %s", result)
+		}
+		if !strings.Contains(string(result), "host=sheets.googleapis.com scope=https://www.googleapis.com/auth/spreadsheets") {
+			t.Errorf("expected a key=value request, got %s", result)
+		}
+	})
+
+	t.Run("json request", func(t *testing.T) {
+		helperPath := filepath.Join(tempDir, "json-helper.sh")
+		helperContent := `#!/bin/bash
+read -r request
+echo "{\"credentials\": $request}"`
+
+		err := os.WriteFile(helperPath, []byte(helperContent), 0755)
+		if err != nil {
+			t.Fatalf("failed to create test helper: %v", err)
+		}
+
+		cfg := helperConfig(helperPath)
+		cfg.CredentialsHelperFormat = auth.FormatJSON
+		result, err := helperOutput(cfg)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if !strings.HasPrefix(string(result), `{"protocol":"https"`) {
+			t.Errorf("expected the JSON request back, got %s", result)
+		}
+	})
+
+	t.Run("slow helper times out", func(t *testing.T) {
+		helperPath := filepath.Join(tempDir, "slow-helper.sh")
+		helperContent := `#!/bin/bash
+sleep 5`
+
+		err := os.WriteFile(helperPath, []byte(helperContent), 0755)
+		if err != nil {
+			t.Fatalf("failed to create test helper: %v", err)
+		}
+
+		cfg := helperConfig(helperPath)
+		cfg.CredentialsHelperTimeout = 100 * time.Millisecond
+		start := time.Now()
+		_, err = helperOutput(cfg)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("expected timeout error, got: %v", err)
+		}
+		if time.Since(start) > 3*time.Second {
+			t.Errorf("helper was not stopped at the timeout")
+		}
+	})
+
+	t.Run("cached in memory", func(t *testing.T) {
+		// The helper counts its runs in a file
+		countPath := filepath.Join(tempDir, "count")
+		helperPath := filepath.Join(tempDir, "counting-helper.sh")
+		helperContent := `#!/bin/bash
+echo run >> ` + countPath + `
+echo '{"type": "service_account"}'`
+
+		err := os.WriteFile(helperPath, []byte(helperContent), 0755)
+		if err != nil {
+			t.Fatalf("failed to create test helper: %v", err)
+		}
+
+		cfg := helperConfig(helperPath)
+		cfg.CredentialsCache = auth.CacheMemory
+		cfg.CredentialsCacheTTL = time.Minute
+		for range 3 {
+			if _, err := helperOutput(cfg); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+
+		runs, _ := os.ReadFile(countPath)
+		if n := strings.Count(string(runs), "run"); n != 1 {
+			t.Errorf("expected the helper to run once, ran %d times", n)
+		}
+	})
 }
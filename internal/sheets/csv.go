@@ -1,10 +1,14 @@
 package sheets
 
 import (
+	"bytes"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/vlad/craftie/internal/session"
 )
@@ -13,36 +17,27 @@ import (
 type CsvSyncState struct {
 	FilePath  string
 	RowOffset int64 // byte offset where the row starts
+	// Header is the header row of the file, rows are written in its order
+	Header []string
+	// row is the row as last written, found again by it when rows before
+	// it changed
+	row []byte
 }
 
-// InitCsvRow creates the initial row for an in-progress session
+// InitCsvRow creates the initial row for an in-progress session. A file
+// written before columns were added gets them added to its header row.
 func InitCsvRow(filePath string, session *session.Session) (*CsvSyncState, error) {
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+	header, err := prepareCsv(filePath)
+	if err != nil {
+		return nil, err
 	}
 
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open CSV file: %w", err)
 	}
 	defer file.Close()
 
-	// Read existing rows
-	reader := csv.NewReader(file)
-	existingRows, _ := reader.ReadAll()
-
-	writer := csv.NewWriter(file)
-
-	// Add headers if empty
-	if len(existingRows) == 0 {
-		headers := []string{"Project", "Task", "Date", "Start Time", "End Time", "Duration", "Notes"}
-		if err := writer.Write(headers); err != nil {
-			return nil, fmt.Errorf("failed to write CSV headers: %w", err)
-		}
-		writer.Flush()
-	}
-
 	// Get current file size - this is where our row will start
 	stat, err := file.Stat()
 	if err != nil {
@@ -50,36 +45,295 @@ func InitCsvRow(filePath string, session *session.Session) (*CsvSyncState, error
 	}
 	rowOffset := stat.Size()
 
-	record := SessionToCsvRow(session)
-
-	if err := writer.Write(record); err != nil {
+	row, err := csvLine(csvRecord(header, session))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(row); err != nil {
 		return nil, fmt.Errorf("failed to write CSV record: %w", err)
 	}
-	writer.Flush()
 
-	return &CsvSyncState{FilePath: filePath, RowOffset: rowOffset}, nil
+	return &CsvSyncState{FilePath: filePath, RowOffset: rowOffset, Header: header, row: row}, nil
 }
 
-// SyncCsvRow updates the row at RowOffset with current session data
+// SyncCsvRow updates the row at RowOffset with current session data. The row
+// is replaced in place, rows added after it, e.g. by export, are kept.
 func SyncCsvRow(state *CsvSyncState, session *session.Session) error {
-	file, err := os.OpenFile(state.FilePath, os.O_RDWR|os.O_APPEND, 0644)
+	file, err := os.OpenFile(state.FilePath, os.O_RDWR, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open CSV file: %w", err)
 	}
 	defer file.Close()
 
-	// Truncate to row start, then seek there to write
-	if err := file.Truncate(state.RowOffset); err != nil {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read CSV file: %w", err)
+	}
+	offset := state.RowOffset
+	if !bytes.HasPrefix(data[min(offset, int64(len(data))):], state.row) {
+		// rows before it changed, the header got new columns
+		i := bytes.Index(data, state.row)
+		if i < 0 {
+			return fmt.Errorf("the row of the session is no longer in %s", state.FilePath)
+		}
+		offset = int64(i)
+	}
+
+	row, err := csvLine(csvRecord(state.Header, session))
+	if err != nil {
+		return err
+	}
+	rest := append(row, data[offset+int64(len(state.row)):]...)
+	if _, err := file.WriteAt(rest, offset); err != nil {
+		return fmt.Errorf("failed to write CSV record: %w", err)
+	}
+	if err := file.Truncate(offset + int64(len(rest))); err != nil {
 		return fmt.Errorf("failed to truncate: %w", err)
 	}
 
-	record := SessionToCsvRow(session)
+	state.RowOffset, state.row = offset, row
+	return nil
+}
 
-	writer := csv.NewWriter(file)
-	if err := writer.Write(record); err != nil {
-		return fmt.Errorf("failed to write CSV record: %w", err)
+// csvLine is record as a line of CSV
+func csvLine(record []string) ([]byte, error) {
+	var b bytes.Buffer
+	writer := csv.NewWriter(&b)
+	writer.Write(record)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV record: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// prepareCsv creates the file with HEADERS, or adds the HEADERS missing
+// from the header row of an existing file after its last column. It returns
+// the header row.
+func prepareCsv(filePath string) ([]string, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
+
+	var header []string
+	var rest []byte
+	if len(data) > 0 {
+		reader := csv.NewReader(strings.NewReader(string(data)))
+		reader.FieldsPerRecord = -1
+		if header, err = reader.Read(); err != nil {
+			return nil, fmt.Errorf("failed to read CSV headers: %w", err)
+		}
+		rest = data[reader.InputOffset():]
+	}
+
+	columns := csvColumns(header)
+	if _, ok := columns["Project"]; len(header) > 0 && !ok {
+		return nil, fmt.Errorf("%s has no Project column, the first row must be the headers", filePath)
+	}
+	var missing []string
+	for _, h := range HEADERS {
+		if _, ok := columns[h.(string)]; !ok {
+			missing = append(missing, h.(string))
+		}
+	}
+	if len(missing) == 0 && (len(rest) == 0 || rest[len(rest)-1] == '\n') {
+		return header, nil
 	}
+	header = append(header, missing...)
+
+	// the header row changes length, the file is rewritten with the other
+	// rows as they are
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	writer.Write(header)
 	writer.Flush()
+	b.Write(rest)
+	if len(rest) > 0 && rest[len(rest)-1] != '\n' {
+		b.WriteString("\n")
+	}
+	if err := writeFileAtomic(filePath, []byte(b.String())); err != nil {
+		return nil, fmt.Errorf("failed to write CSV headers: %w", err)
+	}
+	return header, nil
+}
 
+// writeFileAtomic replaces a file by renaming a complete copy over it,
+// keeping its mode
+func writeFileAtomic(filePath string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filePath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".craftie-*.csv")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// csvColumns finds the columns of a header row by name
+func csvColumns(header []string) map[string]int {
+	columns := map[string]int{}
+	for i, name := range header {
+		// spreadsheet apps may save a byte order mark
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	return columns
+}
+
+// csvRecord is the row of a session in the order of header, columns
+// craftie does not write are left empty
+func csvRecord(header []string, s *session.Session) []string {
+	values := SessionToCsvRow(s)
+	if header == nil {
+		return values
+	}
+	columns := csvColumns(header)
+	record := make([]string, len(header))
+	for i, h := range HEADERS {
+		if col, ok := columns[h.(string)]; ok {
+			record[col] = values[i]
+		}
+	}
+	return record
+}
+
+// CsvSessionKey identifies a session in a CSV file, which has no session
+// IDs, by its project, date and start time
+func CsvSessionKey(s *session.Session) string {
+	values := SessionToCsvRow(s)
+	return csvKey(values[0], values[2], values[3])
+}
+
+func csvKey(project, date, start string) string {
+	return project + "\x00" + date + "\x00" + start
+}
+
+// CsvSessionKeys reads the keys of the sessions in a CSV file, a missing
+// or empty file has none
+func CsvSessionKeys(filePath string) (map[string]bool, error) {
+	rows, _, err := ReadCsvRows(filePath)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, io.EOF) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for _, row := range rows {
+		keys[csvKey(row.Values["Project"], row.Values["Date"], row.Values["Start Time"])] = true
+	}
+	return keys, nil
+}
+
+// AppendCsvRows appends the rows of sessions, a new file gets the headers
+// first and an older one the columns added since
+func AppendCsvRows(filePath string, sessions []*session.Session) error {
+	header, err := prepareCsv(filePath)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	for _, s := range sessions {
+		if err := writer.Write(csvRecord(header, s)); err != nil {
+			return fmt.Errorf("failed to write CSV record: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV records: %w", err)
+	}
 	return nil
 }
+
+// CsvRow is a row of a CSV file as text by header
+type CsvRow struct {
+	// Line is where the row starts in the file, 1-based
+	Line   int
+	Values map[string]string
+}
+
+// CsvRowError is a line of a CSV file that could not be read
+type CsvRowError struct {
+	Line int
+	Err  error
+}
+
+func (e *CsvRowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ReadCsvRows reads the rows of a CSV file written by InitCsvRow, columns
+// are found by the header row so files written before columns were added
+// can be read. Lines that are not valid CSV are returned as errors and the
+// rows after them are still read.
+func ReadCsvRows(filePath string) ([]CsvRow, []*CsvRowError, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV headers: %w", err)
+	}
+	columns := csvColumns(header)
+	for _, required := range []string{"Project", "Date", "Start Time"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("%s has no %s column, the first row must be the headers", filePath, required)
+		}
+	}
+
+	var rows []CsvRow
+	var rowErrors []*CsvRowError
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrors = append(rowErrors, &CsvRowError{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CSV file: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := CsvRow{Line: line, Values: map[string]string{}}
+		for _, h := range HEADERS {
+			name := h.(string)
+			if i, ok := columns[name]; ok && i < len(record) {
+				row.Values[name] = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
@@ -0,0 +1,105 @@
+package sheets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/session"
+)
+
+func TestCsvRows(t *testing.T) {
+	start := time.Date(2025, 3, 14, 9, 30, 0, 0, time.Local)
+	newSession := func() *session.Session {
+		return &session.Session{ID: "a", StartTime: start, ProjectName: "quilt", Task: "cutting", Tags: []string{"gift"}, Rate: 40, Profile: "business"}
+	}
+
+	t.Run("a new file gets the headers", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sessions", "craftie.csv")
+		if _, err := InitCsvRow(path, newSession()); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 2 || lines[0] != "Project,Task,Date,Start Time,End Time,Duration,Notes,Tags,Rate,Profile" {
+			t.Errorf("expected the headers and a row, got %q", lines)
+		}
+	})
+
+	t.Run("older files get the new columns", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie.csv")
+		// written before Tags, Rate and Profile were added, without a final newline
+		old := "Project,Task,Date,Start Time,End Time,Duration,Notes\n" +
+			"hat,,2025-03-13,10:00:00,11:00:00,01:00:00,\"wool, blue\""
+		if err := os.WriteFile(path, []byte(old), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		s := newSession()
+		state, err := InitCsvRow(path, s)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		s.Finish(start.Add(2*time.Hour), 2*time.Hour)
+		if err := SyncCsvRow(state, s); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		data, _ := os.ReadFile(path)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 3 || lines[0] != "Project,Task,Date,Start Time,End Time,Duration,Notes,Tags,Rate,Profile" ||
+			lines[1] != "hat,,2025-03-13,10:00:00,11:00:00,01:00:00,\"wool, blue\"" {
+			t.Fatalf("expected the header extended and the old row kept, got %q", lines)
+		}
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+			t.Errorf("expected the file mode kept, got %v", info.Mode())
+		}
+
+		rows, rowErrors, err := ReadCsvRows(path)
+		if err != nil || len(rowErrors) != 0 {
+			t.Fatalf("expected no error, got: %v %v", err, rowErrors)
+		}
+		if len(rows) != 2 || rows[0].Values["Notes"] != "wool, blue" || rows[0].Values["Tags"] != "" {
+			t.Errorf("expected the old row, got %+v", rows)
+		}
+		if got := rows[1].Values; got["Tags"] != "gift" || got["Rate"] != "40" || got["Profile"] != "business" || got["End Time"] != "11:30:00" {
+			t.Errorf("expected the new columns read back, got %v", got)
+		}
+	})
+
+	t.Run("rows follow the order of the header", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie.csv")
+		header := "Date,Project,Start Time,Client,Task,End Time,Duration,Notes,Tags,Rate,Profile\n"
+		if err := os.WriteFile(path, []byte(header), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AppendCsvRows(path, []*session.Session{newSession()}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		data, _ := os.ReadFile(path)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[1], "2025-03-14,quilt,09:30:00,,cutting,In progress,") {
+			t.Errorf("expected the row in the header's order, got %q", lines)
+		}
+		keys, err := CsvSessionKeys(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if !keys[CsvSessionKey(newSession())] {
+			t.Errorf("expected the session to be found, got %v", keys)
+		}
+	})
+
+	t.Run("files without a header row are refused", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie.csv")
+		if err := os.WriteFile(path, []byte("quilt,cutting,2025-03-14\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := InitCsvRow(path, newSession()); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
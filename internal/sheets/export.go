@@ -0,0 +1,55 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vlad/craftie/internal/session"
+)
+
+// ExportedSessions is the set of sessions rows of the spreadsheet are
+// tagged with
+func ExportedSessions(ctx context.Context, p GoogleSheetsParams) (map[string]bool, error) {
+	anchors, err := readAnchors(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, id := range anchors {
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// AppendSessions appends the rows of sessions, each to the tab sheet_name
+// gives for its start, and tags them with their sessions. Each tab takes an
+// append and a tag request however many rows it gets. The timezone of the
+// spreadsheet the rows were written in is returned.
+func AppendSessions(ctx context.Context, p GoogleSheetsParams, sessions []*session.Session) (*time.Location, error) {
+	var names []string
+	byTab := map[string][]*session.Session{}
+	for _, s := range sessions {
+		if s.ID == "" {
+			return nil, errors.New("session has no ID to find its row by")
+		}
+		name, err := GoogleSheetsParams{Cfg: p.Cfg, Session: s}.SheetName()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := byTab[name]; !ok {
+			names = append(names, name)
+		}
+		byTab[name] = append(byTab[name], s)
+	}
+
+	loc := time.Local
+	for _, name := range names {
+		tab, _, _, err := appendRows(ctx, p, name, byTab[name])
+		if err != nil {
+			return nil, err
+		}
+		loc = tab.location
+	}
+	return loc, nil
+}
@@ -0,0 +1,126 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// sheetsEpoch is day 0 of the date serial numbers Sheets stores
+var sheetsEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// serialDate is t as a Sheets date time value, days since sheetsEpoch, of
+// the wall clock in loc
+func serialDate(t time.Time, loc *time.Location) float64 {
+	t = t.In(loc)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return float64(wall.Unix()-sheetsEpoch.Unix()) / 86400
+}
+
+// serialDay is the date of t in loc without the time
+func serialDay(t time.Time, loc *time.Location) float64 {
+	t = t.In(loc)
+	return serialDate(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), loc)
+}
+
+// serialDuration is d as a fraction of days, so it can be over a day
+func serialDuration(d time.Duration) float64 {
+	return float64(d.Round(time.Second)/time.Second) / 86400
+}
+
+// columnFormats are the number formats of the typed columns
+var columnFormats = map[string]*sheets.NumberFormat{
+	"Date":       {Type: "DATE", Pattern: "yyyy-mm-dd"},
+	"Start Time": {Type: "TIME", Pattern: "hh:mm:ss"},
+	"End Time":   {Type: "TIME", Pattern: "hh:mm:ss"},
+	// [h] keeps counting past 24 hours
+	"Duration": {Type: "TIME", Pattern: "[h]:mm:ss"},
+	"Rate":     {Type: "NUMBER", Pattern: "0.00"},
+}
+
+// inProgressColor is the background of rows of running sessions
+var inProgressColor = &sheets.Color{Red: 1, Green: 0.95, Blue: 0.8}
+
+// inProgressRule matches the formula of the rule written by formatTab, for
+// any columns
+var inProgressRule = regexp.MustCompile(`^=AND\(\$[A-Z]+2<>"",\$[A-Z]+2=""\)$`)
+
+// inProgressFormula highlights rows with a project but no end time
+func inProgressFormula(layout *Layout) string {
+	return fmt.Sprintf(`=AND($%s2<>"",$%s2="")`, columnName(layout.column("Project")), columnName(layout.column("End Time")))
+}
+
+// formatted tells whether formatTab already ran for layout
+func formatted(sheet *sheets.Sheet, layout *Layout) bool {
+	for _, rule := range sheet.ConditionalFormats {
+		if f := ruleFormula(rule); f == inProgressFormula(layout) {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleFormula(rule *sheets.ConditionalFormatRule) string {
+	if rule.BooleanRule == nil || rule.BooleanRule.Condition == nil || rule.BooleanRule.Condition.Type != "CUSTOM_FORMULA" {
+		return ""
+	}
+	if values := rule.BooleanRule.Condition.Values; len(values) == 1 {
+		return values[0].UserEnteredValue
+	}
+	return ""
+}
+
+// formatTab sets the number formats of the typed columns below the header
+// and highlights in-progress rows, replacing a rule written for other columns
+func formatTab(ctx context.Context, p GoogleSheetsParams, sheet *sheets.Sheet, layout *Layout) error {
+	sheetID := sheet.Properties.SheetId
+	var requests []*sheets.Request
+
+	// delete from the last, indexes of later rules shift
+	for i, rule := range slices.Backward(sheet.ConditionalFormats) {
+		if inProgressRule.MatchString(ruleFormula(rule)) {
+			requests = append(requests, &sheets.Request{
+				DeleteConditionalFormatRule: &sheets.DeleteConditionalFormatRuleRequest{SheetId: sheetID, Index: int64(i)},
+			})
+		}
+	}
+
+	for i, header := range HEADERS {
+		format, ok := columnFormats[header.(string)]
+		if !ok {
+			continue
+		}
+		col := int64(layout.Columns[i])
+		requests = append(requests, &sheets.Request{
+			RepeatCell: &sheets.RepeatCellRequest{
+				Range:  &sheets.GridRange{SheetId: sheetID, StartRowIndex: 1, StartColumnIndex: col, EndColumnIndex: col + 1},
+				Cell:   &sheets.CellData{UserEnteredFormat: &sheets.CellFormat{NumberFormat: format}},
+				Fields: "userEnteredFormat.numberFormat",
+			},
+		})
+	}
+
+	requests = append(requests, &sheets.Request{
+		AddConditionalFormatRule: &sheets.AddConditionalFormatRuleRequest{
+			Rule: &sheets.ConditionalFormatRule{
+				Ranges: []*sheets.GridRange{{SheetId: sheetID, StartRowIndex: 1, EndColumnIndex: int64(layout.width())}},
+				BooleanRule: &sheets.BooleanRule{
+					Condition: &sheets.BooleanCondition{
+						Type:   "CUSTOM_FORMULA",
+						Values: []*sheets.ConditionValue{{UserEnteredValue: inProgressFormula(layout)}},
+					},
+					Format: &sheets.CellFormat{BackgroundColor: inProgressColor},
+				},
+			},
+		},
+	})
+
+	if _, err := p.Client.BatchUpdate(ctx, p.Cfg.SpreadsheetID, requests); err != nil {
+		return fmt.Errorf("failed to format sheet: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package sheets
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSerialValues(t *testing.T) {
+	utc := time.UTC
+	belgrade, err := time.LoadLocation("Europe/Belgrade")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+
+	start := time.Date(2025, 3, 14, 23, 30, 0, 0, utc)
+	if got := serialDate(start, utc); got != 45730+23.5/24 {
+		t.Errorf("expected 45730.979..., got %v", got)
+	}
+	if got := serialDay(start, utc); got != 45730 {
+		t.Errorf("expected 45730, got %v", got)
+	}
+	// already the next day in Belgrade
+	if got := serialDay(start, belgrade); got != 45731 {
+		t.Errorf("expected 45731, got %v", got)
+	}
+	if got := serialDate(start, belgrade); got != 45731+0.5/24 {
+		t.Errorf("expected 45731.020..., got %v", got)
+	}
+
+	if got := serialDuration(26*time.Hour + 30*time.Minute); got != 26.5/24 {
+		t.Errorf("expected more than a day, got %v", got)
+	}
+}
+
+func TestTypedCells(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sheet is formatted once", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		for col, want := range map[string]string{"C": "yyyy-mm-dd", "D": "hh:mm:ss", "E": "hh:mm:ss", "F": "[h]:mm:ss", "I": "0.00", "A": ""} {
+			if got := server.NumberFormat("sheet-id", "CraftTime", col); got != want {
+				t.Errorf("column %s: expected format %q, got %q", col, want, got)
+			}
+		}
+		rules := server.ConditionalFormats("sheet-id", "CraftTime")
+		if len(rules) != 1 || rules[0] != `=AND($A2<>"",$E2="")` {
+			t.Errorf("expected the in-progress rule, got %v", rules)
+		}
+
+		requests := server.Requests()
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		// spreadsheet, headers, append and anchor
+		if got := server.Requests() - requests; got != 4 {
+			t.Errorf("expected 4 requests once formatted, got %d", got)
+		}
+		if rules := server.ConditionalFormats("sheet-id", "CraftTime"); len(rules) != 1 {
+			t.Errorf("expected one rule, got %v", rules)
+		}
+	})
+
+	t.Run("rule follows moved columns", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		server.SetValues("sheet-id", "CraftTime", [][]string{
+			{"Date", "Project", "Task", "Start Time", "End Time", "Duration", "Notes", "Tags", "Rate", "Profile"},
+		})
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		rules := server.ConditionalFormats("sheet-id", "CraftTime")
+		if len(rules) != 1 || rules[0] != `=AND($B2<>"",$E2="")` {
+			t.Errorf("expected the rule to be replaced, got %v", rules)
+		}
+		if got := server.NumberFormat("sheet-id", "CraftTime", "A"); got != "yyyy-mm-dd" {
+			t.Errorf("expected the moved Date column to be formatted, got %q", got)
+		}
+	})
+
+	t.Run("spreadsheet timezone", func(t *testing.T) {
+		if _, err := time.LoadLocation("America/New_York"); err != nil {
+			t.Skipf("no timezone data: %v", err)
+		}
+		server, p := fakeSheets(t, "CraftTime")
+		server.SetTimeZone("sheet-id", "America/New_York")
+		p.Session.StartTime = time.Date(2025, 3, 14, 2, 0, 0, 0, time.UTC)
+
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		row := server.Values("sheet-id", "CraftTime")[1]
+		// 22:00 the day before in New York
+		if row[2] != "45729" || !strings.HasPrefix(row[3], "45729.9166") {
+			t.Errorf("expected the New York date and time, got %v", row)
+		}
+	})
+
+	t.Run("long sessions", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		p.Session.StartTime = time.Now().Add(-30 * time.Hour)
+		p.Session.Rate = 40
+
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		row := server.Values("sheet-id", "CraftTime")[1]
+		if !strings.HasPrefix(row[5], "1.25") || row[8] != "40" {
+			t.Errorf("expected a duration of 1.25 days and a numeric rate, got %v", row)
+		}
+	})
+}
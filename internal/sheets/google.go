@@ -2,110 +2,333 @@ package sheets
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"regexp"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/vlad/craftie/internal/config"
 	"github.com/vlad/craftie/internal/session"
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
-// NewSheetsClient creates a Google Sheets service client.
-func NewSheetsClient(ctx context.Context, credentialsHelper string) (*sheets.Service, error) {
-	credentials, err := GetCredentials(credentialsHelper)
+// NewSheetsClient creates a Google Sheets client.
+func NewSheetsClient(ctx context.Context, cfg config.GoogleSheetsConfig) (Client, error) {
+	creds, err := GetCredentials(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	jwtConfig, err := google.JWTConfigFromJSON(credentials, sheets.SpreadsheetsScope)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse credentials: %w", err)
-	}
-
-	httpClient := jwtConfig.Client(ctx)
-	srv, err := sheets.NewService(ctx, option.WithHTTPClient(httpClient))
+	srv, err := sheets.NewService(ctx, option.WithAuthCredentials(creds.Credentials))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sheets service: %w", err)
 	}
 
-	return srv, nil
+	return WithQuota(NewClient(srv), cfg.RequestsPerMinute, cfg.MaxRetries), nil
 }
 
 type GoogleSheetsParams struct {
-	Srv     *sheets.Service
+	Client  Client
 	Cfg     config.GoogleSheetsConfig
 	Session *session.Session
+	// Writer queues row updates for SyncGoogleSheetsRow. Kept across syncs,
+	// a write that failed goes out with the next one, nil writes each sync
+	// on its own.
+	Writer *Writer
+}
+
+// SheetName is the tab the session is written to, sheet_name evaluated for
+// its start. Without a session the current tab is returned.
+func (p GoogleSheetsParams) SheetName() (string, error) {
+	start := time.Now()
+	if p.Session != nil {
+		start = p.Session.StartTime
+	}
+	name, err := p.Cfg.SheetTitle(start)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve google_sheets.sheet_name: %w", err)
+	}
+	return name, nil
 }
 
-// SyncState tracks the row number for updating an in-progress session
+// SyncState tracks the row of an in-progress session
 type SyncState struct {
+	// RowNumber is where the row was appended, it moves when rows are
+	// sorted or inserted and is only used for messages
 	RowNumber int
+	// SheetName is the tab the row is in. A session running past the end of
+	// the month stays in the tab it started in.
+	SheetName string
+	// Layout is where the columns were when the row was created
+	Layout *Layout
+	// Location is the timezone of the spreadsheet
+	Location *time.Location
 }
 
-// InitRow creates the initial row for an in-progress session
-func InitRow(ctx context.Context, p GoogleSheetsParams) (*SyncState, error) {
-	quotedSheetName := fmt.Sprintf("'%s'", p.Cfg.SheetName)
+// quoteSheetName quotes a sheet name for A1 notation, quotes in the name are doubled
+func quoteSheetName(name string) string {
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
 
-	// Check if sheet has headers
-	readRange := fmt.Sprintf("%s!A1:G1", quotedSheetName)
-	resp, err := p.Srv.Spreadsheets.Values.Get(p.Cfg.SpreadsheetID, readRange).Do()
+// EnsureSheet adds a sheet to the spreadsheet unless it has one by that
+// name, and returns its properties
+func EnsureSheet(ctx context.Context, client Client, spreadsheetID, name string) (*sheets.SheetProperties, error) {
+	tab, err := openTab(ctx, client, spreadsheetID, name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read sheet headers: %w", err)
+		return nil, err
 	}
+	return tab.sheet.Properties, nil
+}
 
-	// If sheet is empty, add headers
-	if len(resp.Values) == 0 {
-		headerRange := fmt.Sprintf("%s!A1:G1", quotedSheetName)
-		headerValueRange := &sheets.ValueRange{
-			Values: [][]any{HEADERS},
-		}
-		_, err = p.Srv.Spreadsheets.Values.Update(p.Cfg.SpreadsheetID, headerRange, headerValueRange).
-			ValueInputOption("USER_ENTERED").Do()
-		if err != nil {
-			return nil, fmt.Errorf("failed to write headers: %w", err)
+// tab is a sheet craftie writes to
+type tab struct {
+	sheet *sheets.Sheet
+	// location is the timezone of the spreadsheet
+	location *time.Location
+	// header is the first row, set by readHeader
+	header []any
+}
+
+// openTab finds the sheet called name, adding it when missing
+func openTab(ctx context.Context, client Client, spreadsheetID, name string) (*tab, error) {
+	spreadsheet, err := client.GetSpreadsheet(ctx, spreadsheetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spreadsheet: %w", err)
+	}
+	t := &tab{location: spreadsheetLocation(spreadsheet)}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties != nil && sheet.Properties.Title == name {
+			t.sheet = sheet
+			return t, nil
 		}
 	}
 
-	appendRange := fmt.Sprintf("%s!A:G", quotedSheetName)
-	valueRange := &sheets.ValueRange{
-		Values: [][]any{SessionToSheet(p.Session)},
+	add := []*sheets.Request{{
+		AddSheet: &sheets.AddSheetRequest{Properties: &sheets.SheetProperties{Title: name}},
+	}}
+	resp, err := client.BatchUpdate(ctx, spreadsheetID, add)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sheet %q: %w", name, err)
+	}
+	t.sheet = &sheets.Sheet{Properties: resp.Replies[0].AddSheet.Properties}
+	return t, nil
+}
+
+// spreadsheetLocation is the timezone set in the spreadsheet settings, the
+// local one if it is unknown to Go
+func spreadsheetLocation(spreadsheet *sheets.Spreadsheet) *time.Location {
+	if spreadsheet.Properties == nil || spreadsheet.Properties.TimeZone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(spreadsheet.Properties.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// ReadLayout finds the craftie columns in the header row of the session's
+// sheet. A missing sheet is created and an empty one gets HEADERS.
+func ReadLayout(ctx context.Context, p GoogleSheetsParams) (*Layout, error) {
+	name, err := p.SheetName()
+	if err != nil {
+		return nil, err
 	}
+	tab, err := readHeader(ctx, p, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewLayout(tab.header), nil
+}
 
-	appendResp, err := p.Srv.Spreadsheets.Values.Append(p.Cfg.SpreadsheetID, appendRange, valueRange).
-		ValueInputOption("USER_ENTERED").
-		InsertDataOption("INSERT_ROWS").
-		Do()
+func readHeader(ctx context.Context, p GoogleSheetsParams, name string) (*tab, error) {
+	tab, err := openTab(ctx, p.Client, p.Cfg.SpreadsheetID, name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to append row: %w", err)
+		return nil, err
 	}
 
-	var rowNum = 0
-	re := regexp.MustCompile(`![A-Z]+(\d+)`)
-	matches := re.FindStringSubmatch(appendResp.Updates.UpdatedRange)
-	if len(matches) > 1 {
-		rowNum, _ = strconv.Atoi(matches[1])
+	quotedSheetName := quoteSheetName(name)
+	resp, err := p.Client.GetValues(ctx, p.Cfg.SpreadsheetID, quotedSheetName+"!1:1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet headers: %w", err)
+	}
+	if len(resp.Values) > 0 && len(resp.Values[0]) > 0 {
+		tab.header = resp.Values[0]
+		return tab, nil
 	}
 
-	return &SyncState{RowNumber: rowNum}, nil
+	headerRange := fmt.Sprintf("%s!A1:%s1", quotedSheetName, DefaultLayout().lastColumn())
+	if _, err := p.Client.UpdateValues(ctx, p.Cfg.SpreadsheetID, headerRange, [][]any{HEADERS}); err != nil {
+		return nil, fmt.Errorf("failed to write headers: %w", err)
+	}
+	tab.header = HEADERS
+	return tab, nil
 }
 
-// SyncGoogleSheetsRow updates an existing row with current session duration
-func SyncGoogleSheetsRow(ctx context.Context, p GoogleSheetsParams, state *SyncState) error {
-	quotedSheetName := fmt.Sprintf("'%s'", p.Cfg.SheetName)
+// MigrateHeaders adds the headers missing from the session's sheet after
+// its last column and returns them. Existing columns are left in place.
+func MigrateHeaders(ctx context.Context, p GoogleSheetsParams) ([]string, error) {
+	name, err := p.SheetName()
+	if err != nil {
+		return nil, err
+	}
+	tab, err := readHeader(ctx, p, name)
+	if err != nil {
+		return nil, err
+	}
+	missing := NewLayout(tab.header).Missing()
+	if len(missing) == 0 {
+		return missing, nil
+	}
 
-	updateRange := fmt.Sprintf("%s!A%d:G%d", quotedSheetName, state.RowNumber, state.RowNumber)
-	valueRange := &sheets.ValueRange{
-		Values: [][]any{SessionToSheet(p.Session)},
+	values := make([]any, len(missing))
+	for i, name := range missing {
+		values[i] = name
 	}
+	next := len(tab.header)
+	headerRange := fmt.Sprintf("%s!%s1:%s1", quoteSheetName(name), columnName(next), columnName(next+len(missing)-1))
+	if _, err := p.Client.UpdateValues(ctx, p.Cfg.SpreadsheetID, headerRange, [][]any{values}); err != nil {
+		return nil, fmt.Errorf("failed to write headers: %w", err)
+	}
+	return missing, nil
+}
+
+// InitRow creates the initial row for an in-progress session and tags it
+// with the session ID. The typed columns are formatted the first time a
+// sheet is written to.
+func InitRow(ctx context.Context, p GoogleSheetsParams) (*SyncState, error) {
+	if p.Session.ID == "" {
+		return nil, errors.New("session has no ID to find its row by")
+	}
+	name, err := p.SheetName()
+	if err != nil {
+		return nil, err
+	}
+	tab, layout, rowNum, err := appendRows(ctx, p, name, []*session.Session{p.Session})
+	if err != nil {
+		return nil, err
+	}
+	return &SyncState{RowNumber: rowNum, SheetName: name, Layout: layout, Location: tab.location}, nil
+}
 
-	_, err := p.Srv.Spreadsheets.Values.Update(p.Cfg.SpreadsheetID, updateRange, valueRange).
-		ValueInputOption("USER_ENTERED").Do()
+// appendRows appends the rows of sessions to the sheet called name with one
+// request and tags each with its session with another. When tagging fails
+// the rows are deleted again, so no untagged row is left behind. It returns
+// the first row written, 1-based.
+func appendRows(ctx context.Context, p GoogleSheetsParams, name string, sessions []*session.Session) (*tab, *Layout, int, error) {
+	tab, err := readHeader(ctx, p, name)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	layout := NewLayout(tab.header)
+	if missing := layout.Missing(); len(missing) > 0 {
+		return nil, nil, 0, &MissingColumnsError{Sheet: name, Columns: missing}
+	}
+	if !formatted(tab.sheet, layout) {
+		if err := formatTab(ctx, p, tab.sheet, layout); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	rows := make([][]any, len(sessions))
+	for i, s := range sessions {
+		rows[i] = layout.Row(s, tab.location)
+	}
+	appendRange := fmt.Sprintf("%s!A:%s", quoteSheetName(name), layout.lastColumn())
+	appendResp, err := p.Client.AppendValues(ctx, p.Cfg.SpreadsheetID, appendRange, rows)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to append row: %w", err)
+	}
+
+	if appendResp.Updates == nil {
+		return nil, nil, 0, errors.New("failed to find the appended row: no range in the response")
+	}
+	rowNum, err := rangeRow(appendResp.Updates.UpdatedRange)
 	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to find the appended row: %w", err)
+	}
+	anchors := make([]*sheets.Request, len(sessions))
+	for i, s := range sessions {
+		anchors[i] = anchorRequest(tab.sheet.Properties.SheetId, rowNum+i, s.ID)
+	}
+	if _, err := p.Client.BatchUpdate(ctx, p.Cfg.SpreadsheetID, anchors); err != nil {
+		rows, with := fmt.Sprintf("row %d", rowNum), "the session"
+		if len(sessions) > 1 {
+			rows, with = fmt.Sprintf("rows %d to %d", rowNum, rowNum+len(sessions)-1), "their sessions"
+		}
+		if delErr := deleteRows(ctx, p, tab.sheet.Properties.SheetId, rowNum, len(sessions)); delErr != nil {
+			return nil, nil, 0, fmt.Errorf("failed to tag %s with %s: %w (the untagged %s could not be deleted: %v)", rows, with, err, rows, delErr)
+		}
+		return nil, nil, 0, fmt.Errorf("failed to tag %s with %s: %w", rows, with, err)
+	}
+	return tab, layout, rowNum, nil
+}
+
+// deleteRows deletes n rows from row on, 1-based
+func deleteRows(ctx context.Context, p GoogleSheetsParams, sheetID int64, row, n int) error {
+	_, err := p.Client.BatchUpdate(ctx, p.Cfg.SpreadsheetID, []*sheets.Request{{
+		DeleteDimension: &sheets.DeleteDimensionRequest{
+			Range: &sheets.DimensionRange{
+				SheetId:    sheetID,
+				Dimension:  "ROWS",
+				StartIndex: int64(row - 1),
+				EndIndex:   int64(row - 1 + n),
+			},
+		},
+	}})
+	return err
+}
+
+// SyncGoogleSheetsRow updates the row tagged with the session, wherever it
+// moved, with the current session duration. A deleted row is reported with
+// a MissingAnchorError.
+func SyncGoogleSheetsRow(ctx context.Context, p GoogleSheetsParams, state *SyncState) error {
+	layout := state.Layout
+	if layout == nil {
+		layout = DefaultLayout()
+	}
+	loc := state.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	w := p.Writer
+	if w == nil {
+		w = NewWriter(p.Client, p.Cfg.SpreadsheetID)
+	}
+	w.Update(p.Session.ID, layout.Row(p.Session, loc))
+	if err := w.Flush(ctx); err != nil {
 		return fmt.Errorf("failed to update row: %w", err)
 	}
 
 	return nil
 }
+
+// CheckAccess opens a spreadsheet and writes its title back unchanged, which
+// fails without edit access. It returns the title of the spreadsheet and
+// whether it has a sheet called sheetName.
+func CheckAccess(ctx context.Context, client Client, spreadsheetID, sheetName string) (title string, sheetFound bool, err error) {
+	spreadsheet, err := client.GetSpreadsheet(ctx, spreadsheetID)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open spreadsheet: %w", err)
+	}
+	title = spreadsheet.Properties.Title
+
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties != nil && sheet.Properties.Title == sheetName {
+			sheetFound = true
+		}
+	}
+
+	update := []*sheets.Request{{
+		UpdateSpreadsheetProperties: &sheets.UpdateSpreadsheetPropertiesRequest{
+			Properties: &sheets.SpreadsheetProperties{Title: title},
+			Fields:     "title",
+		},
+	}}
+	if _, err := client.BatchUpdate(ctx, spreadsheetID, update); err != nil {
+		return title, sheetFound, fmt.Errorf("no write access to spreadsheet: %w", err)
+	}
+	return title, sheetFound, nil
+}
@@ -1,9 +1,19 @@
 package sheets
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/config"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets/sheetstest"
+	"google.golang.org/api/googleapi"
 )
 
 func TestCredentialsLoading(t *testing.T) {
@@ -37,8 +47,8 @@ EOF`
 			t.Fatalf("failed to create test helper: %v", err)
 		}
 
-		// Test that ExecuteCredentialsHelper works
-		credentials, err := ExecuteCredentialsHelper(helperPath)
+		// Test that the credentials helper works
+		credentials, err := helperOutput(helperConfig(helperPath))
 		if err != nil {
 			t.Fatalf("failed to execute credentials helper: %v", err)
 		}
@@ -55,3 +65,414 @@ EOF`
 	})
 
 }
+
+// fakeSheets starts a fake Sheets server with one spreadsheet holding sheetTitles
+func fakeSheets(t *testing.T, sheetTitles ...string) (*sheetstest.Server, GoogleSheetsParams) {
+	t.Helper()
+	server := sheetstest.NewServer(t)
+	server.AddSpreadsheet("sheet-id", "Craft log", sheetTitles...)
+
+	srv, err := server.Service(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	cfg := config.GoogleSheetsConfig{Enabled: true, SpreadsheetID: "sheet-id", SheetName: sheetTitles[0]}
+	s := &session.Session{
+		ID:          "session-1",
+		StartTime:   time.Date(2025, 3, 14, 9, 30, 0, 0, time.Local),
+		ProjectName: "quilt",
+		Task:        "cutting",
+	}
+	return server, GoogleSheetsParams{Client: NewClient(srv), Cfg: cfg, Session: s}
+}
+
+func TestGoogleSheets(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("headers are written to an empty sheet", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if state.RowNumber != 2 {
+			t.Errorf("expected row 2, got %d", state.RowNumber)
+		}
+
+		rows := server.Values("sheet-id", "CraftTime")
+		if len(rows) != 2 {
+			t.Fatalf("expected headers and a row, got %v", rows)
+		}
+		if rows[0][0] != "Project" || len(rows[0]) != len(HEADERS) {
+			t.Errorf("expected headers, got %v", rows[0])
+		}
+		if rows[1][0] != "quilt" || rows[1][1] != "cutting" || rows[1][2] != "45730" || rows[1][4] != "" {
+			t.Errorf("unexpected row %v", rows[1])
+		}
+	})
+
+	t.Run("existing headers are kept", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		server.SetValues("sheet-id", "CraftTime", [][]string{
+			{"Project", "Task", "Date", "Start Time", "End Time", "Duration", "Notes", "Tags", "Rate", "Profile", "Mine"},
+			{"hat", "knitting"},
+		})
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if state.RowNumber != 3 {
+			t.Errorf("expected row 3, got %d", state.RowNumber)
+		}
+		rows := server.Values("sheet-id", "CraftTime")
+		if rows[0][10] != "Mine" || rows[1][0] != "hat" {
+			t.Errorf("expected the sheet to be kept, got %v", rows)
+		}
+	})
+
+	t.Run("rows are appended after each other", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+
+		for want := 2; want <= 3; want++ {
+			state, err := InitRow(ctx, p)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if state.RowNumber != want {
+				t.Errorf("expected row %d, got %d", want, state.RowNumber)
+			}
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 3 {
+			t.Errorf("expected 3 rows, got %d", len(rows))
+		}
+	})
+
+	t.Run("a row is updated in place", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		other := *p.Session
+		other.ID = "session-2"
+		otherParams := p
+		otherParams.Session = &other
+		if _, err := InitRow(ctx, otherParams); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		p.Session.AddNote("pinned the blocks")
+		p.Session.Stop()
+		if err := SyncGoogleSheetsRow(ctx, p, state); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		rows := server.Values("sheet-id", "CraftTime")
+		if len(rows) != 3 {
+			t.Fatalf("expected 3 rows, got %v", rows)
+		}
+		if rows[1][4] == "" || !strings.HasSuffix(rows[1][6], "pinned the blocks") {
+			t.Errorf("expected row 2 to be updated, got %v", rows[1])
+		}
+		if rows[2][4] != "" {
+			t.Errorf("expected row 3 to be untouched, got %v", rows[2])
+		}
+	})
+
+	t.Run("sheet names are quoted", func(t *testing.T) {
+		for _, name := range []string{"Craft Time", "Vlad's log", "2025"} {
+			server, p := fakeSheets(t, name)
+
+			state, err := InitRow(ctx, p)
+			if err != nil {
+				t.Fatalf("%s: expected no error, got: %v", name, err)
+			}
+			if err := SyncGoogleSheetsRow(ctx, p, state); err != nil {
+				t.Fatalf("%s: expected no error, got: %v", name, err)
+			}
+			if rows := server.Values("sheet-id", name); len(rows) != 2 {
+				t.Errorf("%s: expected 2 rows, got %v", name, rows)
+			}
+		}
+	})
+
+	t.Run("missing sheet is created", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		p.Cfg.SheetName = "Vlad's log"
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if state.RowNumber != 2 {
+			t.Errorf("expected row 2, got %d", state.RowNumber)
+		}
+		rows := server.Values("sheet-id", "Vlad's log")
+		if len(rows) != 2 || rows[0][0] != "Project" {
+			t.Errorf("expected headers and a row, got %v", rows)
+		}
+
+		// the next session finds the sheet
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("missing spreadsheet", func(t *testing.T) {
+		_, p := fakeSheets(t, "CraftTime")
+		p.Cfg.SpreadsheetID = "other"
+
+		_, err := InitRow(ctx, p)
+		var apiErr *googleapi.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+			t.Errorf("expected a 404, got: %v", err)
+		}
+	})
+
+	t.Run("server errors are reported", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		server.FailNext(http.StatusForbidden, "The caller does not have permission")
+
+		_, err := InitRow(ctx, p)
+		if err == nil || !strings.Contains(err.Error(), "failed to open spreadsheet") || !strings.Contains(err.Error(), "permission") {
+			t.Errorf("expected a permission error, got: %v", err)
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 0 {
+			t.Errorf("expected nothing written, got %v", rows)
+		}
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		server.FailNext(http.StatusInternalServerError, "Internal error encountered.")
+		if err := SyncGoogleSheetsRow(ctx, p, state); err == nil || !strings.Contains(err.Error(), "failed to update row") {
+			t.Errorf("expected an update error, got: %v", err)
+		}
+	})
+
+	t.Run("a failed sync is written with the next one", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		first, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		closed := p.Session
+		p.Session = closed.NextSegment("binding")
+		second, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		p.Writer = NewWriter(p.Client, p.Cfg.SpreadsheetID)
+		server.FailNext(http.StatusInternalServerError, "Internal error encountered.")
+		if err := SyncGoogleSheetsRow(ctx, GoogleSheetsParams{Client: p.Client, Cfg: p.Cfg, Session: closed, Writer: p.Writer}, first); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+
+		requests := server.Requests()
+		if err := SyncGoogleSheetsRow(ctx, p, second); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if n := server.Requests() - requests; n != 1 {
+			t.Errorf("expected both rows in 1 request, got %d", n)
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 3 || rows[1][4] == "" {
+			t.Errorf("expected the closed segment to get its end time, got %v", rows)
+		}
+	})
+
+	t.Run("rows that cannot be tagged are deleted", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		p.Session = &session.Session{ID: "session-2", StartTime: p.Session.StartTime.Add(time.Hour), ProjectName: "hat"}
+		server.FailNextCall("spreadsheets.batchUpdate", http.StatusInternalServerError, "Internal error encountered.")
+		_, err := InitRow(ctx, p)
+		if err == nil || !strings.Contains(err.Error(), "failed to tag row 3") || strings.Contains(err.Error(), "could not be deleted") {
+			t.Errorf("expected a tag error, got: %v", err)
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 2 {
+			t.Errorf("expected the untagged row to be deleted, got %v", rows)
+		}
+		if row := server.Metadata("sheet-id", "CraftTime", anchorKey, "session-1"); row != 2 {
+			t.Errorf("expected session-1 to stay on row 2, got %d", row)
+		}
+
+		// both the tag and the delete fail
+		server.FailNextCall("spreadsheets.batchUpdate", http.StatusInternalServerError, "Internal error encountered.")
+		server.FailNextCall("spreadsheets.batchUpdate", http.StatusInternalServerError, "Internal error encountered.")
+		if _, err := InitRow(ctx, p); err == nil || !strings.Contains(err.Error(), "untagged row 3 could not be deleted") {
+			t.Errorf("expected the untagged row to be reported, got: %v", err)
+		}
+	})
+}
+
+func TestMonthlySheets(t *testing.T) {
+	ctx := context.Background()
+	server, p := fakeSheets(t, "Summary")
+	p.Cfg.SheetName = "CraftTime {{.Year}}-{{.Month}}"
+
+	// started before midnight at the end of March
+	p.Session.StartTime = time.Date(2025, 3, 31, 23, 50, 0, 0, time.Local)
+	march, err := InitRow(ctx, p)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if march.SheetName != "CraftTime 2025-03" {
+		t.Errorf("expected the March tab, got %q", march.SheetName)
+	}
+
+	april := *p.Session
+	april.ID = "session-2"
+	april.StartTime = time.Date(2025, 4, 1, 9, 0, 0, 0, time.Local)
+	april.ProjectName = "hat"
+	aprilParams := p
+	aprilParams.Session = &april
+	if _, err := InitRow(ctx, aprilParams); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// the March session ends in April and stays in its tab
+	p.Session.Stop()
+	if err := SyncGoogleSheetsRow(ctx, p, march); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	rows := server.Values("sheet-id", "CraftTime 2025-03")
+	if len(rows) != 2 || rows[0][0] != "Project" || rows[1][0] != "quilt" || rows[1][2] != "45747" || rows[1][4] == "" {
+		t.Errorf("expected the finished March session in its tab, got %v", rows)
+	}
+	rows = server.Values("sheet-id", "CraftTime 2025-04")
+	if len(rows) != 2 || rows[0][0] != "Project" || rows[1][0] != "hat" {
+		t.Errorf("expected the April session in a new tab, got %v", rows)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("columns are mapped by header", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		server.SetValues("sheet-id", "CraftTime", [][]string{
+			{"Date", "Mine", " project ", "TASK", "Start Time", "End Time", "Duration", "Notes", "Tags", "Rate", "Profile"},
+			{"2025-03-13", "keep me", "hat", "knitting"},
+		})
+
+		state, err := InitRow(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		p.Session.Stop()
+		if err := SyncGoogleSheetsRow(ctx, p, state); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		rows := server.Values("sheet-id", "CraftTime")
+		if rows[1][1] != "keep me" {
+			t.Errorf("expected other columns to be kept, got %v", rows[1])
+		}
+		row := rows[state.RowNumber-1]
+		if row[0] != "45730" || row[1] != "" || row[2] != "quilt" || row[3] != "cutting" || row[5] == "" {
+			t.Errorf("expected values under their headers, got %v", row)
+		}
+		if got := server.NumberFormat("sheet-id", "CraftTime", "A"); got != "yyyy-mm-dd" {
+			t.Errorf("expected the Date column to be formatted as a date, got %q", got)
+		}
+	})
+
+	t.Run("missing columns are not written", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		old := [][]string{{"Project", "Task", "Date", "Start Time", "End Time", "Duration", "Notes"}}
+		server.SetValues("sheet-id", "CraftTime", old)
+
+		_, err := InitRow(ctx, p)
+		var missingErr *MissingColumnsError
+		if !errors.As(err, &missingErr) {
+			t.Fatalf("expected missing columns, got: %v", err)
+		}
+		if got := strings.Join(missingErr.Columns, ","); got != "Tags,Rate,Profile" {
+			t.Errorf("expected Tags,Rate,Profile missing, got %s", got)
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 1 {
+			t.Errorf("expected nothing written, got %v", rows)
+		}
+	})
+
+	t.Run("migration adds missing columns", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		server.SetValues("sheet-id", "CraftTime", [][]string{
+			{"Project", "Mine", "Task", "Date", "Start Time", "End Time", "Duration", "Notes"},
+			{"hat", "keep me", "knitting"},
+		})
+
+		added, err := MigrateHeaders(ctx, p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := strings.Join(added, ","); got != "Tags,Rate,Profile" {
+			t.Errorf("expected Tags,Rate,Profile added, got %s", got)
+		}
+		header := strings.Join(server.Values("sheet-id", "CraftTime")[0], ",")
+		if want := "Project,Mine,Task,Date,Start Time,End Time,Duration,Notes,Tags,Rate,Profile"; header != want {
+			t.Errorf("expected header %s, got %s", want, header)
+		}
+
+		added, err = MigrateHeaders(ctx, p)
+		if err != nil || len(added) != 0 {
+			t.Errorf("expected nothing left to add, got %v %v", added, err)
+		}
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	})
+}
+
+func TestCheckAccess(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sheet exists", func(t *testing.T) {
+		_, p := fakeSheets(t, "Summary", "CraftTime")
+		p.Cfg.SheetName = "CraftTime"
+
+		title, found, err := CheckAccess(ctx, p.Client, p.Cfg.SpreadsheetID, p.Cfg.SheetName)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if title != "Craft log" || !found {
+			t.Errorf("expected Craft log with the sheet, got %q %v", title, found)
+		}
+	})
+
+	t.Run("sheet missing", func(t *testing.T) {
+		_, p := fakeSheets(t, "CraftTime")
+		p.Cfg.SheetName = "Other"
+
+		_, found, err := CheckAccess(ctx, p.Client, p.Cfg.SpreadsheetID, p.Cfg.SheetName)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if found {
+			t.Error("expected the sheet to be missing")
+		}
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		server.SetReadOnly("sheet-id")
+
+		title, _, err := CheckAccess(ctx, p.Client, p.Cfg.SpreadsheetID, p.Cfg.SheetName)
+		if title != "Craft log" {
+			t.Errorf("expected the spreadsheet to open, got %q", title)
+		}
+		if err == nil || !strings.Contains(err.Error(), "no write access") {
+			t.Errorf("expected no write access, got: %v", err)
+		}
+	})
+}
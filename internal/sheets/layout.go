@@ -0,0 +1,99 @@
+package sheets
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vlad/craftie/internal/session"
+)
+
+// Layout tells in which column of a sheet each of HEADERS is, so rows land
+// under the right header however the columns are ordered
+type Layout struct {
+	// Columns holds the column index of each of HEADERS, -1 when the sheet
+	// has no such column
+	Columns []int
+}
+
+// DefaultLayout is the layout of a sheet craftie wrote the headers of
+func DefaultLayout() *Layout {
+	l := &Layout{Columns: make([]int, len(HEADERS))}
+	for i := range HEADERS {
+		l.Columns[i] = i
+	}
+	return l
+}
+
+// NewLayout finds HEADERS in a header row. Names are matched ignoring case
+// and surrounding spaces, the first of duplicate headers is used.
+func NewLayout(header []any) *Layout {
+	l := &Layout{Columns: make([]int, len(HEADERS))}
+	for i, name := range HEADERS {
+		l.Columns[i] = slices.IndexFunc(header, func(cell any) bool {
+			return strings.EqualFold(strings.TrimSpace(fmt.Sprint(cell)), name.(string))
+		})
+	}
+	return l
+}
+
+// Missing returns the headers the sheet has no column for
+func (l *Layout) Missing() []string {
+	var missing []string
+	for i, col := range l.Columns {
+		if col < 0 {
+			missing = append(missing, HEADERS[i].(string))
+		}
+	}
+	return missing
+}
+
+// width is the number of columns up to the last one craftie writes
+func (l *Layout) width() int {
+	return slices.Max(l.Columns) + 1
+}
+
+// lastColumn is the letter of the last column craftie writes
+func (l *Layout) lastColumn() string {
+	return columnName(l.width() - 1)
+}
+
+// Row places the session's values under their headers, dates and times as
+// serial values in the spreadsheet's timezone loc. Other columns are nil,
+// which leaves their cells as they are.
+func (l *Layout) Row(s *session.Session, loc *time.Location) []any {
+	record := sheetRecord(s, loc)
+	row := make([]any, l.width())
+	for i, value := range record {
+		if col := l.Columns[i]; col >= 0 {
+			row[col] = value
+		}
+	}
+	return row
+}
+
+func (l *Layout) column(header string) int {
+	return l.Columns[slices.Index(HEADERS, any(header))]
+}
+
+// columnName turns a column index counted from 0 into its letters, 27 is AB
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// MissingColumnsError is returned instead of writing to a sheet whose header
+// row lacks some of HEADERS
+type MissingColumnsError struct {
+	Sheet   string
+	Columns []string
+}
+
+func (e *MissingColumnsError) Error() string {
+	return fmt.Sprintf("sheet %q has no %s column, run craftie sheets migrate to add the missing columns",
+		e.Sheet, strings.Join(e.Columns, ", "))
+}
@@ -0,0 +1,129 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// SheetRow is a row of a session tab
+type SheetRow struct {
+	Sheet string
+	// Row is 1-based
+	Row int
+	// SessionID is the session the row is tagged with, empty for rows
+	// added by hand
+	SessionID string
+	// Values are the cells as text by header, see RowText. Headers the tab
+	// has no column for are left out.
+	Values map[string]string
+	// Layout is where the columns of the tab are
+	Layout *Layout
+
+	sheetID int64
+}
+
+// ReadRows reads every row of the session tabs, those sheet_name can
+// produce, with the session each row is tagged with. Rows without a project
+// are left out. The timezone of the spreadsheet is returned too.
+func ReadRows(ctx context.Context, p GoogleSheetsParams) ([]SheetRow, *time.Location, error) {
+	pattern, err := p.Cfg.SheetPattern()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve google_sheets.sheet_name: %w", err)
+	}
+	spreadsheet, err := p.Client.GetSpreadsheet(ctx, p.Cfg.SpreadsheetID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open spreadsheet: %w", err)
+	}
+	loc := spreadsheetLocation(spreadsheet)
+
+	anchors, err := readAnchors(ctx, p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []SheetRow
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties == nil || !pattern.MatchString(sheet.Properties.Title) {
+			continue
+		}
+		name := sheet.Properties.Title
+		resp, err := p.Client.GetValues(ctx, p.Cfg.SpreadsheetID, quoteSheetName(name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read sheet %q: %w", name, err)
+		}
+		if len(resp.Values) == 0 {
+			continue
+		}
+
+		layout := NewLayout(resp.Values[0])
+		for i, cells := range resp.Values[1:] {
+			row := SheetRow{
+				Sheet:     name,
+				Row:       i + 2,
+				SessionID: anchors[anchor{sheet.Properties.SheetId, i + 1}],
+				Values:    map[string]string{},
+				Layout:    layout,
+				sheetID:   sheet.Properties.SheetId,
+			}
+			for h, col := range layout.Columns {
+				if col < 0 {
+					continue
+				}
+				var v any
+				if col < len(cells) {
+					v = cells[col]
+				}
+				header := HEADERS[h].(string)
+				row.Values[header] = cellText(header, v)
+			}
+			if row.Values["Project"] != "" {
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows, loc, nil
+}
+
+// anchor is a 0-based row of a sheet
+type anchor struct {
+	sheetID int64
+	row     int
+}
+
+// readAnchors finds the session of every tagged row
+func readAnchors(ctx context.Context, p GoogleSheetsParams) (map[anchor]string, error) {
+	filter := &sheets.DataFilter{DeveloperMetadataLookup: &sheets.DeveloperMetadataLookup{MetadataKey: anchorKey}}
+	resp, err := p.Client.SearchDeveloperMetadata(ctx, p.Cfg.SpreadsheetID, []*sheets.DataFilter{filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read row tags: %w", err)
+	}
+
+	anchors := map[anchor]string{}
+	for _, matched := range resp.MatchedDeveloperMetadata {
+		m := matched.DeveloperMetadata
+		if m == nil || m.Location == nil || m.Location.DimensionRange == nil || m.Location.DimensionRange.Dimension != "ROWS" {
+			continue
+		}
+		r := m.Location.DimensionRange
+		anchors[anchor{r.SheetId, int(r.StartIndex)}] = m.MetadataValue
+	}
+	return anchors, nil
+}
+
+// TagRows tags rows read by ReadRows with the session set in their SessionID
+func TagRows(ctx context.Context, p GoogleSheetsParams, rows []SheetRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	requests := make([]*sheets.Request, len(rows))
+	for i, row := range rows {
+		requests[i] = anchorRequest(row.sheetID, row.Row, row.SessionID)
+	}
+	if _, err := p.Client.BatchUpdate(ctx, p.Cfg.SpreadsheetID, requests); err != nil {
+		return fmt.Errorf("failed to tag %d rows with their sessions: %w", len(rows), err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package sheets
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCellText(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		value  any
+		want   string
+	}{
+		{"Date", 45730.0, "2025-03-14"},
+		{"Date", "45730", "2025-03-14"},
+		{"Date", "14/03/2025", "14/03/2025"},
+		{"Start Time", 45730 + 9.5/24, "09:30:00"},
+		// a time typed into the cell has no date
+		{"End Time", 17.25 / 24, "17:15:00"},
+		{"End Time", "", ""},
+		{"Duration", 26.5 / 24, "26:30:00"},
+		{"Rate", 40.0, "40"},
+		{"Notes", "007", "007"},
+		{"Project", 2025.0, "2025"},
+		{"Task", nil, ""},
+	} {
+		if got := cellText(tc.header, tc.value); got != tc.want {
+			t.Errorf("%s %v: expected %q, got %q", tc.header, tc.value, tc.want, got)
+		}
+	}
+}
+
+func TestHours(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"1:30:00":  90 * time.Minute,
+		"26:00:05": 26*time.Hour + 5*time.Second,
+		"0:45":     45 * time.Minute,
+	} {
+		got, err := ParseHours(s)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %v, got %v (%v)", s, want, got, err)
+		}
+		if s != "0:45" && FormatHours(want) != s {
+			t.Errorf("%v: expected %s, got %s", want, s, FormatHours(want))
+		}
+	}
+	for _, s := range []string{"", "90", "1:5:00", "1:60:00", "a:00:00", "1:00:00:00"} {
+		if _, err := ParseHours(s); err == nil {
+			t.Errorf("%q: expected an error, got nil", s)
+		}
+	}
+}
+
+func TestReadRows(t *testing.T) {
+	ctx := context.Background()
+	server, p := fakeSheets(t, "CraftTime 2025-03", "Summary")
+	p.Cfg.SheetName = "CraftTime {{.Year}}-{{.Month}}"
+	p.Session.StartTime = time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+
+	if _, err := InitRow(ctx, p); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	rows := server.Values("sheet-id", "CraftTime 2025-03")
+	server.SetValues("sheet-id", "CraftTime 2025-03", append(rows,
+		[]string{"hat", "knitting", "2025-03-15", "10:00", "12:00"},
+		nil,
+	))
+	server.SetValues("sheet-id", "Summary", [][]string{{"Project"}, {"not a session"}})
+
+	got, loc, err := ReadRows(ctx, p)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if loc.String() != "Etc/UTC" {
+		t.Errorf("expected the spreadsheet timezone, got %v", loc)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 rows, got %+v", got)
+	}
+
+	if got[0].SessionID != "session-1" || got[0].Row != 2 || got[0].Values["Date"] != "2025-03-14" || got[0].Values["Start Time"] != "09:30:00" {
+		t.Errorf("expected the tagged session row, got %+v", got[0])
+	}
+	if got[1].SessionID != "" || got[1].Row != 3 || got[1].Values["Project"] != "hat" || got[1].Values["End Time"] != "12:00" {
+		t.Errorf("expected the row added by hand, got %+v", got[1])
+	}
+
+	got[1].SessionID = "session-2"
+	if err := TagRows(ctx, p, got[1:]); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if row := server.Metadata("sheet-id", "CraftTime 2025-03", anchorKey, "session-2"); row != 3 {
+		t.Errorf("expected row 3 to be tagged, got %d", row)
+	}
+}
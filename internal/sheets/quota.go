@@ -0,0 +1,217 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	// firstBackoff is the wait before the first retry, it doubles up to maxBackoff
+	firstBackoff = time.Second
+	maxBackoff   = 32 * time.Second
+)
+
+// bucket is a token bucket refilled at perMinute tokens a minute. It holds
+// a sixth of that, so a burst is spread over the minute instead of using
+// the whole quota at once.
+type bucket struct {
+	mu        sync.Mutex
+	perMinute int
+	tokens    float64
+	last      time.Time
+	// recent are the times of the calls of the last minute, for the logs
+	recent []time.Time
+
+	now   func() time.Time
+	sleep func(context.Context, time.Duration) error
+}
+
+func newBucket(perMinute int) *bucket {
+	b := &bucket{perMinute: perMinute, now: time.Now, sleep: sleepContext}
+	b.tokens = b.size()
+	return b
+}
+
+func (b *bucket) size() float64 {
+	return max(1, float64(b.perMinute)/6)
+}
+
+// take waits for a token and returns how long it waited
+func (b *bucket) take(ctx context.Context) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var waited time.Duration
+	if b.perMinute > 0 {
+		now := b.now()
+		if !b.last.IsZero() {
+			b.tokens = min(b.size(), b.tokens+now.Sub(b.last).Minutes()*float64(b.perMinute))
+		}
+		b.last = now
+
+		if b.tokens < 1 {
+			waited = time.Duration((1 - b.tokens) / float64(b.perMinute) * float64(time.Minute))
+			if err := b.sleep(ctx, waited); err != nil {
+				return 0, err
+			}
+			b.tokens = 1
+			b.last = b.now()
+		}
+		b.tokens--
+	}
+
+	now := b.now()
+	for len(b.recent) > 0 && now.Sub(b.recent[0]) >= time.Minute {
+		b.recent = b.recent[1:]
+	}
+	b.recent = append(b.recent, now)
+	return waited, nil
+}
+
+// used is the number of calls made in the last minute
+func (b *bucket) used() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.recent)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryDelay tells whether a failed call may be retried and how long to
+// wait first: the Retry-After of the response, or an exponential backoff
+// with jitter. A 429 refuses the call before it is run, a 503 may come after
+// it was applied, so only idempotent calls are retried on 503.
+func retryDelay(err error, attempt int, idempotent bool) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	if apiErr.Code != http.StatusTooManyRequests && (apiErr.Code != http.StatusServiceUnavailable || !idempotent) {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(apiErr.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	backoff := min(maxBackoff, firstBackoff<<attempt)
+	// half of the wait is random, so clients refused together do not retry together
+	return backoff/2 + rand.N(backoff/2+1), true
+}
+
+// quotaClient limits and retries the calls of another Client
+type quotaClient struct {
+	client  Client
+	bucket  *bucket
+	retries int
+}
+
+// WithQuota limits client to perMinute calls a minute, 0 means no limit, and
+// retries calls refused with 429 up to retries times. Calls that can be
+// repeated safely, reads and writes of fixed ranges, are retried on 503 too.
+func WithQuota(client Client, perMinute, retries int) Client {
+	return &quotaClient{client: client, bucket: newBucket(perMinute), retries: retries}
+}
+
+func (c *quotaClient) do(ctx context.Context, call string, idempotent bool, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		waited, err := c.bucket.take(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = fn()
+		slog.Debug("Sheets API call", "call", call, "attempt", attempt+1, "waited", waited,
+			"used", c.bucket.used(), "limit", c.bucket.perMinute, "error", err)
+
+		delay, retry := retryDelay(err, attempt, idempotent)
+		if !retry || attempt >= c.retries {
+			return err
+		}
+		slog.Debug("Sheets API refused the call, backing off", "call", call, "retry_in", delay, "error", err)
+		if err := c.bucket.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *quotaClient) GetValues(ctx context.Context, spreadsheetID, readRange string) (resp *sheets.ValueRange, err error) {
+	err = c.do(ctx, "values.get", true, func() (err error) {
+		resp, err = c.client.GetValues(ctx, spreadsheetID, readRange)
+		return err
+	})
+	return resp, err
+}
+
+func (c *quotaClient) UpdateValues(ctx context.Context, spreadsheetID, writeRange string, values [][]any) (resp *sheets.UpdateValuesResponse, err error) {
+	err = c.do(ctx, "values.update", true, func() (err error) {
+		resp, err = c.client.UpdateValues(ctx, spreadsheetID, writeRange, values)
+		return err
+	})
+	return resp, err
+}
+
+func (c *quotaClient) AppendValues(ctx context.Context, spreadsheetID, tableRange string, values [][]any) (resp *sheets.AppendValuesResponse, err error) {
+	err = c.do(ctx, "values.append", false, func() (err error) {
+		resp, err = c.client.AppendValues(ctx, spreadsheetID, tableRange, values)
+		return err
+	})
+	return resp, err
+}
+
+func (c *quotaClient) BatchUpdateValues(ctx context.Context, spreadsheetID string, data []*sheets.ValueRange) (resp *sheets.BatchUpdateValuesResponse, err error) {
+	err = c.do(ctx, "values.batchUpdate", true, func() (err error) {
+		resp, err = c.client.BatchUpdateValues(ctx, spreadsheetID, data)
+		return err
+	})
+	return resp, err
+}
+
+func (c *quotaClient) BatchUpdateValuesByDataFilter(ctx context.Context, spreadsheetID string, data []*sheets.DataFilterValueRange) (resp *sheets.BatchUpdateValuesByDataFilterResponse, err error) {
+	err = c.do(ctx, "values.batchUpdateByDataFilter", true, func() (err error) {
+		resp, err = c.client.BatchUpdateValuesByDataFilter(ctx, spreadsheetID, data)
+		return err
+	})
+	return resp, err
+}
+
+func (c *quotaClient) GetSpreadsheet(ctx context.Context, spreadsheetID string) (resp *sheets.Spreadsheet, err error) {
+	err = c.do(ctx, "get", true, func() (err error) {
+		resp, err = c.client.GetSpreadsheet(ctx, spreadsheetID)
+		return err
+	})
+	return resp, err
+}
+
+func (c *quotaClient) SearchDeveloperMetadata(ctx context.Context, spreadsheetID string, filters []*sheets.DataFilter) (resp *sheets.SearchDeveloperMetadataResponse, err error) {
+	err = c.do(ctx, "developerMetadata.search", true, func() (err error) {
+		resp, err = c.client.SearchDeveloperMetadata(ctx, spreadsheetID, filters)
+		return err
+	})
+	return resp, err
+}
+
+func (c *quotaClient) BatchUpdate(ctx context.Context, spreadsheetID string, requests []*sheets.Request) (resp *sheets.BatchUpdateSpreadsheetResponse, err error) {
+	err = c.do(ctx, "batchUpdate", false, func() (err error) {
+		resp, err = c.client.BatchUpdate(ctx, spreadsheetID, requests)
+		return err
+	})
+	return resp, err
+}
@@ -0,0 +1,142 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// fakeClock stands in for time.Now and the sleeps of a bucket
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) install(b *bucket) {
+	b.now = func() time.Time { return c.now }
+	b.sleep = func(_ context.Context, d time.Duration) error {
+		c.sleeps = append(c.sleeps, d)
+		c.now = c.now.Add(d)
+		return nil
+	}
+}
+
+func TestQuotaClient(t *testing.T) {
+	ctx := context.Background()
+
+	quota := func(p GoogleSheetsParams, perMinute, retries int) (*quotaClient, *fakeClock) {
+		c := WithQuota(p.Client, perMinute, retries).(*quotaClient)
+		clock := &fakeClock{now: time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)}
+		clock.install(c.bucket)
+		return c, clock
+	}
+
+	t.Run("retries quota and unavailable errors", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		c, clock := quota(p, 0, 5)
+
+		server.FailNext(http.StatusTooManyRequests, "Quota exceeded")
+		server.FailNext(http.StatusServiceUnavailable, "The service is currently unavailable.")
+		if _, err := c.GetSpreadsheet(ctx, "sheet-id"); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(clock.sleeps) != 2 {
+			t.Fatalf("expected 2 backoffs, got %v", clock.sleeps)
+		}
+		// 1s then 2s, of which up to half is jitter
+		if d := clock.sleeps[0]; d < 500*time.Millisecond || d > time.Second {
+			t.Errorf("expected first backoff between 0.5s and 1s, got %v", d)
+		}
+		if d := clock.sleeps[1]; d < time.Second || d > 2*time.Second {
+			t.Errorf("expected second backoff between 1s and 2s, got %v", d)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		c, clock := quota(p, 0, 2)
+
+		for range 3 {
+			server.FailNext(http.StatusTooManyRequests, "Quota exceeded")
+		}
+		_, err := c.GetSpreadsheet(ctx, "sheet-id")
+		var apiErr *googleapi.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected a 429 error, got: %v", err)
+		}
+		if len(clock.sleeps) != 2 {
+			t.Errorf("expected 2 backoffs, got %v", clock.sleeps)
+		}
+	})
+
+	t.Run("appends are not retried when unavailable", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		c, clock := quota(p, 0, 5)
+
+		// the append may have been applied, retrying could write the row twice
+		server.FailNext(http.StatusServiceUnavailable, "The service is currently unavailable.")
+		if _, err := c.AppendValues(ctx, "sheet-id", "CraftTime!A:J", [][]any{{"quilt"}}); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		if len(clock.sleeps) != 0 {
+			t.Errorf("expected no backoff, got %v", clock.sleeps)
+		}
+
+		server.FailNext(http.StatusTooManyRequests, "Quota exceeded")
+		if _, err := c.AppendValues(ctx, "sheet-id", "CraftTime!A:J", [][]any{{"quilt"}}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(clock.sleeps) != 1 {
+			t.Errorf("expected 1 backoff, got %v", clock.sleeps)
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 1 {
+			t.Errorf("expected 1 row, got %v", rows)
+		}
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		c, clock := quota(p, 0, 5)
+
+		server.FailNext(http.StatusForbidden, "The caller does not have permission")
+		if _, err := c.GetSpreadsheet(ctx, "sheet-id"); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		if len(clock.sleeps) != 0 {
+			t.Errorf("expected no backoff, got %v", clock.sleeps)
+		}
+	})
+
+	t.Run("bucket spreads calls over the minute", func(t *testing.T) {
+		_, p := fakeSheets(t, "CraftTime")
+		c, clock := quota(p, 60, 0)
+
+		// a burst of 10, then one call a second
+		for range 12 {
+			if _, err := c.GetSpreadsheet(ctx, "sheet-id"); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+		if len(clock.sleeps) != 2 || clock.sleeps[0] != time.Second || clock.sleeps[1] != time.Second {
+			t.Errorf("expected 2 waits of 1s, got %v", clock.sleeps)
+		}
+		if got := c.bucket.used(); got != 12 {
+			t.Errorf("expected 12 calls in the last minute, got %d", got)
+		}
+
+		clock.now = clock.now.Add(time.Minute)
+		if _, err := c.GetSpreadsheet(ctx, "sheet-id"); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(clock.sleeps) != 2 {
+			t.Errorf("expected the bucket to refill, got waits %v", clock.sleeps)
+		}
+		if got := c.bucket.used(); got != 1 {
+			t.Errorf("expected 1 call in the last minute, got %d", got)
+		}
+	})
+}
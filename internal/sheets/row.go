@@ -1,13 +1,16 @@
 package sheets
 
 import (
-	"slices"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/vlad/craftie/internal/session"
 )
 
-var HEADERS = []any{"Project", "Task", "Date", "Start Time", "End Time", "Duration", "Notes"}
+var HEADERS = []any{"Project", "Task", "Date", "Start Time", "End Time", "Duration", "Notes", "Tags", "Rate", "Profile"}
 
 func sessionRecord(s *session.Session) []string {
 	endTime := s.EndTime()
@@ -19,31 +22,128 @@ func sessionRecord(s *session.Session) []string {
 		durationCol = "In progress"
 	}
 
+	var rate string
+	if s.Rate != 0 {
+		rate = strconv.FormatFloat(s.Rate, 'f', -1, 64)
+	}
+
 	return []string{
 		s.ProjectName,
 		s.Task,
 		s.StartTime.Format("2006-01-02"),
 		s.StartTime.Format(time.TimeOnly),
 		durationCol,
-		time.Time{}.Add(s.CurrentDuration()).Format(time.TimeOnly),
+		csvDuration(s.CurrentDuration()),
 		s.Notes,
+		strings.Join(s.Tags, ", "),
+		rate,
+		s.Profile,
 	}
 }
 
-func SessionToSheet(s *session.Session) []any {
-	record := sessionRecord(s)
-	sheet := make([]any, len(record))
-	durationIndex := slices.Index(HEADERS, "Duration")
+// csvDuration writes d as hh:mm:ss, hours may be over 24
+func csvDuration(d time.Duration) string {
+	seconds := int64(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// sheetRecord is the row of a session in the order of HEADERS with typed
+// values: dates and times are serial numbers in loc, the duration is in days
+// and the end time of a running session is empty
+func sheetRecord(s *session.Session, loc *time.Location) []any {
+	var end any = ""
+	if endTime := s.EndTime(); endTime != nil {
+		end = serialDate(*endTime, loc)
+	}
+
+	var rate any = ""
+	if s.Rate != 0 {
+		rate = s.Rate
+	}
+
+	return []any{
+		s.ProjectName,
+		s.Task,
+		serialDay(s.StartTime, loc),
+		serialDate(s.StartTime, loc),
+		end,
+		serialDuration(s.CurrentDuration()),
+		s.Notes,
+		strings.Join(s.Tags, ", "),
+		rate,
+		s.Profile,
+	}
+}
 
-	for i, value := range record {
-		if i == durationIndex && s.EndTime() != nil { // Duration column with completed session
-			sheet[i] = `=INDIRECT("E"&ROW())-INDIRECT("D"&ROW())`
-		} else {
-			sheet[i] = value
+// RowText is a session's row as text by header, the way ReadRows reads it
+// back from a sheet
+func RowText(s *session.Session, loc *time.Location) map[string]string {
+	values := map[string]string{}
+	for i, v := range sheetRecord(s, loc) {
+		header := HEADERS[i].(string)
+		values[header] = cellText(header, v)
+	}
+	return values
+}
+
+// cellText is an unformatted cell as text: dates as yyyy-mm-dd, times of day
+// as hh:mm:ss and durations as h:mm:ss. Cells Sheets did not read as numbers
+// are kept as typed.
+func cellText(header string, v any) string {
+	var n float64
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		n = v
+	case string:
+		// text is a number only in the typed columns, notes like 007 are kept
+		var err error
+		if _, typed := columnFormats[header]; !typed {
+			return strings.TrimSpace(v)
 		}
+		if n, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+			return strings.TrimSpace(v)
+		}
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+
+	switch header {
+	case "Date":
+		return sheetsEpoch.AddDate(0, 0, int(math.Floor(n))).Format(time.DateOnly)
+	case "Start Time", "End Time":
+		// only the time of day, a time typed into the cell has no date
+		seconds := int64(math.Round((n-math.Floor(n))*86400)) % 86400
+		return time.Time{}.Add(time.Duration(seconds) * time.Second).Format(time.TimeOnly)
+	case "Duration":
+		return FormatHours(time.Duration(math.Round(n*86400)) * time.Second)
+	default:
+		return strconv.FormatFloat(n, 'f', -1, 64)
 	}
+}
+
+// FormatHours writes d as h:mm:ss, hours may be over 24
+func FormatHours(d time.Duration) string {
+	seconds := int64(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
 
-	return sheet
+// ParseHours reads h:mm:ss or h:mm, hours may be over 24
+func ParseHours(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q (use h:mm:ss)", s)
+	}
+	var d time.Duration
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i > 0 && (n > 59 || len(part) != 2)) {
+			return 0, fmt.Errorf("invalid duration %q (use h:mm:ss)", s)
+		}
+		d += time.Duration(n) * []time.Duration{time.Hour, time.Minute, time.Second}[i]
+	}
+	return d, nil
 }
 
 func SessionToCsvRow(s *session.Session) []string {
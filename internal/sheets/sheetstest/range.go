@@ -0,0 +1,159 @@
+package sheetstest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cellRange is a parsed A1 range, rows and columns count from 0 and an end
+// of -1 means the range is open in that direction
+type cellRange struct {
+	sheet              string
+	startRow, startCol int
+	endRow, endCol     int
+}
+
+// parseRange parses A1 notation: 'Sheet Name'!A1:J1, Sheet!A:J or A5
+func parseRange(a1 string) (cellRange, error) {
+	rng := cellRange{endRow: -1, endCol: -1}
+
+	cells := a1
+	if strings.HasPrefix(a1, "'") {
+		// quotes inside a quoted name are doubled
+		var name strings.Builder
+		i := 1
+		for ; i < len(a1); i++ {
+			if a1[i] == '\'' {
+				if i+1 < len(a1) && a1[i+1] == '\'' {
+					name.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			name.WriteByte(a1[i])
+		}
+		if i == len(a1) {
+			return rng, errors.New("unterminated sheet name")
+		}
+		rng.sheet = name.String()
+		rest := a1[i+1:]
+		if rest == "" {
+			return rng, nil
+		}
+		var ok bool
+		if cells, ok = strings.CutPrefix(rest, "!"); !ok {
+			return rng, fmt.Errorf("unexpected %q after sheet name", rest)
+		}
+	} else if name, rest, ok := strings.Cut(a1, "!"); ok {
+		if needsQuotes(name) {
+			return rng, fmt.Errorf("sheet name %q must be quoted", name)
+		}
+		rng.sheet = name
+		cells = rest
+	} else if from, _, _ := strings.Cut(a1, ":"); !isCell(from) {
+		// a bare sheet name
+		rng.sheet = a1
+		return rng, nil
+	}
+
+	from, to, hasEnd := strings.Cut(cells, ":")
+	row, col, err := parseCell(from)
+	if err != nil {
+		return rng, err
+	}
+	rng.startRow, rng.startCol = max(row, 0), max(col, 0)
+	rng.endRow, rng.endCol = row, col
+	if row < 0 {
+		rng.endRow = -1
+	}
+	if col < 0 {
+		rng.endCol = -1
+	}
+
+	if hasEnd {
+		rng.endRow, rng.endCol, err = parseCell(to)
+		if err != nil {
+			return rng, err
+		}
+	}
+	return rng, nil
+}
+
+func isCell(cell string) bool {
+	_, _, err := parseCell(cell)
+	return err == nil
+}
+
+// parseCell parses A1, A or 1, a missing part is -1
+func parseCell(cell string) (row, col int, err error) {
+	i := 0
+	for i < len(cell) && cell[i] >= 'A' && cell[i] <= 'Z' {
+		i++
+	}
+	letters, digits := cell[:i], cell[i:]
+	if letters == "" && digits == "" {
+		return 0, 0, errors.New("empty cell")
+	}
+
+	col = -1
+	if letters != "" {
+		col = 0
+		for _, l := range letters {
+			col = col*26 + int(l-'A') + 1
+		}
+		col--
+	}
+
+	row = -1
+	if digits != "" {
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid row %q", digits)
+		}
+		row = n - 1
+	}
+	return row, col, nil
+}
+
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// String formats the range the way the API reports it, quoting the sheet
+// name only when needed
+func (r cellRange) String() string {
+	name := r.sheet
+	if needsQuotes(name) {
+		name = "'" + strings.ReplaceAll(r.sheet, "'", "''") + "'"
+	}
+
+	start := columnName(r.startCol) + strconv.Itoa(r.startRow+1)
+	if r.endRow < 0 && r.endCol < 0 {
+		return name + "!" + start
+	}
+	end := ""
+	if r.endCol >= 0 {
+		end = columnName(r.endCol)
+	}
+	if r.endRow >= 0 {
+		end += strconv.Itoa(r.endRow + 1)
+	}
+	return name + "!" + start + ":" + end
+}
+
+// needsQuotes tells whether a sheet name has to be quoted in A1 notation
+func needsQuotes(name string) bool {
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package sheetstest
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		a1   string
+		want cellRange
+	}{
+		{"Sheet1!A1:J1", cellRange{"Sheet1", 0, 0, 0, 9}},
+		{"Sheet1!A:J", cellRange{"Sheet1", 0, 0, -1, 9}},
+		{"'Craft Time'!A5", cellRange{"Craft Time", 4, 0, 4, 0}},
+		{"'Vlad''s log'!B2:C", cellRange{"Vlad's log", 1, 1, -1, 2}},
+		{"Sheet1", cellRange{"Sheet1", 0, 0, -1, -1}},
+		{"A1:B2", cellRange{"", 0, 0, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a1, func(t *testing.T) {
+			got, err := parseRange(tt.a1)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	for _, a1 := range []string{"Craft Time!A1", "'Vlad's log'!A1", "'Sheet1", "Sheet1!A0"} {
+		if _, err := parseRange(a1); err == nil {
+			t.Errorf("%s: expected an error", a1)
+		}
+	}
+}
+
+func TestRangeString(t *testing.T) {
+	tests := map[string]cellRange{
+		"Sheet1!A2:J2":         {"Sheet1", 1, 0, 1, 9},
+		"'Craft Time'!A1":      {"Craft Time", 0, 0, -1, -1},
+		"'Vlad''s log'!AA3:AB": {"Vlad's log", 2, 26, -1, 27},
+	}
+	for want, rng := range tests {
+		if got := rng.String(); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
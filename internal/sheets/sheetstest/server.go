@@ -0,0 +1,891 @@
+// Package sheetstest is an in-process fake of the Google Sheets v4 API for
+// tests. It keeps every spreadsheet as an in-memory grid of strings.
+package sheetstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Server fakes the values endpoints (get, update, append, batchUpdate and
+// batchUpdateByDataFilter) and enough of the spreadsheet endpoints to read
+// sheet titles and tag rows with developer metadata
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	spreadsheets map[string]*spreadsheet
+	failures     []failure
+	requests     int
+}
+
+type spreadsheet struct {
+	title    string
+	timeZone string
+	sheets   []*sheet
+	readOnly bool
+	// nextMetadataID is the ID of the next developer metadata
+	nextMetadataID int64
+}
+
+type sheet struct {
+	id    int64
+	title string
+	rows  [][]string
+	// formats are the number format patterns set on whole columns
+	formats map[int]string
+	rules   []*sheets.ConditionalFormatRule
+	// metadata is the developer metadata on rows, it moves with its row
+	metadata []*rowMetadata
+}
+
+type rowMetadata struct {
+	id    int64
+	key   string
+	value string
+	// row is 0-based
+	row int
+}
+
+type failure struct {
+	// call is the API method that fails, any when empty
+	call    string
+	code    int
+	message string
+}
+
+// NewServer starts a fake Sheets server that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{spreadsheets: map[string]*spreadsheet{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Service returns a client for the fake, no credentials are needed
+func (s *Server) Service(ctx context.Context) (*sheets.Service, error) {
+	return sheets.NewService(ctx,
+		option.WithEndpoint(s.URL+"/"),
+		option.WithHTTPClient(s.Client()),
+		option.WithoutAuthentication())
+}
+
+// AddSpreadsheet creates a spreadsheet in UTC with empty sheets of the given titles
+func (s *Server) AddSpreadsheet(id, title string, sheetTitles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss := &spreadsheet{title: title, timeZone: "Etc/UTC"}
+	for i, name := range sheetTitles {
+		ss.sheets = append(ss.sheets, &sheet{id: int64(i), title: name})
+	}
+	s.spreadsheets[id] = ss
+}
+
+// Values returns the cells of a sheet, nil if there is no such sheet
+func (s *Server) Values(id, sheetTitle string) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.sheet(id, sheetTitle)
+	if sh == nil {
+		return nil
+	}
+	rows := make([][]string, len(sh.rows))
+	for i, row := range sh.rows {
+		rows[i] = append([]string(nil), row...)
+	}
+	return trimRows(rows)
+}
+
+// SetValues replaces the cells of a sheet
+func (s *Server) SetValues(id, sheetTitle string, rows [][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sh := s.sheet(id, sheetTitle); sh != nil {
+		sh.rows = rows
+	}
+}
+
+// Requests counts the requests served, failed ones included
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// SetTimeZone changes the timezone in the spreadsheet settings
+func (s *Server) SetTimeZone(id, timeZone string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ss := s.spreadsheets[id]; ss != nil {
+		ss.timeZone = timeZone
+	}
+}
+
+// NumberFormat returns the number format pattern set on a column, e.g. "C"
+func (s *Server) NumberFormat(id, sheetTitle, column string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.sheet(id, sheetTitle)
+	if sh == nil {
+		return ""
+	}
+	_, col, err := parseCell(column)
+	if err != nil {
+		return ""
+	}
+	return sh.formats[col]
+}
+
+// ConditionalFormats returns the custom formulas of a sheet's conditional
+// format rules, in order
+func (s *Server) ConditionalFormats(id, sheetTitle string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.sheet(id, sheetTitle)
+	if sh == nil {
+		return nil
+	}
+	var formulas []string
+	for _, rule := range sh.rules {
+		formulas = append(formulas, rule.BooleanRule.Condition.Values[0].UserEnteredValue)
+	}
+	return formulas
+}
+
+// Metadata returns the 1-based row tagged with a developer metadata key and
+// value, 0 if there is none
+func (s *Server) Metadata(id, sheetTitle, key, value string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.sheet(id, sheetTitle)
+	if sh == nil {
+		return 0
+	}
+	for _, m := range sh.metadata {
+		if m.key == key && m.value == value {
+			return m.row + 1
+		}
+	}
+	return 0
+}
+
+// InsertRows inserts n empty rows before the 1-based row, as a user would,
+// moving the rows below and their metadata down
+func (s *Server) InsertRows(id, sheetTitle string, row, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.sheet(id, sheetTitle)
+	if sh == nil {
+		return
+	}
+	at := row - 1
+	for len(sh.rows) < at {
+		sh.rows = append(sh.rows, nil)
+	}
+	sh.rows = slices.Insert(sh.rows, at, make([][]string, n)...)
+	for _, m := range sh.metadata {
+		if m.row >= at {
+			m.row += n
+		}
+	}
+}
+
+// DeleteRow deletes a 1-based row and the metadata on it, as a user would
+func (s *Server) DeleteRow(id, sheetTitle string, row int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.sheet(id, sheetTitle)
+	if sh == nil || row < 1 || row > len(sh.rows) {
+		return
+	}
+	sh.deleteRows(row-1, row)
+}
+
+// deleteRows deletes the 0-based rows start to end, end excluded, and the
+// metadata on them
+func (sh *sheet) deleteRows(start, end int) {
+	end = min(end, len(sh.rows))
+	if start >= end {
+		return
+	}
+	sh.rows = slices.Delete(sh.rows, start, end)
+	sh.metadata = slices.DeleteFunc(sh.metadata, func(m *rowMetadata) bool { return m.row >= start && m.row < end })
+	for _, m := range sh.metadata {
+		if m.row >= end {
+			m.row -= end - start
+		}
+	}
+}
+
+// SortRows sorts the rows below the header by the text of a column, e.g.
+// "A", as a user would. Metadata moves with its row.
+func (s *Server) SortRows(id, sheetTitle, column string, descending bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.sheet(id, sheetTitle)
+	_, col, err := parseCell(column)
+	if sh == nil || err != nil || len(sh.rows) < 2 {
+		return
+	}
+
+	order := make([]int, len(sh.rows)-1)
+	for i := range order {
+		order[i] = i + 1
+	}
+	cell := func(r int) string {
+		if col < len(sh.rows[r]) {
+			return sh.rows[r][col]
+		}
+		return ""
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		if descending {
+			a, b = b, a
+		}
+		return strings.Compare(cell(a), cell(b))
+	})
+
+	rows := [][]string{sh.rows[0]}
+	moved := map[int]int{}
+	for to, from := range order {
+		rows = append(rows, sh.rows[from])
+		moved[from] = to + 1
+	}
+	sh.rows = rows
+	for _, m := range sh.metadata {
+		if to, ok := moved[m.row]; ok {
+			m.row = to
+		}
+	}
+}
+
+// SetReadOnly makes every write to a spreadsheet fail as if the caller
+// could only view it
+func (s *Server) SetReadOnly(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ss := s.spreadsheets[id]; ss != nil {
+		ss.readOnly = true
+	}
+}
+
+// FailNext makes the next request fail with the given HTTP status
+func (s *Server) FailNext(code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{code: code, message: message})
+}
+
+// FailNextCall makes the next call of an API method fail with the given HTTP
+// status, e.g. spreadsheets.batchUpdate or spreadsheets.values.append
+func (s *Server) FailNextCall(call string, code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{call: call, code: code, message: message})
+}
+
+func (s *Server) sheet(id, title string) *sheet {
+	ss := s.spreadsheets[id]
+	if ss == nil {
+		return nil
+	}
+	for _, sh := range ss.sheets {
+		if sh.title == title {
+			return sh
+		}
+	}
+	return nil
+}
+
+// apiError is how the Sheets API reports errors
+type apiError struct {
+	code    int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func errorf(code int, format string, args ...any) *apiError {
+	return &apiError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	var resp any
+	var err *apiError
+	call := callName(r)
+	i := slices.IndexFunc(s.failures, func(f failure) bool { return f.call == "" || f.call == call })
+	if i >= 0 {
+		f := s.failures[i]
+		s.failures = slices.Delete(s.failures, i, i+1)
+		err = errorf(f.code, "%s", f.message)
+	} else {
+		resp, err = s.route(r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(err.code)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{
+				"code":    err.code,
+				"message": err.message,
+				"status":  statusName(err.code),
+			},
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// callName names the API method of a request as in the Sheets API reference,
+// e.g. spreadsheets.values.append
+func callName(r *http.Request) string {
+	path, _ := strings.CutPrefix(r.URL.Path, "/v4/spreadsheets/")
+	_, rest, _ := strings.Cut(path, "/")
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		return "spreadsheets.get"
+	case rest == "":
+		return "spreadsheets.batchUpdate"
+	case rest == "values:batchUpdate":
+		return "spreadsheets.values.batchUpdate"
+	case rest == "values:batchUpdateByDataFilter":
+		return "spreadsheets.values.batchUpdateByDataFilter"
+	case rest == "developerMetadata:search":
+		return "spreadsheets.developerMetadata.search"
+	case strings.HasSuffix(rest, ":append"):
+		return "spreadsheets.values.append"
+	case r.Method == http.MethodPut:
+		return "spreadsheets.values.update"
+	default:
+		return "spreadsheets.values.get"
+	}
+}
+
+func (s *Server) route(r *http.Request) (any, *apiError) {
+	path, ok := strings.CutPrefix(r.URL.Path, "/v4/spreadsheets/")
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	}
+
+	id, rest, _ := strings.Cut(path, "/")
+	id, method, _ := strings.Cut(id, ":")
+	ss := s.spreadsheets[id]
+	if ss == nil {
+		return nil, errorf(http.StatusNotFound, "Requested entity was not found.")
+	}
+	if ss.readOnly && r.Method != http.MethodGet {
+		return nil, errorf(http.StatusForbidden, "The caller does not have permission")
+	}
+
+	switch {
+	case rest == "" && method == "" && r.Method == http.MethodGet:
+		return s.getSpreadsheet(id, ss), nil
+	case rest == "" && method == "batchUpdate" && r.Method == http.MethodPost:
+		var req sheets.BatchUpdateSpreadsheetRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return s.batchUpdate(id, ss, &req)
+	case rest == "values:batchUpdate" && r.Method == http.MethodPost:
+		var req sheets.BatchUpdateValuesRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return s.batchUpdateValues(id, ss, &req)
+	case rest == "developerMetadata:search" && r.Method == http.MethodPost:
+		var req sheets.SearchDeveloperMetadataRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return s.searchMetadata(ss, &req)
+	case rest == "values:batchUpdateByDataFilter" && r.Method == http.MethodPost:
+		var req sheets.BatchUpdateValuesByDataFilterRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return s.batchUpdateValuesByDataFilter(id, ss, &req)
+	}
+
+	a1, ok := strings.CutPrefix(rest, "values/")
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return s.getValues(ss, a1)
+	case http.MethodPut:
+		var vr sheets.ValueRange
+		if err := decode(r, &vr); err != nil {
+			return nil, err
+		}
+		return s.updateValues(id, ss, a1, vr.Values)
+	case http.MethodPost:
+		a1, ok := strings.CutSuffix(a1, ":append")
+		if !ok {
+			return nil, errorf(http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		}
+		var vr sheets.ValueRange
+		if err := decode(r, &vr); err != nil {
+			return nil, err
+		}
+		return s.appendValues(id, ss, a1, vr.Values)
+	}
+	return nil, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+}
+
+func decode(r *http.Request, v any) *apiError {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return errorf(http.StatusBadRequest, "Invalid JSON payload received. %v", err)
+	}
+	return nil
+}
+
+func (s *Server) getSpreadsheet(id string, ss *spreadsheet) *sheets.Spreadsheet {
+	resp := &sheets.Spreadsheet{
+		SpreadsheetId: id,
+		Properties:    &sheets.SpreadsheetProperties{Title: ss.title, TimeZone: ss.timeZone},
+	}
+	for i, sh := range ss.sheets {
+		resp.Sheets = append(resp.Sheets, &sheets.Sheet{
+			Properties:         &sheets.SheetProperties{SheetId: sh.id, Title: sh.title, Index: int64(i)},
+			ConditionalFormats: sh.rules,
+		})
+	}
+	return resp
+}
+
+func (s *Server) batchUpdate(id string, ss *spreadsheet, req *sheets.BatchUpdateSpreadsheetRequest) (any, *apiError) {
+	resp := &sheets.BatchUpdateSpreadsheetResponse{SpreadsheetId: id}
+	for _, r := range req.Requests {
+		reply := &sheets.Response{}
+		switch {
+		case r.UpdateSpreadsheetProperties != nil:
+			if strings.Contains(r.UpdateSpreadsheetProperties.Fields, "title") {
+				ss.title = r.UpdateSpreadsheetProperties.Properties.Title
+			}
+		case r.UpdateCells != nil:
+			if err := ss.updateCells(r.UpdateCells); err != nil {
+				return nil, err
+			}
+		case r.RepeatCell != nil:
+			sh, err := ss.sheetByID(r.RepeatCell.Range.SheetId)
+			if err != nil {
+				return nil, err
+			}
+			cell := r.RepeatCell.Cell
+			if r.RepeatCell.Fields != "userEnteredFormat.numberFormat" || cell.UserEnteredFormat == nil || cell.UserEnteredFormat.NumberFormat == nil {
+				return nil, errorf(http.StatusBadRequest, "only number formats can be repeated on the fake Sheets server")
+			}
+			if sh.formats == nil {
+				sh.formats = map[int]string{}
+			}
+			for c := r.RepeatCell.Range.StartColumnIndex; c < r.RepeatCell.Range.EndColumnIndex; c++ {
+				sh.formats[int(c)] = cell.UserEnteredFormat.NumberFormat.Pattern
+			}
+		case r.AddConditionalFormatRule != nil:
+			rule := r.AddConditionalFormatRule.Rule
+			if len(rule.Ranges) == 0 {
+				return nil, errorf(http.StatusBadRequest, "Invalid requests[0].addConditionalFormatRule: a rule needs a range")
+			}
+			sh, err := ss.sheetByID(rule.Ranges[0].SheetId)
+			if err != nil {
+				return nil, err
+			}
+			index := min(int(r.AddConditionalFormatRule.Index), len(sh.rules))
+			sh.rules = slices.Insert(sh.rules, index, rule)
+		case r.DeleteConditionalFormatRule != nil:
+			sh, err := ss.sheetByID(r.DeleteConditionalFormatRule.SheetId)
+			if err != nil {
+				return nil, err
+			}
+			index := int(r.DeleteConditionalFormatRule.Index)
+			if index >= len(sh.rules) {
+				return nil, errorf(http.StatusBadRequest, "Invalid requests[0].deleteConditionalFormatRule: No conditional format on sheet: %d at index: %d", sh.id, index)
+			}
+			sh.rules = slices.Delete(sh.rules, index, index+1)
+		case r.CreateDeveloperMetadata != nil:
+			m, err := ss.createMetadata(r.CreateDeveloperMetadata.DeveloperMetadata)
+			if err != nil {
+				return nil, err
+			}
+			reply.CreateDeveloperMetadata = &sheets.CreateDeveloperMetadataResponse{DeveloperMetadata: m}
+		case r.DeleteDimension != nil:
+			rng := r.DeleteDimension.Range
+			if rng == nil || rng.Dimension != "ROWS" {
+				return nil, errorf(http.StatusBadRequest, "only rows can be deleted on the fake Sheets server")
+			}
+			sh, err := ss.sheetByID(rng.SheetId)
+			if err != nil {
+				return nil, err
+			}
+			sh.deleteRows(int(rng.StartIndex), int(rng.EndIndex))
+		case r.AddSheet != nil:
+			props, err := ss.addSheet(r.AddSheet.Properties)
+			if err != nil {
+				return nil, err
+			}
+			reply.AddSheet = &sheets.AddSheetResponse{Properties: props}
+		default:
+			return nil, errorf(http.StatusBadRequest, "request not supported by the fake Sheets server")
+		}
+		resp.Replies = append(resp.Replies, reply)
+	}
+	return resp, nil
+}
+
+func (ss *spreadsheet) addSheet(props *sheets.SheetProperties) (*sheets.SheetProperties, *apiError) {
+	if props == nil || props.Title == "" {
+		return nil, errorf(http.StatusBadRequest, "Invalid requests[0].addSheet: a sheet needs a title")
+	}
+	var id int64
+	for _, sh := range ss.sheets {
+		if sh.title == props.Title {
+			return nil, errorf(http.StatusBadRequest, "Invalid requests[0].addSheet: A sheet with the name \"%s\" already exists. Please enter another name.", props.Title)
+		}
+		id = max(id, sh.id+1)
+	}
+	ss.sheets = append(ss.sheets, &sheet{id: id, title: props.Title})
+	return &sheets.SheetProperties{SheetId: id, Title: props.Title, Index: int64(len(ss.sheets) - 1)}, nil
+}
+
+// updateCells clears a whole sheet when given a range without rows, or
+// writes the entered values of rows from a start cell
+func (ss *spreadsheet) updateCells(req *sheets.UpdateCellsRequest) *apiError {
+	var sheetID int64
+	switch {
+	case req.Range != nil:
+		sheetID = req.Range.SheetId
+	case req.Start != nil:
+		sheetID = req.Start.SheetId
+	}
+	sh, err := ss.sheetByID(sheetID)
+	if err != nil {
+		return err
+	}
+
+	if req.Range != nil {
+		if len(req.Rows) > 0 || req.Range.StartRowIndex != 0 || req.Range.EndRowIndex != 0 || req.Range.StartColumnIndex != 0 || req.Range.EndColumnIndex != 0 {
+			return errorf(http.StatusBadRequest, "only clearing a whole sheet is supported by the fake Sheets server")
+		}
+		sh.rows = nil
+		return nil
+	}
+
+	values := make([][]any, len(req.Rows))
+	for i, row := range req.Rows {
+		for _, cell := range row.Values {
+			values[i] = append(values[i], enteredValue(cell))
+		}
+	}
+	rng := cellRange{startRow: int(req.Start.RowIndex), startCol: int(req.Start.ColumnIndex), endRow: -1, endCol: -1}
+	_, err = sh.write("", rng, values)
+	return err
+}
+
+// createMetadata tags a single row, the only location the fake supports
+func (ss *spreadsheet) createMetadata(m *sheets.DeveloperMetadata) (*sheets.DeveloperMetadata, *apiError) {
+	if m == nil || m.MetadataKey == "" || m.Location == nil || m.Location.DimensionRange == nil {
+		return nil, errorf(http.StatusBadRequest, "Invalid requests[0].createDeveloperMetadata: metadata needs a key and a location")
+	}
+	dr := m.Location.DimensionRange
+	if dr.Dimension != "ROWS" || dr.EndIndex != dr.StartIndex+1 {
+		return nil, errorf(http.StatusBadRequest, "only metadata on a single row is supported by the fake Sheets server")
+	}
+	sh, err := ss.sheetByID(dr.SheetId)
+	if err != nil {
+		return nil, err
+	}
+
+	ss.nextMetadataID++
+	sh.metadata = append(sh.metadata, &rowMetadata{id: ss.nextMetadataID, key: m.MetadataKey, value: m.MetadataValue, row: int(dr.StartIndex)})
+	created := *m
+	created.MetadataId = ss.nextMetadataID
+	return &created, nil
+}
+
+func (ss *spreadsheet) sheetByID(id int64) (*sheet, *apiError) {
+	for _, sh := range ss.sheets {
+		if sh.id == id {
+			return sh, nil
+		}
+	}
+	return nil, errorf(http.StatusBadRequest, "No grid with id: %d", id)
+}
+
+// enteredValue is what a cell shows in the grid, formulas are kept as written
+func enteredValue(cell *sheets.CellData) any {
+	if cell == nil || cell.UserEnteredValue == nil {
+		return ""
+	}
+	v := cell.UserEnteredValue
+	switch {
+	case v.FormulaValue != nil:
+		return *v.FormulaValue
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.NumberValue != nil:
+		return *v.NumberValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	}
+	return ""
+}
+
+func (s *Server) getValues(ss *spreadsheet, a1 string) (any, *apiError) {
+	rng, sh, err := s.lookup(ss, a1)
+	if err != nil {
+		return nil, err
+	}
+
+	var values [][]any
+	for r := rng.startRow; r < len(sh.rows) && (rng.endRow < 0 || r <= rng.endRow); r++ {
+		var row []any
+		for c := rng.startCol; c < len(sh.rows[r]) && (rng.endCol < 0 || c <= rng.endCol); c++ {
+			row = append(row, sh.rows[r][c])
+		}
+		values = append(values, row)
+	}
+
+	resp := &sheets.ValueRange{Range: rng.String(), MajorDimension: "ROWS"}
+	for _, row := range trimRows(toStrings(values)) {
+		cells := make([]any, len(row))
+		for i, v := range row {
+			cells[i] = v
+		}
+		resp.Values = append(resp.Values, cells)
+	}
+	return resp, nil
+}
+
+func (s *Server) updateValues(id string, ss *spreadsheet, a1 string, values [][]any) (*sheets.UpdateValuesResponse, *apiError) {
+	rng, sh, err := s.lookup(ss, a1)
+	if err != nil {
+		return nil, err
+	}
+	return sh.write(id, rng, values)
+}
+
+func (s *Server) appendValues(id string, ss *spreadsheet, a1 string, values [][]any) (any, *apiError) {
+	rng, sh, err := s.lookup(ss, a1)
+	if err != nil {
+		return nil, err
+	}
+
+	// the table ends at the last row with a value in the range's columns
+	next := 0
+	for r, row := range sh.rows {
+		for c := rng.startCol; c < len(row) && (rng.endCol < 0 || c <= rng.endCol); c++ {
+			if row[c] != "" {
+				next = r + 1
+				break
+			}
+		}
+	}
+	target := cellRange{sheet: rng.sheet, startRow: next, startCol: rng.startCol, endRow: -1, endCol: rng.endCol}
+
+	updates, err := sh.write(id, target, values)
+	if err != nil {
+		return nil, err
+	}
+	return &sheets.AppendValuesResponse{SpreadsheetId: id, TableRange: rng.String(), Updates: updates}, nil
+}
+
+func (s *Server) batchUpdateValues(id string, ss *spreadsheet, req *sheets.BatchUpdateValuesRequest) (any, *apiError) {
+	resp := &sheets.BatchUpdateValuesResponse{SpreadsheetId: id}
+	for _, data := range req.Data {
+		update, err := s.updateValues(id, ss, data.Range, data.Values)
+		if err != nil {
+			return nil, err
+		}
+		resp.Responses = append(resp.Responses, update)
+		resp.TotalUpdatedRows += update.UpdatedRows
+		resp.TotalUpdatedCells += update.UpdatedCells
+	}
+	return resp, nil
+}
+
+// searchMetadata finds row metadata by key and, when set, value
+func (s *Server) searchMetadata(ss *spreadsheet, req *sheets.SearchDeveloperMetadataRequest) (any, *apiError) {
+	resp := &sheets.SearchDeveloperMetadataResponse{}
+	for _, filter := range req.DataFilters {
+		if filter.DeveloperMetadataLookup == nil {
+			return nil, errorf(http.StatusBadRequest, "only developer metadata lookups are supported by the fake Sheets server")
+		}
+		lookup := filter.DeveloperMetadataLookup
+		for _, sh := range ss.sheets {
+			for _, m := range sh.metadata {
+				if m.key != lookup.MetadataKey || (lookup.MetadataValue != "" && m.value != lookup.MetadataValue) {
+					continue
+				}
+				resp.MatchedDeveloperMetadata = append(resp.MatchedDeveloperMetadata, &sheets.MatchedDeveloperMetadata{
+					DataFilters: []*sheets.DataFilter{filter},
+					DeveloperMetadata: &sheets.DeveloperMetadata{
+						MetadataId:    m.id,
+						MetadataKey:   m.key,
+						MetadataValue: m.value,
+						Visibility:    "DOCUMENT",
+						Location: &sheets.DeveloperMetadataLocation{
+							LocationType: "ROW",
+							DimensionRange: &sheets.DimensionRange{
+								SheetId: sh.id, Dimension: "ROWS",
+								StartIndex: int64(m.row), EndIndex: int64(m.row + 1),
+							},
+						},
+					},
+				})
+			}
+		}
+	}
+	return resp, nil
+}
+
+// batchUpdateValuesByDataFilter writes to every row tagged with the
+// metadata of a filter, from column A. Filters without a match are left out
+// of the response.
+func (s *Server) batchUpdateValuesByDataFilter(id string, ss *spreadsheet, req *sheets.BatchUpdateValuesByDataFilterRequest) (any, *apiError) {
+	resp := &sheets.BatchUpdateValuesByDataFilterResponse{SpreadsheetId: id}
+	for _, data := range req.Data {
+		if data.DataFilter == nil || data.DataFilter.DeveloperMetadataLookup == nil {
+			return nil, errorf(http.StatusBadRequest, "only developer metadata lookups are supported by the fake Sheets server")
+		}
+		lookup := data.DataFilter.DeveloperMetadataLookup
+		for _, sh := range ss.sheets {
+			for _, m := range sh.metadata {
+				if m.key != lookup.MetadataKey || m.value != lookup.MetadataValue {
+					continue
+				}
+				rng := cellRange{sheet: sh.title, startRow: m.row, endRow: m.row, startCol: 0, endCol: -1}
+				update, err := sh.write(id, rng, data.Values)
+				if err != nil {
+					return nil, err
+				}
+				resp.Responses = append(resp.Responses, &sheets.UpdateValuesByDataFilterResponse{
+					DataFilter:     data.DataFilter,
+					UpdatedRange:   update.UpdatedRange,
+					UpdatedRows:    update.UpdatedRows,
+					UpdatedColumns: update.UpdatedColumns,
+					UpdatedCells:   update.UpdatedCells,
+				})
+				resp.TotalUpdatedRows += update.UpdatedRows
+				resp.TotalUpdatedCells += update.UpdatedCells
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) lookup(ss *spreadsheet, a1 string) (cellRange, *sheet, *apiError) {
+	rng, err := parseRange(a1)
+	if err != nil {
+		return rng, nil, errorf(http.StatusBadRequest, "Unable to parse range: %s", a1)
+	}
+	if rng.sheet == "" && len(ss.sheets) > 0 {
+		rng.sheet = ss.sheets[0].title
+	}
+	for _, sh := range ss.sheets {
+		if sh.title == rng.sheet {
+			return rng, sh, nil
+		}
+	}
+	return rng, nil, errorf(http.StatusBadRequest, "Unable to parse range: %s", a1)
+}
+
+// write puts values at the top left of rng, refusing to write outside of it
+func (sh *sheet) write(id string, rng cellRange, values [][]any) (*sheets.UpdateValuesResponse, *apiError) {
+	resp := &sheets.UpdateValuesResponse{SpreadsheetId: id}
+	width := 0
+	for i, row := range values {
+		r := rng.startRow + i
+		if rng.endRow >= 0 && r > rng.endRow {
+			return nil, errorf(http.StatusBadRequest, "Requested writing within range [%s], but tried writing to row [%d]", rng, r+1)
+		}
+		for len(sh.rows) <= r {
+			sh.rows = append(sh.rows, nil)
+		}
+		for j, v := range row {
+			c := rng.startCol + j
+			if rng.endCol >= 0 && c > rng.endCol {
+				return nil, errorf(http.StatusBadRequest, "Requested writing within range [%s], but tried writing to column [%s]", rng, columnName(c))
+			}
+			for len(sh.rows[r]) <= c {
+				sh.rows[r] = append(sh.rows[r], "")
+			}
+			if v != nil {
+				sh.rows[r][c] = fmt.Sprint(v)
+			}
+			resp.UpdatedCells++
+		}
+		width = max(width, len(row))
+	}
+
+	resp.UpdatedRows = int64(len(values))
+	resp.UpdatedColumns = int64(width)
+	if len(values) > 0 && width > 0 {
+		written := cellRange{
+			sheet:    rng.sheet,
+			startRow: rng.startRow, endRow: rng.startRow + len(values) - 1,
+			startCol: rng.startCol, endCol: rng.startCol + width - 1,
+		}
+		resp.UpdatedRange = written.String()
+	}
+	return resp, nil
+}
+
+func toStrings(values [][]any) [][]string {
+	rows := make([][]string, len(values))
+	for i, row := range values {
+		for _, v := range row {
+			rows[i] = append(rows[i], fmt.Sprint(v))
+		}
+	}
+	return rows
+}
+
+// trimRows drops trailing empty cells and rows, as the API does
+func trimRows(rows [][]string) [][]string {
+	for i, row := range rows {
+		for len(row) > 0 && row[len(row)-1] == "" {
+			row = row[:len(row)-1]
+		}
+		rows[i] = row
+	}
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	return rows
+}
+
+func statusName(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,156 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// summaryColumns are the columns of a session tab the summary reads
+var summaryColumns = []string{"Project", "Task", "Date", "Duration"}
+
+// summaryTables are the QUERY formulas of each table over the session
+// data, whose columns are Project, Task, Date, Hours, Week and Month
+var summaryTables = map[string]struct {
+	title string
+	query string
+}{
+	"project_week": {
+		title: "Hours per project per week",
+		query: "select Col5, Col1, sum(Col4) where Col1 is not null group by Col5, Col1 order by Col5 desc, Col1 " +
+			"label Col5 'Week', Col1 'Project', sum(Col4) 'Hours' format Col5 'yyyy-mm-dd', sum(Col4) '0.00'",
+	},
+	"project_month": {
+		title: "Hours per project per month",
+		query: "select Col6, Col1, sum(Col4) where Col1 is not null group by Col6, Col1 order by Col6 desc, Col1 " +
+			"label Col6 'Month', Col1 'Project', sum(Col4) 'Hours' format Col6 'yyyy-mm', sum(Col4) '0.00'",
+	},
+	"task": {
+		title: "Hours per task",
+		query: "select Col1, Col2, sum(Col4) where Col1 is not null group by Col1, Col2 order by Col1, sum(Col4) desc " +
+			"label Col1 'Project', Col2 'Task', sum(Col4) 'Hours' format sum(Col4) '0.00'",
+	},
+	"running_total": {
+		title: "Running total",
+		query: "select Col3, sum(Col4) where Col1 is not null group by Col3 order by Col3 " +
+			"label Col3 'Day', sum(Col4) 'Hours' format Col3 'yyyy-mm-dd', sum(Col4) '0.00'",
+	},
+}
+
+// summaryWidth is the number of columns a table takes, one more is left empty
+const summaryWidth = 3
+
+// RefreshSummary rewrites the summary tab with formulas over every session
+// tab, so new monthly tabs are picked up. Tabs without the columns the
+// summary needs are left out.
+func RefreshSummary(ctx context.Context, p GoogleSheetsParams) error {
+	pattern, err := p.Cfg.SheetPattern()
+	if err != nil {
+		return fmt.Errorf("failed to resolve google_sheets.sheet_name: %w", err)
+	}
+	spreadsheet, err := p.Client.GetSpreadsheet(ctx, p.Cfg.SpreadsheetID)
+	if err != nil {
+		return fmt.Errorf("failed to open spreadsheet: %w", err)
+	}
+
+	var parts []string
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties == nil || !pattern.MatchString(sheet.Properties.Title) {
+			continue
+		}
+		name := sheet.Properties.Title
+		resp, err := p.Client.GetValues(ctx, p.Cfg.SpreadsheetID, quoteSheetName(name)+"!1:1")
+		if err != nil {
+			return fmt.Errorf("failed to read headers of sheet %q: %w", name, err)
+		}
+		if len(resp.Values) == 0 {
+			continue
+		}
+		if part, ok := summaryData(name, NewLayout(resp.Values[0])); ok {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return errors.New("no session tabs with Project, Task, Date and Duration columns to summarize")
+	}
+	data := "{" + strings.Join(parts, ";") + "}"
+
+	summary, err := EnsureSheet(ctx, p.Client, p.Cfg.SpreadsheetID, p.Cfg.Summary.SheetName)
+	if err != nil {
+		return err
+	}
+
+	// clear the tab, then write every table
+	requests := []*sheets.Request{{
+		UpdateCells: &sheets.UpdateCellsRequest{
+			Range:  &sheets.GridRange{SheetId: summary.SheetId},
+			Fields: "userEnteredValue,userEnteredFormat",
+		},
+	}}
+	for i, table := range p.Cfg.Summary.Tables {
+		requests = append(requests, summaryTable(summary.SheetId, int64(i*(summaryWidth+1)), table, data))
+	}
+	if _, err := p.Client.BatchUpdate(ctx, p.Cfg.SpreadsheetID, requests); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
+
+// summaryData is the session data of one tab as an array of Project, Task,
+// Date, Hours, the Monday of the week and the first of the month
+func summaryData(sheet string, layout *Layout) (string, bool) {
+	cols := map[string]string{}
+	for _, header := range summaryColumns {
+		col := layout.column(header)
+		if col < 0 {
+			return "", false
+		}
+		name := columnName(col)
+		cols[header] = fmt.Sprintf("%s!%s2:%s", quoteSheetName(sheet), name, name)
+	}
+
+	date := cols["Date"]
+	return fmt.Sprintf("ARRAYFORMULA({%s,%s,%s,%s*24,TO_DATE(%s-WEEKDAY(%s,3)),TO_DATE(EOMONTH(%s,-1)+1)})",
+		cols["Project"], cols["Task"], date, cols["Duration"], date, date, date), true
+}
+
+// summaryTable writes a table's title and formula at column col
+func summaryTable(sheetID, col int64, table, data string) *sheets.Request {
+	t := summaryTables[table]
+	rows := []*sheets.RowData{
+		{Values: []*sheets.CellData{{
+			UserEnteredValue:  &sheets.ExtendedValue{StringValue: &t.title},
+			UserEnteredFormat: &sheets.CellFormat{TextFormat: &sheets.TextFormat{Bold: true}},
+		}}},
+		{Values: []*sheets.CellData{{
+			UserEnteredValue: formula(fmt.Sprintf(`=QUERY(%s,"%s",0)`, data, t.query)),
+		}}},
+	}
+
+	if table == "running_total" {
+		// the query fills Day and Hours, the total runs down the third column
+		hours := columnName(int(col) + 1)
+		label := "Running total"
+		rows[1].Values = append(rows[1].Values, &sheets.CellData{}, &sheets.CellData{
+			UserEnteredValue: &sheets.ExtendedValue{StringValue: &label},
+		})
+		rows = append(rows, &sheets.RowData{Values: []*sheets.CellData{{}, {}, {
+			UserEnteredValue: formula(fmt.Sprintf(`=SCAN(0,%s3:%s,LAMBDA(total,hours,IF(hours="",,total+hours)))`, hours, hours)),
+		}}})
+	}
+
+	return &sheets.Request{
+		UpdateCells: &sheets.UpdateCellsRequest{
+			Start:  &sheets.GridCoordinate{SheetId: sheetID, RowIndex: 0, ColumnIndex: col},
+			Rows:   rows,
+			Fields: "userEnteredValue,userEnteredFormat.textFormat.bold",
+		},
+	}
+}
+
+func formula(f string) *sheets.ExtendedValue {
+	return &sheets.ExtendedValue{FormulaValue: &f}
+}
@@ -0,0 +1,97 @@
+package sheets
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/config"
+)
+
+func TestRefreshSummary(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("every session tab is summarized", func(t *testing.T) {
+		server, p := fakeSheets(t, "Notes")
+		p.Cfg.SheetName = "CraftTime {{.Year}}-{{.Month}}"
+		p.Cfg.Summary = config.SummaryConfig{Enabled: true, SheetName: "Summary", Tables: config.SummaryTables}
+
+		for _, start := range []time.Time{
+			time.Date(2025, 3, 14, 9, 0, 0, 0, time.Local),
+			time.Date(2025, 4, 2, 9, 0, 0, 0, time.Local),
+		} {
+			p.Session.StartTime = start
+			if _, err := InitRow(ctx, p); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+		// a reordered tab is read by its headers
+		server.SetValues("sheet-id", "CraftTime 2025-04", [][]string{
+			{"Date", "Project", "Task", "Start Time", "End Time", "Duration", "Notes", "Tags", "Rate", "Profile"},
+		})
+
+		if err := RefreshSummary(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		rows := server.Values("sheet-id", "Summary")
+		if len(rows) != 3 {
+			t.Fatalf("expected titles, formulas and the running total, got %v", rows)
+		}
+		titles := strings.Join(rows[0], "|")
+		if want := "Hours per project per week||||Hours per project per month||||Hours per task||||Running total"; titles != want {
+			t.Errorf("expected titles %s, got %s", want, titles)
+		}
+
+		week := rows[1][0]
+		for _, want := range []string{
+			"'CraftTime 2025-03'!A2:A,'CraftTime 2025-03'!B2:B,'CraftTime 2025-03'!C2:C,'CraftTime 2025-03'!F2:F*24",
+			"'CraftTime 2025-04'!B2:B,'CraftTime 2025-04'!C2:C,'CraftTime 2025-04'!A2:A,'CraftTime 2025-04'!F2:F*24",
+			"group by Col5, Col1",
+		} {
+			if !strings.Contains(week, want) {
+				t.Errorf("expected the weekly formula to contain %s, got %s", want, week)
+			}
+		}
+		if strings.Contains(week, "Notes") {
+			t.Errorf("expected other tabs to be left out, got %s", week)
+		}
+		if rows[1][14] != "Running total" || !strings.HasPrefix(rows[2][14], "=SCAN(0,N3:N,") {
+			t.Errorf("expected a running total over column N, got %v", rows[1:])
+		}
+	})
+
+	t.Run("refresh replaces the tables", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		p.Cfg.Summary = config.SummaryConfig{Enabled: true, SheetName: "Summary", Tables: config.SummaryTables}
+		if _, err := InitRow(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if err := RefreshSummary(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		p.Cfg.Summary.Tables = []string{"task"}
+		if err := RefreshSummary(ctx, p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		rows := server.Values("sheet-id", "Summary")
+		if len(rows) != 2 || len(rows[0]) != 1 || rows[0][0] != "Hours per task" {
+			t.Errorf("expected only the task table, got %v", rows)
+		}
+		if !strings.HasPrefix(rows[1][0], "=QUERY({ARRAYFORMULA({'CraftTime'!A2:A,") {
+			t.Errorf("expected a query over the session tab, got %s", rows[1][0])
+		}
+	})
+
+	t.Run("no session tab", func(t *testing.T) {
+		_, p := fakeSheets(t, "Notes")
+		p.Cfg.SheetName = "CraftTime"
+		p.Cfg.Summary = config.SummaryConfig{Enabled: true, SheetName: "Summary", Tables: []string{"task"}}
+
+		if err := RefreshSummary(ctx, p); err == nil {
+			t.Error("expected an error without session tabs")
+		}
+	})
+}
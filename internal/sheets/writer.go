@@ -0,0 +1,79 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Writer collects changes to the rows of sessions and writes them in a
+// single request. Rows are found by the session they are tagged with, so
+// they may have moved since they were written. A session updated again
+// before Flush keeps only its last values.
+type Writer struct {
+	client        Client
+	spreadsheetID string
+	pending       []*sheets.DataFilterValueRange
+	index         map[string]int
+}
+
+// NewWriter creates a Writer for a spreadsheet
+func NewWriter(client Client, spreadsheetID string) *Writer {
+	return &Writer{client: client, spreadsheetID: spreadsheetID, index: map[string]int{}}
+}
+
+// Update queues row to be written over the row of a session, starting at
+// column A
+func (w *Writer) Update(sessionID string, row []any) {
+	values := &sheets.DataFilterValueRange{
+		DataFilter:     anchorFilter(sessionID),
+		MajorDimension: "ROWS",
+		Values:         [][]any{row},
+	}
+	if i, ok := w.index[sessionID]; ok {
+		w.pending[i] = values
+		return
+	}
+	w.index[sessionID] = len(w.pending)
+	w.pending = append(w.pending, values)
+}
+
+// Len is the number of rows waiting for Flush
+func (w *Writer) Len() int {
+	return len(w.pending)
+}
+
+// Flush writes every queued row with one BatchUpdateValuesByDataFilter. The
+// changes are kept when the request fails, so Flush can be called again.
+// Sessions without a row are reported with a MissingAnchorError once the
+// other rows are written.
+func (w *Writer) Flush(ctx context.Context) error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	resp, err := w.client.BatchUpdateValuesByDataFilter(ctx, w.spreadsheetID, w.pending)
+	if err != nil {
+		return fmt.Errorf("failed to write %d rows: %w", len(w.pending), err)
+	}
+
+	written := map[string]bool{}
+	for _, r := range resp.Responses {
+		if r.DataFilter != nil && r.DataFilter.DeveloperMetadataLookup != nil && r.UpdatedRows > 0 {
+			written[r.DataFilter.DeveloperMetadataLookup.MetadataValue] = true
+		}
+	}
+	var missing []string
+	for _, values := range w.pending {
+		if id := values.DataFilter.DeveloperMetadataLookup.MetadataValue; !written[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	w.pending = nil
+	clear(w.index)
+	if len(missing) > 0 {
+		return &MissingAnchorError{SessionIDs: missing}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	ctx := context.Background()
+
+	// initRows appends a row for each session ID
+	initRows := func(t *testing.T, p GoogleSheetsParams, ids ...string) {
+		t.Helper()
+		for _, id := range ids {
+			s := *p.Session
+			s.ID = id
+			p.Session = &s
+			if _, err := InitRow(ctx, p); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+	}
+
+	t.Run("pending rows are written in one request", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		initRows(t, p, "a", "b")
+		w := NewWriter(p.Client, "sheet-id")
+
+		w.Update("a", []any{"quilt", "cutting"})
+		w.Update("b", []any{"scarf", "knitting"})
+		// replaces the first change
+		w.Update("a", []any{"quilt", "sewing"})
+		if w.Len() != 2 {
+			t.Fatalf("expected 2 pending rows, got %d", w.Len())
+		}
+
+		requests := server.Requests()
+		if err := w.Flush(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := server.Requests() - requests; got != 1 {
+			t.Errorf("expected 1 request, got %d", got)
+		}
+		if w.Len() != 0 {
+			t.Errorf("expected nothing pending, got %d", w.Len())
+		}
+
+		values := server.Values("sheet-id", "CraftTime")
+		if len(values) != 3 || values[1][1] != "sewing" || values[2][0] != "scarf" {
+			t.Errorf("expected both rows with the last change, got %v", values)
+		}
+
+		requests = server.Requests()
+		if err := w.Flush(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := server.Requests() - requests; got != 0 {
+			t.Errorf("expected no request for an empty flush, got %d", got)
+		}
+	})
+
+	t.Run("failed flush keeps the rows", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		initRows(t, p, "a")
+		w := NewWriter(p.Client, "sheet-id")
+
+		w.Update("a", []any{"quilt", "cutting"})
+		server.FailNext(http.StatusInternalServerError, "Internal error encountered.")
+		if err := w.Flush(ctx); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		if w.Len() != 1 {
+			t.Errorf("expected the row to stay pending, got %d", w.Len())
+		}
+		if err := w.Flush(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("sessions without a row are reported", func(t *testing.T) {
+		server, p := fakeSheets(t, "CraftTime")
+		initRows(t, p, "a")
+		w := NewWriter(p.Client, "sheet-id")
+
+		w.Update("a", []any{"quilt", "sewing"})
+		w.Update("gone", []any{"hat", "knitting"})
+		err := w.Flush(ctx)
+		var missing *MissingAnchorError
+		if !errors.As(err, &missing) || len(missing.SessionIDs) != 1 || missing.SessionIDs[0] != "gone" {
+			t.Fatalf("expected a missing anchor for gone, got: %v", err)
+		}
+		if values := server.Values("sheet-id", "CraftTime"); values[1][1] != "sewing" {
+			t.Errorf("expected the other row to be written, got %v", values)
+		}
+		if w.Len() != 0 {
+			t.Errorf("expected nothing pending, got %d", w.Len())
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets"
+)
+
+// Sink is where Export replays sessions of the history to
+type Sink interface {
+	// Exported tells which of the sessions the sink already has
+	Exported(ctx context.Context, sessions []*session.Session) ([]bool, error)
+	// Append writes sessions the sink does not have yet
+	Append(ctx context.Context, sessions []*session.Session) error
+}
+
+// SheetsSink exports to the Google Sheets spreadsheet. A session is in it
+// when a row is tagged with its ID.
+type SheetsSink struct {
+	Params sheets.GoogleSheetsParams
+	// Location is the timezone of the spreadsheet, set by Append
+	Location *time.Location
+}
+
+func (s *SheetsSink) Exported(ctx context.Context, sessions []*session.Session) ([]bool, error) {
+	ids, err := sheets.ExportedSessions(ctx, s.Params)
+	if err != nil {
+		return nil, err
+	}
+	exported := make([]bool, len(sessions))
+	for i, session := range sessions {
+		exported[i] = ids[session.ID]
+	}
+	return exported, nil
+}
+
+func (s *SheetsSink) Append(ctx context.Context, sessions []*session.Session) error {
+	loc, err := sheets.AppendSessions(ctx, s.Params, sessions)
+	if err != nil {
+		return err
+	}
+	s.Location = loc
+	return nil
+}
+
+// CsvSink exports to a CSV file. The file has no session IDs, a session is
+// in it when a row has its project, date and start time.
+type CsvSink struct {
+	FilePath string
+}
+
+func (s *CsvSink) Exported(ctx context.Context, sessions []*session.Session) ([]bool, error) {
+	keys, err := sheets.CsvSessionKeys(s.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	exported := make([]bool, len(sessions))
+	for i, session := range sessions {
+		exported[i] = keys[sheets.CsvSessionKey(session)]
+	}
+	return exported, nil
+}
+
+func (s *CsvSink) Append(ctx context.Context, sessions []*session.Session) error {
+	return sheets.AppendCsvRows(s.FilePath, sessions)
+}
+
+// defaultBatchSize is how many sessions Export writes at once
+const defaultBatchSize = 100
+
+// ExportOptions configure Export
+type ExportOptions struct {
+	// From and Until limit the export to sessions starting at or after From
+	// and before Until, a zero time is no limit
+	From, Until time.Time
+	// Profile is the profile the sessions were recorded under, sessions of
+	// other profiles belong to other sinks. Sessions without a profile, e.g.
+	// imported ones, are exported under any profile.
+	Profile string
+	// DryRun reports what would be exported without writing anything
+	DryRun bool
+	// BatchSize is how many sessions are written at once, 100 when zero
+	BatchSize int
+	// Progress is called after every batch with the sessions written so far
+	Progress func(done, total int)
+}
+
+// ExportResult is what Export did with the sessions of the history
+type ExportResult struct {
+	// Exported are the sessions written to the sink, or that would be on a
+	// dry run
+	Exported []history.Entry
+	// Existing are the sessions the sink already has
+	Existing []history.Entry
+	// Running are the sessions that have not ended, the runner writes them
+	Running []history.Entry
+}
+
+// Export writes the sessions of the history the sink does not have yet, in
+// the order they started. When a batch fails the result has the sessions
+// written before it.
+func Export(ctx context.Context, sink Sink, h *history.History, opts ExportOptions) (*ExportResult, error) {
+	result := &ExportResult{}
+	var candidates []history.Entry
+	var sessions []*session.Session
+	for _, entry := range h.Entries() {
+		if (entry.Profile != "" && entry.Profile != opts.Profile) ||
+			(!opts.From.IsZero() && entry.Start.Before(opts.From)) ||
+			(!opts.Until.IsZero() && !entry.Start.Before(opts.Until)) {
+			continue
+		}
+		if entry.End == nil {
+			result.Running = append(result.Running, entry)
+			continue
+		}
+		candidates = append(candidates, entry)
+		sessions = append(sessions, entry.Session())
+	}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	exported, err := sink.Exported(ctx, sessions)
+	if err != nil {
+		return nil, err
+	}
+	var pending []*session.Session
+	var entries []history.Entry
+	for i, entry := range candidates {
+		if exported[i] {
+			result.Existing = append(result.Existing, entry)
+			continue
+		}
+		pending = append(pending, sessions[i])
+		entries = append(entries, entry)
+	}
+	if opts.DryRun {
+		result.Exported = entries
+		return result, nil
+	}
+
+	size := opts.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	for start := 0; start < len(pending); start += size {
+		end := min(start+size, len(pending))
+		if err := sink.Append(ctx, pending[start:end]); err != nil {
+			return result, err
+		}
+		result.Exported = append(result.Exported, entries[start:end]...)
+		if opts.Progress != nil {
+			opts.Progress(end, len(pending))
+		}
+	}
+	return result, nil
+}
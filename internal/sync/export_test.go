@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets"
+)
+
+// finished is a history entry of a session of an hour
+func finished(id, project string, start time.Time) history.Entry {
+	s := &session.Session{ID: id, StartTime: start, ProjectName: project}
+	s.Finish(start.Add(time.Hour), time.Hour)
+	return history.FromSession(s)
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sessions missing from the sheet are appended", func(t *testing.T) {
+		server, p, h := synced(t)
+		p.Cfg.SheetName = "CraftTime {{.Year}}-{{.Month}}"
+		h.Put(finished("session-2", "hat", start.Add(24*time.Hour)))
+		h.Put(finished("session-3", "rug", start.AddDate(0, 1, 0)))
+		h.Put(finished("session-4", "scarf", start.Add(48*time.Hour)))
+		h.Put(history.Entry{ID: "running", Project: "hat", Start: start.Add(72 * time.Hour)})
+		business := finished("business", "quilt", start.Add(time.Hour))
+		business.Profile = "business"
+		h.Put(business)
+
+		var progress []int
+		sink := &SheetsSink{Params: p}
+		result, err := Export(ctx, sink, h, ExportOptions{BatchSize: 2, Progress: func(done, total int) {
+			progress = append(progress, done, total)
+		}})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Exported) != 3 || result.Exported[0].ID != "session-2" || result.Exported[2].ID != "session-3" {
+			t.Errorf("expected sessions 2, 4 and 3 exported, got %+v", result.Exported)
+		}
+		if len(result.Existing) != 1 || result.Existing[0].ID != "session-1" || len(result.Running) != 1 {
+			t.Errorf("expected session-1 existing and one running, got %+v", result)
+		}
+		if len(progress) != 4 || progress[0] != 2 || progress[2] != 3 || progress[3] != 3 {
+			t.Errorf("expected progress after each batch, got %v", progress)
+		}
+		if sink.Location == nil || sink.Location.String() != "Etc/UTC" {
+			t.Errorf("expected the spreadsheet timezone, got %v", sink.Location)
+		}
+
+		// each session is in the tab of its month, tagged with its ID
+		for id, want := range map[string][2]any{
+			"session-2": {"CraftTime 2025-03", 2},
+			"session-4": {"CraftTime 2025-03", 3},
+			"session-3": {"CraftTime 2025-04", 2},
+		} {
+			if row := server.Metadata("sheet-id", want[0].(string), "craftie_session", id); row != want[1] {
+				t.Errorf("%s: expected row %d of %s, got %d", id, want[1], want[0], row)
+			}
+		}
+		if rows := server.Values("sheet-id", "CraftTime 2025-04"); len(rows) != 2 || rows[0][0] != "Project" || rows[1][0] != "rug" {
+			t.Errorf("expected a new tab with headers and the session, got %v", rows)
+		}
+
+		// everything is there now
+		result, err = Export(ctx, sink, h, ExportOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Exported) != 0 || len(result.Existing) != 4 {
+			t.Errorf("expected nothing left to export, got %+v", result)
+		}
+	})
+
+	t.Run("sessions without a profile are exported under any profile", func(t *testing.T) {
+		_, p, h := synced(t)
+		h.Put(finished("imported", "hat", start.Add(24*time.Hour)))
+		business := finished("business", "rug", start.Add(48*time.Hour))
+		business.Profile = "business"
+		h.Put(business)
+		personal := finished("personal", "scarf", start.Add(72*time.Hour))
+		personal.Profile = "personal"
+		h.Put(personal)
+
+		result, err := Export(ctx, &SheetsSink{Params: p}, h, ExportOptions{Profile: "business"})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Exported) != 2 || result.Exported[0].ID != "imported" || result.Exported[1].ID != "business" {
+			t.Errorf("expected the imported and business sessions exported, got %+v", result.Exported)
+		}
+		if len(result.Existing) != 1 || result.Existing[0].ID != "session-1" {
+			t.Errorf("expected session-1 existing, got %+v", result.Existing)
+		}
+	})
+
+	t.Run("a dry run and a range write nothing else", func(t *testing.T) {
+		server, p, h := synced(t)
+		h.Put(finished("session-2", "hat", start.Add(24*time.Hour)))
+		h.Put(finished("session-3", "rug", start.Add(48*time.Hour)))
+		before := server.Requests()
+
+		sink := &SheetsSink{Params: p}
+		result, err := Export(ctx, sink, h, ExportOptions{DryRun: true})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Exported) != 2 {
+			t.Errorf("expected 2 sessions to export, got %+v", result.Exported)
+		}
+		// only the tags were read
+		if got := server.Requests() - before; got != 1 {
+			t.Errorf("expected 1 request, got %d", got)
+		}
+
+		result, err = Export(ctx, sink, h, ExportOptions{From: start.Add(24 * time.Hour), Until: start.Add(48 * time.Hour)})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Exported) != 1 || result.Exported[0].ID != "session-2" {
+			t.Errorf("expected only session-2, got %+v", result.Exported)
+		}
+		if rows := server.Values("sheet-id", "CraftTime"); len(rows) != 3 {
+			t.Errorf("expected one row appended, got %v", rows)
+		}
+	})
+
+	t.Run("csv files are deduplicated by start", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sessions", "craftie.csv")
+		h := &history.History{}
+		h.Put(finished("session-1", "quilt", start))
+		h.Put(finished("session-2", "hat", start.Add(24*time.Hour)))
+
+		sink := &CsvSink{FilePath: path}
+		result, err := Export(ctx, sink, h, ExportOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Exported) != 2 {
+			t.Errorf("expected 2 sessions exported, got %+v", result.Exported)
+		}
+
+		// the same session under another ID, e.g. imported from the file
+		h.Put(finished("session-1-copy", "quilt", start))
+		h.Put(finished("session-3", "rug", start.Add(48*time.Hour)))
+		result, err = Export(ctx, sink, h, ExportOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Exported) != 1 || result.Exported[0].ID != "session-3" || len(result.Existing) != 3 {
+			t.Errorf("expected only session-3 exported, got %+v", result)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 4 || !strings.HasPrefix(lines[0], "Project,") || !strings.HasPrefix(lines[3], "rug,") {
+			t.Errorf("expected headers and 3 rows, got %q", lines)
+		}
+	})
+
+	t.Run("rows exported while a session runs are kept", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie.csv")
+		running := &session.Session{ID: "running", StartTime: start.Add(72 * time.Hour), ProjectName: "scarf"}
+		state, err := sheets.InitCsvRow(path, running)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		h := &history.History{}
+		h.Put(finished("session-1", "quilt", start))
+		h.Put(finished("session-2", "hat", start.Add(24*time.Hour)))
+		if _, err := Export(ctx, &CsvSink{FilePath: path}, h, ExportOptions{}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		running.Finish(running.StartTime.Add(2*time.Hour), 2*time.Hour)
+		if err := sheets.SyncCsvRow(state, running); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		rows, _, err := sheets.ReadCsvRows(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(rows) != 3 || rows[0].Values["Project"] != "scarf" || rows[0].Values["Duration"] != "02:00:00" ||
+			rows[1].Values["Project"] != "quilt" || rows[2].Values["Project"] != "hat" {
+			t.Errorf("expected the running row updated and the exported rows kept, got %+v", rows)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets"
+)
+
+// inProgress is the End Time of a running session in a CSV file
+const inProgress = "In progress"
+
+// ImportIssue is a line of a file that was not imported
+type ImportIssue struct {
+	Line   int
+	Reason string
+}
+
+// Running is the session that runs while importing, its In progress row is
+// synced by that session and is not imported
+type Running struct {
+	Project string
+	Start   time.Time
+}
+
+// ImportResult is what ImportCsv did with the rows of a file
+type ImportResult struct {
+	// Imported are the sessions added to the history
+	Imported []history.Entry
+	// InProgress are the lines of sessions that were running when the file
+	// was last written, they end after the duration written then
+	InProgress []int
+	// Running are the lines of the running session, it adds itself to the
+	// history when it ends
+	Running []int
+	// Duplicates are rows of sessions the history already has
+	Duplicates []ImportIssue
+	// Errors are rows that could not be read
+	Errors []ImportIssue
+}
+
+// ImportCsv adds the sessions of a CSV file written by the CSV sink to the
+// history. Dates and times are local. A session is a duplicate when the
+// history, or an earlier row, has a session of the same project with the
+// same start. The row of the running session, if any, is skipped.
+func ImportCsv(filePath string, h *history.History, current *Running) (*ImportResult, error) {
+	rows, rowErrors, err := sheets.ReadCsvRows(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	for _, e := range rowErrors {
+		result.Errors = append(result.Errors, ImportIssue{Line: e.Line, Reason: e.Err.Error()})
+	}
+
+	type key struct {
+		project string
+		start   time.Time
+	}
+	known := map[key]bool{}
+	for _, entry := range h.Entries() {
+		known[key{entry.Project, entry.Start.Truncate(time.Second)}] = true
+	}
+
+	for _, row := range rows {
+		values := row.Values
+		running := values["End Time"] == inProgress
+		if running {
+			values["End Time"] = ""
+		}
+		entry, err := entryFromValues(values, time.Local)
+		if err == nil && entry.Project == "" {
+			err = errors.New("the row has no Project")
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, ImportIssue{Line: row.Line, Reason: err.Error()})
+			continue
+		}
+
+		k := key{entry.Project, entry.Start}
+		if current != nil && k == (key{current.Project, current.Start.Truncate(time.Second)}) {
+			result.Running = append(result.Running, row.Line)
+			continue
+		}
+		if known[k] {
+			result.Duplicates = append(result.Duplicates, ImportIssue{
+				Line:   row.Line,
+				Reason: fmt.Sprintf("%s started %s is already in the history", entry.Project, entry.Start.Format("2006-01-02 15:04:05")),
+			})
+			continue
+		}
+		known[k] = true
+
+		if running {
+			result.InProgress = append(result.InProgress, row.Line)
+		}
+		entry.ID = session.NewID()
+		h.Put(entry)
+		result.Imported = append(result.Imported, entry)
+	}
+	sortIssues(result.Errors)
+	return result, nil
+}
+
+// sortIssues orders issues by line, malformed lines are found before the
+// rows are read
+func sortIssues(issues []ImportIssue) {
+	slices.SortStableFunc(issues, func(a, b ImportIssue) int {
+		return a.Line - b.Line
+	})
+}
@@ -0,0 +1,153 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets"
+)
+
+func TestImportCsv(t *testing.T) {
+	local := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, time.Local)
+	}
+
+	t.Run("rows are read back into sessions", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie.csv")
+		// written before the Tags, Rate and Profile columns were added
+		data := "Project,Task,Date,Start Time,End Time,Duration,Notes\n" +
+			"quilt,cutting,2025-03-14,09:00:00,12:00:00,02:30:00,\"binding, finally\"\n" +
+			"hat,,2025-03-14,22:00:00,01:00:00,03:00:00,\n" +
+			"rug,weaving,2025-03-15,08:00:00,In progress,01:15:00,\n" +
+			"scarf,,2025-03-16,09:00:00,11:00:00,26:00:00,\n" +
+			"quilt,cutting,2025-03-14,09:00:00,12:00:00,02:30:00,\n" +
+			"sock,,14/03/2025,09:00:00,10:00:00,01:00:00,\n" +
+			"sock,,2025-03-17,09:00:00,,,\n" +
+			"sock,\"bad\"quote,2025-03-18,09:00:00,10:00:00,01:00:00,\n" +
+			",,2025-03-19,09:00:00,10:00:00,01:00:00,\n" +
+			"mitten,,2025-03-20,09:00:00,10:00:00,01:00:00,\n"
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		h := &history.History{}
+		h.Put(finished("session-1", "mitten", local(20, 9, 0)))
+
+		result, err := ImportCsv(path, h, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Imported) != 4 {
+			t.Fatalf("expected 4 sessions imported, got %+v", result.Imported)
+		}
+
+		quilt := result.Imported[0]
+		if quilt.ID == "" || quilt.Task != "cutting" || quilt.Notes != "binding, finally" ||
+			!quilt.End.Equal(local(14, 12, 0)) || quilt.Duration != 2*time.Hour+30*time.Minute {
+			t.Errorf("expected the quilt session, got %+v", quilt)
+		}
+		if hat := result.Imported[1]; !hat.End.Equal(local(15, 1, 0)) {
+			t.Errorf("expected the hat session to end the next day, got %v", hat.End)
+		}
+		if rug := result.Imported[2]; !rug.End.Equal(local(15, 9, 15)) {
+			t.Errorf("expected the running session to end after its duration, got %v", rug.End)
+		}
+		if scarf := result.Imported[3]; !scarf.End.Equal(local(17, 11, 0)) || scarf.Duration != 26*time.Hour {
+			t.Errorf("expected the scarf session to last 26 hours, got %+v", scarf)
+		}
+		if len(result.InProgress) != 1 || result.InProgress[0] != 4 {
+			t.Errorf("expected line 4 in progress, got %v", result.InProgress)
+		}
+
+		if len(result.Duplicates) != 2 || result.Duplicates[0].Line != 6 || result.Duplicates[1].Line != 11 {
+			t.Errorf("expected lines 6 and 11 to be duplicates, got %+v", result.Duplicates)
+		}
+		var lines []int
+		for _, issue := range result.Errors {
+			lines = append(lines, issue.Line)
+		}
+		if len(lines) != 4 || lines[0] != 7 || lines[1] != 8 || lines[2] != 9 || lines[3] != 10 {
+			t.Errorf("expected errors on lines 7 to 10, got %+v", result.Errors)
+		}
+		if len(h.Entries()) != 5 {
+			t.Errorf("expected the sessions in the history, got %d", len(h.Entries()))
+		}
+	})
+
+	t.Run("rows written by the CSV sink round trip", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie.csv")
+		s := &session.Session{ID: "a", StartTime: local(14, 9, 0), ProjectName: "quilt", Tags: []string{"gift", "wool"}, Rate: 40, Profile: "business"}
+		state, err := sheets.InitCsvRow(path, s)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		s.Finish(local(15, 12, 0), 25*time.Hour)
+		if err := sheets.SyncCsvRow(state, s); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		h := &history.History{}
+		result, err := ImportCsv(path, h, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Imported) != 1 || len(result.Errors) != 0 {
+			t.Fatalf("expected 1 session imported, got %+v", result)
+		}
+		got := result.Imported[0]
+		if !got.Start.Equal(s.StartTime) || !got.End.Equal(*s.EndTime()) || got.Duration != 25*time.Hour ||
+			got.Rate != 40 || got.Profile != "business" || len(got.Tags) != 2 {
+			t.Errorf("expected the session back, got %+v", got)
+		}
+
+		// importing again adds nothing
+		result, err = ImportCsv(path, h, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Imported) != 0 || len(result.Duplicates) != 1 {
+			t.Errorf("expected a duplicate, got %+v", result)
+		}
+	})
+
+	t.Run("the row of the running session is skipped", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie.csv")
+		s := &session.Session{ID: "a", StartTime: local(14, 9, 0).Add(300 * time.Millisecond), ProjectName: "quilt"}
+		if _, err := sheets.InitCsvRow(path, s); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		// left behind by a session that never ended
+		stale := &session.Session{ID: "b", StartTime: local(13, 9, 0), ProjectName: "quilt"}
+		if _, err := sheets.InitCsvRow(path, stale); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		h := &history.History{}
+		result, err := ImportCsv(path, h, &Running{Project: "quilt", Start: s.StartTime})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Running) != 1 || result.Running[0] != 2 {
+			t.Errorf("expected line 2 skipped as running, got %v", result.Running)
+		}
+		if len(result.Imported) != 1 || !result.Imported[0].Start.Equal(stale.StartTime) {
+			t.Errorf("expected the stale session imported, got %+v", result.Imported)
+		}
+		if len(result.InProgress) != 1 || result.InProgress[0] != 3 {
+			t.Errorf("expected line 3 in progress, got %v", result.InProgress)
+		}
+	})
+
+	t.Run("files without headers are refused", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "craftie.csv")
+		if err := os.WriteFile(path, []byte("quilt,cutting,2025-03-14,09:00:00\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ImportCsv(path, &history.History{}, nil); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
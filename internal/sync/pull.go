@@ -0,0 +1,403 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets"
+)
+
+// Policy decides a conflict, a cell changed both in the sheet and locally
+// since the last sync
+type Policy string
+
+const (
+	PolicySheet  Policy = "sheet"
+	PolicyLocal  Policy = "local"
+	PolicyPrompt Policy = "prompt"
+)
+
+// Policies lists the valid policies
+var Policies = []Policy{PolicySheet, PolicyLocal, PolicyPrompt}
+
+// Conflict is a cell changed both in the sheet and locally
+type Conflict struct {
+	SessionID string
+	Project   string
+	Sheet     string
+	Row       int
+	Field     string
+	// Base is the value of the last sync
+	Base       string
+	Local      string
+	SheetValue string
+}
+
+// Resolver asks which side of a conflict is kept, true keeps the sheet's
+type Resolver func(Conflict) (bool, error)
+
+// ChangeKind is what Pull did with a row
+type ChangeKind string
+
+const (
+	// Added is a row added by hand, or written by another device, that is
+	// now in the history
+	Added ChangeKind = "added"
+	// Pulled is a cell edited in the sheet that was applied locally
+	Pulled ChangeKind = "pulled"
+	// Pushed is a local value that was written over the sheet's
+	Pushed ChangeKind = "pushed"
+	// Skipped is a row that was left alone, Reason tells why
+	Skipped ChangeKind = "skipped"
+	// Missing is a synced session whose row is no longer in the sheet
+	Missing ChangeKind = "missing"
+)
+
+// Change is one entry of the report of Pull
+type Change struct {
+	Kind      ChangeKind
+	SessionID string
+	Project   string
+	Sheet     string
+	Row       int
+	Field     string
+	From, To  string
+	Reason    string
+}
+
+// PullOptions configure Pull
+type PullOptions struct {
+	Policy Policy
+	// Resolve decides conflicts under PolicyPrompt
+	Resolve Resolver
+	// DryRun reports the changes without writing to the sheet
+	DryRun bool
+}
+
+// PullResult is what Pull changed
+type PullResult struct {
+	Changes []Change
+	// Entries are the history entries to save, added or changed
+	Entries []history.Entry
+}
+
+// Pull reads the session tabs and merges them with the history. Cells edited
+// only in the sheet are applied locally, cells changed only locally are
+// written to the sheet and cells changed on both sides are decided by the
+// policy. Rows added by hand get a session and are tagged with it. Running
+// sessions are skipped, the runner owns them.
+//
+// The history is not saved, the returned entries are.
+func Pull(ctx context.Context, p sheets.GoogleSheetsParams, h *history.History, opts PullOptions) (*PullResult, error) {
+	rows, loc, err := sheets.ReadRows(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PullResult{}
+	w := sheets.NewWriter(p.Client, p.Cfg.SpreadsheetID)
+	var untagged []sheets.SheetRow
+	seen := map[string]bool{}
+
+	for _, row := range rows {
+		change := Change{SessionID: row.SessionID, Project: row.Values["Project"], Sheet: row.Sheet, Row: row.Row}
+
+		if row.SessionID != "" && seen[row.SessionID] {
+			change.Kind, change.Reason = Skipped, "another row has the same session"
+			result.Changes = append(result.Changes, change)
+			continue
+		}
+		seen[row.SessionID] = true
+
+		entry, known := h.Get(row.SessionID)
+		if row.SessionID != "" && !known && row.Values["End Time"] == "" {
+			change.Kind, change.Reason = Skipped, "the session is still running on another device"
+			result.Changes = append(result.Changes, change)
+			continue
+		}
+		if row.SessionID == "" || !known {
+			added, err := entryFromValues(row.Values, loc)
+			if err != nil {
+				change.Kind, change.Reason = Skipped, err.Error()
+				result.Changes = append(result.Changes, change)
+				continue
+			}
+			added.ID = row.SessionID
+			if added.ID == "" {
+				added.ID = session.NewID()
+				row.SessionID = added.ID
+				untagged = append(untagged, row)
+			}
+			seen[added.ID] = true
+			added.Spreadsheet = p.Cfg.SpreadsheetID
+			added.Sheet = row.Values
+			h.Put(added)
+			result.Entries = append(result.Entries, added)
+			change.Kind, change.SessionID = Added, added.ID
+			result.Changes = append(result.Changes, change)
+			continue
+		}
+
+		if entry.End == nil {
+			change.Kind, change.Reason = Skipped, "the session is still running"
+			result.Changes = append(result.Changes, change)
+			continue
+		}
+
+		merged, changes, err := merge(entry, row, loc, opts)
+		if err != nil {
+			return nil, err
+		}
+		result.Changes = append(result.Changes, changes...)
+		if merged == nil {
+			continue
+		}
+
+		local := sheets.RowText(merged.Session(), loc)
+		if differs(local, row.Values) {
+			w.Update(merged.ID, row.Layout.Row(merged.Session(), loc))
+		}
+		merged.Spreadsheet = p.Cfg.SpreadsheetID
+		merged.Sheet = local
+		h.Put(*merged)
+		result.Entries = append(result.Entries, *merged)
+	}
+
+	for _, entry := range h.Entries() {
+		if entry.Spreadsheet == p.Cfg.SpreadsheetID && entry.Sheet != nil && entry.End != nil && !seen[entry.ID] {
+			result.Changes = append(result.Changes, Change{
+				Kind: Missing, SessionID: entry.ID, Project: entry.Project,
+				Reason: "its row was deleted from the sheet, the session is kept locally",
+			})
+		}
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+	if err := sheets.TagRows(ctx, p, untagged); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(ctx); err != nil {
+		return nil, fmt.Errorf("failed to write merged rows: %w", err)
+	}
+	return result, nil
+}
+
+// merge compares a row with the entry of its session and the last synced
+// row. It returns the merged entry, nil when nothing changed.
+func merge(entry history.Entry, row sheets.SheetRow, loc *time.Location, opts PullOptions) (*history.Entry, []Change, error) {
+	local := sheets.RowText(entry.Session(), loc)
+	base := entry.Sheet
+	if base == nil {
+		// never synced, a difference can only be an edit in the sheet
+		base = local
+	}
+
+	var changes []Change
+	pulled := map[string]string{}
+	pushed := false
+	for _, field := range headers() {
+		sheetValue, ok := row.Values[field]
+		if !ok || sheetValue == local[field] {
+			continue
+		}
+		change := Change{SessionID: entry.ID, Project: entry.Project, Sheet: row.Sheet, Row: row.Row, Field: field}
+
+		takeSheet := sheetValue != base[field] && local[field] == base[field]
+		if sheetValue != base[field] && local[field] != base[field] {
+			var err error
+			if takeSheet, err = resolve(opts, Conflict{
+				SessionID: entry.ID, Project: entry.Project, Sheet: row.Sheet, Row: row.Row,
+				Field: field, Base: base[field], Local: local[field], SheetValue: sheetValue,
+			}); err != nil {
+				return nil, nil, err
+			}
+			change.Reason = "changed on both sides"
+		}
+
+		if takeSheet {
+			pulled[field] = sheetValue
+			change.Kind, change.From, change.To = Pulled, local[field], sheetValue
+		} else {
+			pushed = true
+			change.Kind, change.From, change.To = Pushed, sheetValue, local[field]
+		}
+		changes = append(changes, change)
+	}
+
+	if len(pulled) == 0 && !pushed && entry.Sheet != nil {
+		return nil, nil, nil
+	}
+	merged, err := applyValues(entry, local, pulled, loc)
+	if err != nil {
+		// the edit cannot be read, e.g. a date typed as text
+		return nil, []Change{{
+			Kind: Skipped, SessionID: entry.ID, Project: entry.Project, Sheet: row.Sheet, Row: row.Row,
+			Reason: err.Error(),
+		}}, nil
+	}
+	return &merged, changes, nil
+}
+
+func resolve(opts PullOptions, c Conflict) (bool, error) {
+	switch opts.Policy {
+	case PolicySheet:
+		return true, nil
+	case PolicyLocal:
+		return false, nil
+	default:
+		if opts.Resolve == nil {
+			return false, fmt.Errorf("%s of %s row %d changed in the sheet and locally, there is no terminal to ask on (use --policy sheet or local)", c.Field, c.Sheet, c.Row)
+		}
+		return opts.Resolve(c)
+	}
+}
+
+func headers() []string {
+	names := make([]string, len(sheets.HEADERS))
+	for i, h := range sheets.HEADERS {
+		names[i] = h.(string)
+	}
+	return names
+}
+
+// differs tells whether a row read from the sheet differs from local text
+// in a column it has
+func differs(local, sheetValues map[string]string) bool {
+	for field, v := range sheetValues {
+		if local[field] != v {
+			return true
+		}
+	}
+	return false
+}
+
+// applyValues changes entry by the cells pulled from the sheet. When times
+// change but the duration does not, the breaks keep their length.
+func applyValues(entry history.Entry, local, pulled map[string]string, loc *time.Location) (history.Entry, error) {
+	values := map[string]string{}
+	for field, v := range local {
+		values[field] = v
+	}
+	for field, v := range pulled {
+		values[field] = v
+	}
+
+	parsed, err := entryFromValues(values, loc)
+	if err != nil {
+		return entry, err
+	}
+
+	_, dateChanged := pulled["Date"]
+	_, startChanged := pulled["Start Time"]
+	_, endChanged := pulled["End Time"]
+	if dateChanged || startChanged || endChanged {
+		breaks := entry.End.Sub(entry.Start) - entry.Duration
+		entry.Start, entry.End = parsed.Start, parsed.End
+		entry.Duration = max(entry.End.Sub(entry.Start)-breaks, 0)
+	}
+	if _, ok := pulled["Duration"]; ok {
+		entry.Duration = parsed.Duration
+		// a longer duration than the session lasted moves its end
+		if end := entry.Start.Add(entry.Duration); end.After(*entry.End) {
+			entry.End = &end
+		}
+	}
+
+	entry.Project = parsed.Project
+	entry.Task = parsed.Task
+	entry.Notes = parsed.Notes
+	entry.Tags = parsed.Tags
+	entry.Rate = parsed.Rate
+	entry.Profile = parsed.Profile
+	return entry, nil
+}
+
+// entryFromValues reads a session from the text of a row. The end is on the
+// day of the start, or the next day when it is earlier than the start, or as
+// many days later as a duration of 24 hours or more takes. A row without an
+// end time ends after its duration.
+func entryFromValues(values map[string]string, loc *time.Location) (history.Entry, error) {
+	e := history.Entry{
+		Project: values["Project"],
+		Task:    values["Task"],
+		Notes:   values["Notes"],
+		Profile: values["Profile"],
+	}
+	for tag := range strings.SplitSeq(values["Tags"], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	if rate := values["Rate"]; rate != "" {
+		var err error
+		if e.Rate, err = strconv.ParseFloat(rate, 64); err != nil {
+			return e, fmt.Errorf("invalid Rate %q", rate)
+		}
+	}
+
+	day, err := time.ParseInLocation(time.DateOnly, values["Date"], loc)
+	if err != nil {
+		return e, fmt.Errorf("invalid Date %q (use yyyy-mm-dd)", values["Date"])
+	}
+	start, err := clock(values["Start Time"])
+	if err != nil {
+		return e, fmt.Errorf("invalid Start Time %q (use hh:mm:ss)", values["Start Time"])
+	}
+	e.Start = at(day, start)
+
+	hasDuration := values["Duration"] != ""
+	if hasDuration {
+		if e.Duration, err = sheets.ParseHours(values["Duration"]); err != nil {
+			return e, fmt.Errorf("invalid Duration %q (use h:mm:ss)", values["Duration"])
+		}
+	}
+
+	var end time.Time
+	switch {
+	case values["End Time"] != "":
+		endClock, err := clock(values["End Time"])
+		if err != nil {
+			return e, fmt.Errorf("invalid End Time %q (use hh:mm:ss)", values["End Time"])
+		}
+		end = at(day, endClock)
+		if end.Before(e.Start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		// a session of 24 hours or more ends days later
+		for hasDuration && end.Sub(e.Start) < e.Duration {
+			end = end.AddDate(0, 0, 1)
+		}
+	case hasDuration:
+		end = e.Start.Add(e.Duration)
+	default:
+		return e, errors.New("the row has neither an End Time nor a Duration")
+	}
+	e.End = &end
+	if !hasDuration {
+		e.Duration = end.Sub(e.Start)
+	}
+	return e, nil
+}
+
+// at is the wall clock time of day on a day, also across DST changes
+func at(day time.Time, timeOfDay time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, int(timeOfDay/time.Second), 0, day.Location())
+}
+
+// clock reads a time of day, hh:mm:ss or hh:mm
+func clock(s string) (time.Duration, error) {
+	for _, layout := range []string{time.TimeOnly, "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q", s)
+}
@@ -0,0 +1,272 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vlad/craftie/internal/config"
+	"github.com/vlad/craftie/internal/history"
+	"github.com/vlad/craftie/internal/session"
+	"github.com/vlad/craftie/internal/sheets"
+	"github.com/vlad/craftie/internal/sheets/sheetstest"
+)
+
+var start = time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+
+// synced writes a finished session to a fake sheet and records it in a
+// history the way the runner does: 09:00 to 12:00 with a 30 minute break
+func synced(t *testing.T) (*sheetstest.Server, sheets.GoogleSheetsParams, *history.History) {
+	t.Helper()
+	ctx := context.Background()
+	server := sheetstest.NewServer(t)
+	server.AddSpreadsheet("sheet-id", "Craft log", "CraftTime")
+	srv, err := server.Service(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	s := &session.Session{ID: "session-1", StartTime: start, ProjectName: "quilt", Task: "cutting"}
+	s.Finish(start.Add(3*time.Hour), 2*time.Hour+30*time.Minute)
+	p := sheets.GoogleSheetsParams{
+		Client:  sheets.NewClient(srv),
+		Cfg:     config.GoogleSheetsConfig{Enabled: true, SpreadsheetID: "sheet-id", SheetName: "CraftTime"},
+		Session: s,
+	}
+	if _, err := sheets.InitRow(ctx, p); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	h := &history.History{}
+	entry := history.FromSession(s)
+	entry.Spreadsheet = "sheet-id"
+	entry.Sheet = sheets.RowText(s, time.UTC)
+	h.Put(entry)
+	return server, p, h
+}
+
+// setCell changes a cell of the CraftTime tab, as someone editing the sheet
+func setCell(server *sheetstest.Server, row, col int, value string) {
+	rows := server.Values("sheet-id", "CraftTime")
+	for len(rows) < row {
+		rows = append(rows, nil)
+	}
+	for len(rows[row-1]) <= col {
+		rows[row-1] = append(rows[row-1], "")
+	}
+	rows[row-1][col] = value
+	server.SetValues("sheet-id", "CraftTime", rows)
+}
+
+// cell reads a cell of the CraftTime tab back as text
+func cell(t *testing.T, p sheets.GoogleSheetsParams, row int, header string) string {
+	t.Helper()
+	rows, _, err := sheets.ReadRows(context.Background(), p)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, r := range rows {
+		if r.Row == row {
+			return r.Values[header]
+		}
+	}
+	return ""
+}
+
+func TestPull(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cells edited in the sheet are applied locally", func(t *testing.T) {
+		server, p, h := synced(t)
+		// End Time 12:00 becomes 13:00
+		setCell(server, 2, 4, "13:00:00")
+		setCell(server, 2, 6, "fixed the end")
+
+		result, err := Pull(ctx, p, h, PullOptions{Policy: PolicyPrompt})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Changes) != 2 || result.Changes[0].Kind != Pulled || result.Changes[0].Field != "End Time" || result.Changes[1].Field != "Notes" {
+			t.Fatalf("expected End Time and Notes pulled, got %+v", result.Changes)
+		}
+
+		entry, _ := h.Get("session-1")
+		if !entry.End.Equal(start.Add(4*time.Hour)) || entry.Notes != "fixed the end" {
+			t.Errorf("expected the edits applied, got %+v", entry)
+		}
+		// the break keeps its length
+		if entry.Duration != 3*time.Hour+30*time.Minute {
+			t.Errorf("expected 3h30m worked, got %v", entry.Duration)
+		}
+		if got := cell(t, p, 2, "Duration"); got != "3:30:00" {
+			t.Errorf("expected the duration written to the sheet, got %q", got)
+		}
+		if len(result.Entries) != 1 || result.Entries[0].Sheet["End Time"] != "13:00:00" {
+			t.Errorf("expected the entry with its new base, got %+v", result.Entries)
+		}
+
+		// nothing left to merge
+		result, err = Pull(ctx, p, h, PullOptions{Policy: PolicyPrompt})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Changes) != 0 || len(result.Entries) != 0 {
+			t.Errorf("expected no changes, got %+v", result.Changes)
+		}
+	})
+
+	t.Run("rows added by hand become sessions", func(t *testing.T) {
+		server, p, h := synced(t)
+		server.SetValues("sheet-id", "CraftTime", append(server.Values("sheet-id", "CraftTime"),
+			[]string{"hat", "knitting", "2025-03-15", "22:00", "01:00", "", "", "gift, wool"},
+			[]string{"rug", "weaving", "someday"},
+		))
+
+		result, err := Pull(ctx, p, h, PullOptions{Policy: PolicySheet})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Changes) != 2 || result.Changes[0].Kind != Added || result.Changes[1].Kind != Skipped || result.Changes[1].Row != 4 {
+			t.Fatalf("expected one row added and one skipped, got %+v", result.Changes)
+		}
+
+		id := result.Changes[0].SessionID
+		entry, ok := h.Get(id)
+		if !ok {
+			t.Fatalf("expected session %s in the history", id)
+		}
+		wantStart := time.Date(2025, 3, 15, 22, 0, 0, 0, time.UTC)
+		if !entry.Start.Equal(wantStart) || !entry.End.Equal(wantStart.Add(3*time.Hour)) || entry.Duration != 3*time.Hour {
+			t.Errorf("expected 3 hours past midnight, got %+v", entry)
+		}
+		if len(entry.Tags) != 2 || entry.Tags[1] != "wool" {
+			t.Errorf("expected the tags, got %v", entry.Tags)
+		}
+		if row := server.Metadata("sheet-id", "CraftTime", "craftie_session", id); row != 3 {
+			t.Errorf("expected row 3 to be tagged, got %d", row)
+		}
+	})
+
+	t.Run("conflicts follow the policy", func(t *testing.T) {
+		for _, tc := range []struct {
+			policy  Policy
+			answer  bool
+			want    string
+			inSheet string
+		}{
+			{PolicySheet, false, "sheet note", "sheet note"},
+			{PolicyLocal, false, "local note", "local note"},
+			{PolicyPrompt, true, "sheet note", "sheet note"},
+			{PolicyPrompt, false, "local note", "local note"},
+		} {
+			server, p, h := synced(t)
+			setCell(server, 2, 6, "sheet note")
+			entry, _ := h.Get("session-1")
+			entry.Notes = "local note"
+			h.Put(entry)
+
+			var asked []Conflict
+			opts := PullOptions{Policy: tc.policy, Resolve: func(c Conflict) (bool, error) {
+				asked = append(asked, c)
+				return tc.answer, nil
+			}}
+			if _, err := Pull(ctx, p, h, opts); err != nil {
+				t.Fatalf("%s: expected no error, got: %v", tc.policy, err)
+			}
+
+			entry, _ = h.Get("session-1")
+			if entry.Notes != tc.want {
+				t.Errorf("%s: expected %q locally, got %q", tc.policy, tc.want, entry.Notes)
+			}
+			if got := cell(t, p, 2, "Notes"); got != tc.inSheet {
+				t.Errorf("%s: expected %q in the sheet, got %q", tc.policy, tc.inSheet, got)
+			}
+			if wantAsked := tc.policy == PolicyPrompt; (len(asked) == 1) != wantAsked {
+				t.Errorf("%s: expected to be asked %v, got %+v", tc.policy, wantAsked, asked)
+			}
+			if len(asked) == 1 && (asked[0].Local != "local note" || asked[0].SheetValue != "sheet note" || asked[0].Base != "") {
+				t.Errorf("%s: unexpected conflict %+v", tc.policy, asked[0])
+			}
+		}
+	})
+
+	t.Run("a conflict without a terminal fails", func(t *testing.T) {
+		server, p, h := synced(t)
+		setCell(server, 2, 1, "sewing")
+		entry, _ := h.Get("session-1")
+		entry.Task = "pressing"
+		h.Put(entry)
+
+		if _, err := Pull(ctx, p, h, PullOptions{Policy: PolicyPrompt}); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("local changes are pushed", func(t *testing.T) {
+		_, p, h := synced(t)
+		entry, _ := h.Get("session-1")
+		entry.Rate = 40
+		h.Put(entry)
+
+		result, err := Pull(ctx, p, h, PullOptions{Policy: PolicyPrompt})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Changes) != 1 || result.Changes[0].Kind != Pushed || result.Changes[0].To != "40" {
+			t.Errorf("expected the rate pushed, got %+v", result.Changes)
+		}
+		if got := cell(t, p, 2, "Rate"); got != "40" {
+			t.Errorf("expected the rate in the sheet, got %q", got)
+		}
+	})
+
+	t.Run("running and deleted sessions are reported", func(t *testing.T) {
+		server, p, h := synced(t)
+		server.DeleteRow("sheet-id", "CraftTime", 2)
+
+		running := &session.Session{ID: "session-2", StartTime: start.Add(24 * time.Hour), ProjectName: "hat"}
+		pr := p
+		pr.Session = running
+		if _, err := sheets.InitRow(ctx, pr); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		h.Put(history.FromSession(running))
+
+		result, err := Pull(ctx, p, h, PullOptions{Policy: PolicyPrompt})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Changes) != 2 || result.Changes[0].Kind != Skipped || result.Changes[0].SessionID != "session-2" ||
+			result.Changes[1].Kind != Missing || result.Changes[1].SessionID != "session-1" {
+			t.Errorf("expected the running session skipped and the deleted one missing, got %+v", result.Changes)
+		}
+		if _, ok := h.Get("session-1"); !ok {
+			t.Error("expected the deleted session to be kept locally")
+		}
+	})
+
+	t.Run("a dry run changes nothing in the sheet", func(t *testing.T) {
+		server, p, h := synced(t)
+		setCell(server, 2, 4, "13:00:00")
+		server.SetValues("sheet-id", "CraftTime", append(server.Values("sheet-id", "CraftTime"),
+			[]string{"hat", "knitting", "2025-03-15", "10:00", "12:00"},
+		))
+		before := server.Values("sheet-id", "CraftTime")
+		duration := cell(t, p, 2, "Duration")
+
+		result, err := Pull(ctx, p, h, PullOptions{Policy: PolicySheet, DryRun: true})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(result.Changes) != 2 {
+			t.Errorf("expected the edit and the new row reported, got %+v", result.Changes)
+		}
+		after := server.Values("sheet-id", "CraftTime")
+		if cell(t, p, 2, "Duration") != duration || len(after) != len(before) {
+			t.Errorf("expected the sheet unchanged, got %v", after)
+		}
+		if id := result.Changes[1].SessionID; server.Metadata("sheet-id", "CraftTime", "craftie_session", id) != 0 {
+			t.Error("expected the new row not to be tagged")
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package tui
+
+import (
+	"strings"
+	"time"
+)
+
+// glyphs is a 5 row block font for the elapsed clock
+var glyphs = map[rune][5]string{
+	'0': {"█████", "█   █", "█   █", "█   █", "█████"},
+	'1': {"    █", "    █", "    █", "    █", "    █"},
+	'2': {"█████", "    █", "█████", "█    ", "█████"},
+	'3': {"█████", "    █", "█████", "    █", "█████"},
+	'4': {"█   █", "█   █", "█████", "    █", "    █"},
+	'5': {"█████", "█    ", "█████", "    █", "█████"},
+	'6': {"█████", "█    ", "█████", "█   █", "█████"},
+	'7': {"█████", "    █", "    █", "    █", "    █"},
+	'8': {"█████", "█   █", "█████", "█   █", "█████"},
+	'9': {"█████", "█   █", "█████", "    █", "█████"},
+	':': {"  ", "██", "  ", "██", "  "},
+}
+
+// bigClock renders d as HH:MM:SS in the block font
+func bigClock(d time.Duration) [5]string {
+	var rows [5]string
+	for _, r := range formatDuration(d) {
+		glyph, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+		for i := range rows {
+			rows[i] += glyph[i] + " "
+		}
+	}
+	for i := range rows {
+		rows[i] = strings.TrimRight(rows[i], " ")
+	}
+	return rows
+}
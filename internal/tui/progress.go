@@ -0,0 +1,38 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// progressWidth is the number of cells of a progress bar
+const progressWidth = 30
+
+// Progress draws a progress bar on the last line of a terminal
+type Progress struct {
+	out   io.Writer
+	label string
+}
+
+// NewProgress draws an empty bar labelled label
+func NewProgress(out io.Writer, label string, total int) *Progress {
+	p := &Progress{out: out, label: label}
+	p.Update(0, total)
+	return p
+}
+
+// Update redraws the bar with done of total
+func (p *Progress) Update(done, total int) {
+	filled := 0
+	if total > 0 {
+		filled = progressWidth * min(done, total) / total
+	}
+	fmt.Fprintf(p.out, "\r%s [%s%s] %d/%d", p.label,
+		strings.Repeat("#", filled), strings.Repeat("-", progressWidth-filled), done, total)
+}
+
+// Done ends the line of the bar
+func (p *Progress) Done() {
+	fmt.Fprintln(p.out)
+}
@@ -0,0 +1,299 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+type ActionKind int
+
+const (
+	ActionTogglePause ActionKind = iota
+	ActionNote
+	ActionSwitchTask
+	ActionStop
+)
+
+// Action is a user request coming from a key press
+type Action struct {
+	Kind ActionKind
+	Text string // note text or new task name
+}
+
+// SinkStatus is the outcome of the last sync to a sink (CSV, Google Sheets)
+type SinkStatus struct {
+	Name     string
+	LastSync time.Time
+	Err      error
+}
+
+// State is everything the screen shows
+type State struct {
+	Project   string
+	Task      string
+	Notes     string
+	Elapsed   time.Duration
+	Paused    bool
+	BreakTime time.Duration
+	TimeLeft  *time.Duration // nil when there is no end timer
+	Sinks     []SinkStatus
+}
+
+const (
+	keyCtrlC     = 3
+	keyBackspace = 8
+	keyEnter     = 13
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// UI is a full-screen terminal view of the running session
+type UI struct {
+	in       *os.File
+	out      *os.File
+	oldState *term.State
+	actions  chan Action
+	// done is closed by Close, key presses after it are dropped
+	done chan struct{}
+
+	mu      sync.Mutex
+	state   State
+	message string
+	prompt  *prompt // non-nil while the user is typing a note or task
+	closed  bool
+}
+
+type prompt struct {
+	label  string
+	kind   ActionKind
+	buffer []rune
+}
+
+// IsTerminal reports whether f is connected to a terminal
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// Start switches the terminal to raw mode and the alternate screen and starts
+// reading key presses from in
+func Start(in, out *os.File) (*UI, error) {
+	oldState, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to enter raw mode: %w", err)
+	}
+
+	u := &UI{
+		in:       in,
+		out:      out,
+		oldState: oldState,
+		actions:  make(chan Action, 1),
+		done:     make(chan struct{}),
+	}
+
+	// alternate screen, hidden cursor
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+
+	go u.readKeys()
+
+	return u, nil
+}
+
+// Actions returns the channel key press actions are delivered on
+func (u *UI) Actions() <-chan Action {
+	return u.actions
+}
+
+// Render redraws the screen with the given state
+func (u *UI) Render(s State) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.state = s
+	u.draw()
+}
+
+// Write shows the last line written as the status message, so the UI can be
+// used wherever plain output would be printed
+func (u *UI) Write(p []byte) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	lines := strings.Split(strings.TrimSpace(string(p)), "\n")
+	if msg := strings.TrimSpace(lines[len(lines)-1]); msg != "" {
+		u.message = msg
+	}
+	u.draw()
+
+	return len(p), nil
+}
+
+// Close restores the terminal to the state it was in before Start
+func (u *UI) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.closed {
+		return nil
+	}
+	u.closed = true
+	close(u.done)
+
+	fmt.Fprint(u.out, "\x1b[?25h\x1b[?1049l")
+	return term.Restore(int(u.in.Fd()), u.oldState)
+}
+
+func (u *UI) readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := u.in.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, r := range string(buf[:n]) {
+			if action, ok := u.handleKey(r); ok {
+				select {
+				case u.actions <- action:
+				case <-u.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (u *UI) handleKey(r rune) (Action, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	defer u.draw()
+
+	if r == keyCtrlC {
+		return Action{Kind: ActionStop}, true
+	}
+
+	if u.prompt != nil {
+		return u.handlePromptKey(r)
+	}
+
+	switch r {
+	case 'p', ' ':
+		return Action{Kind: ActionTogglePause}, true
+	case 'n':
+		u.prompt = &prompt{label: "Note", kind: ActionNote}
+	case 't':
+		u.prompt = &prompt{label: "Task", kind: ActionSwitchTask}
+	case 'q':
+		return Action{Kind: ActionStop}, true
+	}
+
+	return Action{}, false
+}
+
+func (u *UI) handlePromptKey(r rune) (Action, bool) {
+	p := u.prompt
+
+	switch r {
+	case keyEnter, '\n':
+		u.prompt = nil
+		text := strings.TrimSpace(string(p.buffer))
+		if text == "" {
+			return Action{}, false
+		}
+		return Action{Kind: p.kind, Text: text}, true
+	case keyEscape:
+		u.prompt = nil
+	case keyBackspace, keyDelete:
+		if len(p.buffer) > 0 {
+			p.buffer = p.buffer[:len(p.buffer)-1]
+		}
+	default:
+		if r >= ' ' {
+			p.buffer = append(p.buffer, r)
+		}
+	}
+
+	return Action{}, false
+}
+
+// draw must be called with u.mu held
+func (u *UI) draw() {
+	if u.closed {
+		return
+	}
+
+	var b strings.Builder
+	// raw mode needs explicit carriage returns
+	line := func(format string, a ...any) {
+		fmt.Fprintf(&b, "  "+format+"\x1b[K\r\n", a...)
+	}
+
+	b.WriteString("\x1b[H\x1b[2J\r\n")
+
+	s := u.state
+	for _, row := range bigClock(s.Elapsed) {
+		line("%s", row)
+	}
+	line("")
+
+	line("Project: %s", s.Project)
+	if s.Task != "" {
+		line("Task:    %s", s.Task)
+	}
+	if s.Notes != "" {
+		line("Notes:   %s", s.Notes)
+	}
+	line("")
+
+	if s.Paused {
+		line("⏸  On a break (%s in total)", formatDuration(s.BreakTime))
+	} else if s.BreakTime > 0 {
+		line("▶  Working (%s on breaks)", formatDuration(s.BreakTime))
+	} else {
+		line("▶  Working")
+	}
+	if s.TimeLeft != nil {
+		line("⏱  %s left", formatDuration(*s.TimeLeft))
+	}
+	line("")
+
+	for _, sink := range s.Sinks {
+		switch {
+		case sink.Err != nil:
+			line("✗ %s: %v", sink.Name, sink.Err)
+		case sink.LastSync.IsZero():
+			line("… %s: not synced yet", sink.Name)
+		default:
+			line("✓ %s: synced at %s", sink.Name, sink.LastSync.Format(time.TimeOnly))
+		}
+	}
+	if len(s.Sinks) > 0 {
+		line("")
+	}
+
+	if u.message != "" {
+		line("%s", u.message)
+		line("")
+	}
+
+	if u.prompt != nil {
+		line("%s: %s█", u.prompt.label, string(u.prompt.buffer))
+		line("[enter] save  [esc] cancel")
+	} else {
+		pause := "pause"
+		if s.Paused {
+			pause = "resume"
+		}
+		line("[p] %s  [n] note  [t] switch task  [q] stop", pause)
+	}
+
+	fmt.Fprint(u.out, b.String())
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}